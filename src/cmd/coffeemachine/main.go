@@ -0,0 +1,284 @@
+package main
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/forecasting"
+	"coffeeMachine/src/services/machinefile"
+	"coffeeMachine/src/services/planner"
+	"coffeeMachine/src/services/reporting"
+	"coffeeMachine/src/services/vendingmachine"
+	"coffeeMachine/src/services/webhook"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage: coffeemachine <command> [flags]
+
+commands:
+  pour      pour all beverages of a machine file, recording outcomes to the history file
+  report    print a sales and consumption report for a time range
+  forecast  print time-to-depletion per ingredient, and a refill plan keeping the top beverages available
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "pour":
+		err = pour(os.Args[2:], os.Stdout)
+	case "report":
+		err = report(os.Args[2:], os.Stdout)
+	case "forecast":
+		err = forecast(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func pour(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("pour", flag.ExitOnError)
+	machinePath := flags.String("machine", "", "path to the machine file (json)")
+	historyPath := flags.String("history", "history.jsonl", "path to the history file outcomes are appended to")
+	plan := flags.String("plan", "", "plan the batch before pouring: MAX_DRINKS, MAX_REVENUE or PRIORITY")
+	webhookURLs := flags.String("webhook", "", "comma separated URLs notified of rejected drinks, low ingredients and state changes")
+	lowThresholds := flags.String("low", "", "low ingredient thresholds for webhooks, like milk=100,hot_water=500")
+	deadLetterPath := flags.String("dead-letters", "", "path to the file undeliverable webhook notifications are appended to")
+	inventoryPath := flags.String("inventory", "", "path to an inventory file (json or csv) the machine is refilled from, instead of the machine file's quantities")
+	exportPath := flags.String("export", "", "path to the file (json or csv) the remaining inventory is exported to, after pouring")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	objective, err := planner.ParseObjective(*plan)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	machine, err := machinefile.Load(*machinePath)
+	if err != nil {
+		return err
+	}
+
+	bus := eventbus.New()
+	ledger := resourcemanager.New(resourcemanager.WithEventBus(bus))
+	if *webhookURLs != "" {
+		thresholds, err := webhook.ParseThresholds(*lowThresholds)
+		if err != nil {
+			return err
+		}
+		webhook.New(webhook.Config{
+			URLs:           strings.Split(*webhookURLs, ","),
+			Secret:         os.Getenv("COFFEE_MACHINE_WEBHOOK_SECRET"),
+			LowThresholds:  thresholds,
+			Ledger:         ledger,
+			DeadLetterPath: *deadLetterPath,
+		}).Subscribe(bus, 1024)
+	}
+
+	coffeeMachine := vendingmachine.New(vendingmachine.Params{
+		ResourceManager:   ledger,
+		NumOfOutlets:      machine.Outlets,
+		Recorder:          reporting.NewFileStore(*historyPath),
+		PlanningObjective: objective,
+		EventBus:          bus,
+	})
+	inventory := machine.Inventory
+	if *inventoryPath != "" {
+		if inventory, err = machinefile.LoadInventory(*inventoryPath); err != nil {
+			return err
+		}
+	}
+	stocked, err := addDepleted(ctx, ledger, inventory)
+	if err != nil {
+		return err
+	}
+	refillReqs := make([]vendingmachine.RefillLotRequest, 0, len(stocked))
+	for _, ingredient := range stocked {
+		refillReqs = append(refillReqs, vendingmachine.RefillLotRequest{Ingredient: ingredient})
+	}
+	if err := coffeeMachine.RefillMany(ctx, refillReqs); err != nil {
+		return err
+	}
+
+	for resp := range coffeeMachine.PourDrinks(ctx, machine.Beverages) {
+		fmt.Fprint(out, resp.String())
+	}
+	if *exportPath != "" {
+		if err := exportInventory(ctx, coffeeMachine, *exportPath); err != nil {
+			return err
+		}
+	}
+
+	// the history is flushed and pending webhooks are delivered before exiting
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	summary, err := coffeeMachine.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+	for _, order := range summary.Abandoned {
+		fmt.Fprintf(out, "%s : ABANDONED : %s\n", order.OrderID, order.Reason)
+	}
+	return nil
+}
+
+/*
+	addDepleted adds the ingredients of the inventory with nothing on hand to the ledger, and returns the others to be
+	refilled - refills must be positive, but an exported inventory lists every ingredient poured to the last drop.
+*/
+func addDepleted(ctx context.Context, ledger resourcemanager.Repository, inventory []entities.Ingredient) ([]entities.Ingredient, error) {
+	stocked := make([]entities.Ingredient, 0, len(inventory))
+	for _, ingredient := range inventory {
+		if ingredient.Quantity > 0 {
+			stocked = append(stocked, ingredient)
+			continue
+		}
+		if err := ledger.AddIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: ingredient.ID}); err != nil {
+			return nil, err
+		}
+	}
+	return stocked, nil
+}
+
+// exportInventory writes the quantities on hand, so that the machine can be restored from them with -inventory
+func exportInventory(ctx context.Context, coffeeMachine vendingmachine.CoffeeMachine, path string) error {
+	inventory, err := coffeeMachine.Inventory(ctx)
+	if err != nil {
+		return err
+	}
+	ingredients := make([]entities.Ingredient, 0, len(inventory.Ingredients))
+	for _, levels := range inventory.Ingredients {
+		ingredients = append(ingredients, entities.Ingredient{ID: levels.IngredientID, Quantity: levels.OnHand})
+	}
+	return machinefile.SaveInventory(path, ingredients)
+}
+
+func report(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	historyPath := flags.String("history", "history.jsonl", "path to the history file")
+	from := flags.String("from", "", "start of the time range, RFC3339 (default: 24 hours before -to)")
+	to := flags.String("to", "", "end of the time range, RFC3339 (default: now)")
+	format := flags.String("format", "csv", "output format: csv or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	toTime := time.Now()
+	if *to != "" {
+		parsed, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return err
+		}
+		toTime = parsed
+	}
+	fromTime := toTime.Add(-24 * time.Hour)
+	if *from != "" {
+		parsed, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return err
+		}
+		fromTime = parsed
+	}
+
+	records, err := reporting.NewFileStore(*historyPath).Records(context.Background(), fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	salesReport := reporting.Build(records, fromTime, toTime)
+
+	switch *format {
+	case "csv":
+		return reporting.WriteCSV(out, salesReport)
+	case "json":
+		return reporting.WriteJSON(out, salesReport)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func forecast(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("forecast", flag.ExitOnError)
+	machinePath := flags.String("machine", "", "path to the machine file (json), holding the recipes - and the quantities, unless -inventory is given")
+	inventoryPath := flags.String("inventory", "", "path to an inventory file (json or csv) holding the current quantities, e.g. exported by pour -export")
+	historyPath := flags.String("history", "history.jsonl", "path to the history file")
+	window := flags.Duration("window", 24*time.Hour, "how much history to average consumption over")
+	horizon := flags.Duration("horizon", 8*time.Hour, "how long the top beverages should stay available")
+	topN := flags.Int("top", 3, "number of best selling beverages to keep available")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	machine, err := machinefile.Load(*machinePath)
+	if err != nil {
+		return err
+	}
+	// the machine file only has the initial quantities, what's been poured since is in the exported inventory
+	inventory := machine.Inventory
+	if *inventoryPath != "" {
+		if inventory, err = machinefile.LoadInventory(*inventoryPath); err != nil {
+			return err
+		}
+	}
+	resourceManager := resourcemanager.New()
+	stocked, err := addDepleted(ctx, resourceManager, inventory)
+	if err != nil {
+		return err
+	}
+	for _, ingredient := range stocked {
+		_, err := resourceManager.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+			IngredientID:     ingredient.ID,
+			UpdateType:       resourcemanager.UpdateTypeRefill,
+			ResourceQuantity: ingredient.Quantity,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	forecaster := forecasting.New(forecasting.Params{
+		Store:           reporting.NewFileStore(*historyPath),
+		ResourceManager: resourceManager,
+		Recipes:         machine.Beverages,
+	})
+	now := time.Now()
+
+	depletions, err := forecaster.Forecast(ctx, forecasting.ForecastRequest{Now: now, Window: *window})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "ingredient\tavailable\trate/hour\ttime-to-depletion")
+	for _, depletion := range depletions {
+		timeToDepletion := "never"
+		if depletion.TimeToDepletion != nil {
+			timeToDepletion = depletion.TimeToDepletion.Round(time.Minute).String()
+		}
+		fmt.Fprintf(out, "%s\t%d\t%.1f\t%s\n", depletion.IngredientID, depletion.Available, depletion.RatePerHour, timeToDepletion)
+	}
+
+	plan, err := forecaster.PlanRefills(ctx, forecasting.PlanRequest{Now: now, Window: *window, Horizon: *horizon, TopN: *topN})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nrefill plan for %v\n", plan.TopBeverages)
+	for _, refill := range plan.Refills {
+		fmt.Fprintf(out, "%s\t+%d\tby %s\n", refill.IngredientID, refill.Quantity, refill.RefillBy.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the single hot tea pours all the hot water, so the exported inventory has it depleted
+const machineFile = `{
+  "machine": {
+    "outlets": {"count_n": 1},
+    "total_items_quantity": {"hot_water": 200, "hot_milk": 100},
+    "beverages": {"hot_tea": {"hot_water": 200}}
+  }
+}`
+
+func Test_exportInventory_Import(t *testing.T) {
+	tests := []struct {
+		name       string
+		exportFile string
+	}{
+		{name: "success | json", exportFile: "inventory.json"},
+		{name: "success | csv", exportFile: "inventory.csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			machinePath := filepath.Join(dir, "machine.json")
+			if err := ioutil.WriteFile(machinePath, []byte(machineFile), 0644); err != nil {
+				panic(err)
+			}
+			historyPath := filepath.Join(dir, "history.jsonl")
+			exportPath := filepath.Join(dir, tt.exportFile)
+
+			out := &bytes.Buffer{}
+			err := pour([]string{"-machine", machinePath, "-history", historyPath, "-export", exportPath}, out)
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "hot_tea : PREPARED")
+
+			// the depleted hot water is restored as held, but with nothing on hand
+			out.Reset()
+			err = pour([]string{"-machine", machinePath, "-history", historyPath, "-inventory", exportPath}, out)
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "resource is insufficient, resource-id : hot_water")
+
+			out.Reset()
+			err = forecast([]string{"-machine", machinePath, "-history", historyPath, "-inventory", exportPath}, out)
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "hot_water\t0\t")
+		})
+	}
+}
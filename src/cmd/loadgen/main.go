@@ -0,0 +1,76 @@
+package main
+
+import (
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/loadgen"
+	"coffeeMachine/src/services/machinefile"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	seed := flag.Int64("seed", 1, "seed of the generated batch")
+	batchSize := flag.Int("batch", 10000, "number of beverages in the batch")
+	outlets := flag.Int("outlets", 8, "number of outlets of the machine")
+	mix := flag.String("mix", "hot_tea=4,hot_coffee=3,black_tea=2,green_tea=1", "beverage mix, as beverage=weight pairs")
+	contention := flag.Float64("contention", 1, "ratio of demand to supply, above 1 some beverages must be rejected")
+	runs := flag.Int("runs", 3, "number of times the batch is poured, every run on a freshly refilled machine")
+	machinePath := flag.String("machine", "", "pour this machine file instead of generating one")
+	writePath := flag.String("write", "", "write the generated machine file to this path, instead of pouring it")
+	flag.Parse()
+
+	if err := run(*seed, *batchSize, *outlets, *mix, *contention, *runs, *machinePath, *writePath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(seed int64, batchSize, outlets int, mixSpec string, contention float64, runs int, machinePath, writePath string) error {
+	var machine *machinefile.Machine
+	if machinePath != "" {
+		loaded, err := machinefile.Load(machinePath)
+		if err != nil {
+			return err
+		}
+		machine = loaded
+	} else {
+		mix, err := loadgen.ParseMix(mixSpec)
+		if err != nil {
+			return err
+		}
+		machine = loadgen.Generate(loadgen.Config{
+			Seed:       seed,
+			BatchSize:  batchSize,
+			Outlets:    outlets,
+			Mix:        mix,
+			Contention: contention,
+		})
+	}
+
+	if writePath != "" {
+		file, err := os.Create(writePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return machinefile.Write(file, machine)
+	}
+
+	newCoffeeMachine := func(numOfOutlets int) vendingmachine.CoffeeMachine {
+		return vendingmachine.New(vendingmachine.Params{
+			ResourceManager: resourcemanager.New(),
+			NumOfOutlets:    numOfOutlets,
+		})
+	}
+	for i := 0; i < runs; i++ {
+		result, err := loadgen.Run(context.Background(), machine, newCoffeeMachine)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("run %d: %s\n", i+1, result)
+	}
+	return nil
+}
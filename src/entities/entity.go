@@ -2,6 +2,7 @@ package entities
 
 import (
 	"strings"
+	"time"
 )
 
 type Ingredient struct {
@@ -12,9 +13,30 @@ type Ingredient struct {
 type Item struct {
 	ID          string
 	Ingredients []Ingredient
+	// Price and Priority are only used when planning a batch, see planner.Objective
+	Price    int
+	Priority int
 }
 
+// RejectCode tells why a drink was rejected, without parsing the message
+type RejectCode string
+
+var (
+	RejectCodeInsufficient            RejectCode = "INSUFFICIENT"
+	RejectCodeTemporarilyNotAvailable RejectCode = "TEMPORARILY_NOT_AVAILABLE"
+	RejectCodeNotAvailable            RejectCode = "NOT_AVAILABLE"
+	RejectCodeExcludedByPlan          RejectCode = "EXCLUDED_BY_PLAN"
+	RejectCodeMachineNotReady         RejectCode = "MACHINE_NOT_READY"
+	RejectCodeAbandoned               RejectCode = "ABANDONED"
+	RejectCodeExpired                 RejectCode = "EXPIRED"
+	RejectCodeBelowTemperature        RejectCode = "BELOW_TEMPERATURE"
+	RejectCodeNoMachineAvailable      RejectCode = "NO_MACHINE_AVAILABLE"
+	RejectCodeIngredientDeactivated   RejectCode = "INGREDIENT_DEACTIVATED"
+	RejectCodeOther                   RejectCode = "OTHER"
+)
+
 type RejectReason struct {
+	Code            RejectCode
 	RejectReasonMsg string
 }
 
@@ -33,6 +55,10 @@ type GetItemResponse struct {
 	Item          Item
 	Outcome       GetItemOutcome
 	RejectReasons []RejectReason
+	OutletID      int
+	ServedAt      time.Time
+	// Lots the ingredients were taken from, if they were refilled with lot-ids
+	Lots []LotUsage
 }
 
 func (g GetItemResponse) String() string {
@@ -45,3 +71,50 @@ func (g GetItemResponse) String() string {
 	resp += "\n"
 	return resp
 }
+
+// PreOrder is a beverage whose ingredients are held for the customer till ExpiresAt
+type PreOrder struct {
+	Token     string
+	OrderID   string
+	Item      Item
+	ExpiresAt time.Time
+}
+
+// Lot is a refill of an ingredient, which is consumed in the order of refills till it expires
+type Lot struct {
+	ID           string
+	IngredientID string
+	// Quantity is what's left of the lot
+	Quantity  int
+	ExpiresAt time.Time
+	Expired   bool
+	// WrittenOff is the quantity removed from the inventory, once the lot expired
+	WrittenOff int
+}
+
+// LotUsage is the quantity of an ingredient a drink took from a lot, for recall tracing
+type LotUsage struct {
+	IngredientID string
+	LotID        string
+	Quantity     int
+}
+
+// AdjustReason is why the quantity on hand of an ingredient was set, instead of refilled or consumed
+type AdjustReason string
+
+const (
+	AdjustReasonSpillage  AdjustReason = "SPILLAGE"
+	AdjustReasonStockTake AdjustReason = "STOCK_TAKE"
+	AdjustReasonWaste     AdjustReason = "WASTE"
+)
+
+// Adjustment records the variance between the quantity on hand the inventory expected, and the one observed
+type Adjustment struct {
+	IngredientID string
+	Reason       AdjustReason
+	Expected     int
+	Observed     int
+	// Variance is Observed - Expected, negative when some quantity went missing
+	Variance int
+	At       time.Time
+}
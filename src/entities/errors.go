@@ -1,5 +1,10 @@
 package entities
 
+import (
+	"strconv"
+	"time"
+)
+
 type ErrResourceTemporarilyNotAvailable struct {
 	ResourceID string
 }
@@ -23,3 +28,218 @@ type ErrResourceNotAvailable struct {
 func (e ErrResourceNotAvailable) Error() string {
 	return "resource not available, resource-id : " + e.ResourceID
 }
+
+type ErrQuantityOverflow struct {
+	ResourceID string
+}
+
+func (e ErrQuantityOverflow) Error() string {
+	return "resource quantity out of range, resource-id : " + e.ResourceID
+}
+
+type ErrExcludedByPlan struct {
+	ItemID string
+}
+
+func (e ErrExcludedByPlan) Error() string {
+	return "item excluded by batch plan, ingredients are kept for other items, item-id : " + e.ItemID
+}
+
+type ErrReservationNotFound struct {
+	Token string
+}
+
+func (e ErrReservationNotFound) Error() string {
+	return "reservation not found, token : " + e.Token
+}
+
+// ErrReservationClosed is returned when committing a cancelled reservation, or cancelling a committed one
+type ErrReservationClosed struct {
+	Token  string
+	Status string
+}
+
+func (e ErrReservationClosed) Error() string {
+	return "reservation is already " + e.Status + ", token : " + e.Token
+}
+
+type ErrInvalidPreOrderWindow struct {
+	OrderID string
+}
+
+func (e ErrInvalidPreOrderWindow) Error() string {
+	return "pre-order window must be positive, order-id : " + e.OrderID
+}
+
+// ErrNotAllowedInState is returned when the machine's state doesn't allow an operation, e.g. pouring during maintenance
+type ErrNotAllowedInState struct {
+	Operation string
+	State     string
+}
+
+func (e ErrNotAllowedInState) Error() string {
+	return e.Operation + " not allowed while the machine is " + e.State
+}
+
+type ErrInvalidStateTransition struct {
+	From string
+	To   string
+}
+
+func (e ErrInvalidStateTransition) Error() string {
+	return "machine can't move from " + e.From + " to " + e.To
+}
+
+// ErrOrderAbandoned is returned for an item which didn't reach an outlet before the machine was shut down
+type ErrOrderAbandoned struct {
+	OrderID string
+}
+
+func (e ErrOrderAbandoned) Error() string {
+	return "order abandoned, the machine was shut down, order-id : " + e.OrderID
+}
+
+type ErrLotExpired struct {
+	ResourceID string
+	LotID      string
+}
+
+func (e ErrLotExpired) Error() string {
+	return "lot expired, resource-id : " + e.ResourceID + ", lot-id : " + e.LotID
+}
+
+// ErrBelowTemperature is returned when a hot ingredient's boiler wouldn't be hot enough in time to pour a drink
+type ErrBelowTemperature struct {
+	ResourceID     string
+	Temperature    float64
+	MinTemperature float64
+}
+
+func (e ErrBelowTemperature) Error() string {
+	return "resource below temperature, resource-id : " + e.ResourceID +
+		", temperature : " + strconv.FormatFloat(e.Temperature, 'f', 1, 64) +
+		", min-temperature : " + strconv.FormatFloat(e.MinTemperature, 'f', 1, 64)
+}
+
+// ErrNoMachineAvailable is returned when no machine of a fleet can prepare an item
+type ErrNoMachineAvailable struct {
+	ItemID string
+}
+
+func (e ErrNoMachineAvailable) Error() string {
+	return "no machine available, item-id : " + e.ItemID
+}
+
+type ErrInvalidAdjustReason struct {
+	Reason string
+}
+
+func (e ErrInvalidAdjustReason) Error() string {
+	return "invalid adjust reason : " + e.Reason
+}
+
+// ErrBelowReserved is returned when an adjustment would leave less on hand than reservations hold
+type ErrBelowReserved struct {
+	ResourceID string
+	Quantity   int
+	Reserved   int
+}
+
+func (e ErrBelowReserved) Error() string {
+	return "quantity below reserved, resource-id : " + e.ResourceID +
+		", quantity : " + strconv.Itoa(e.Quantity) + ", reserved : " + strconv.Itoa(e.Reserved)
+}
+
+// ErrIngredientDeactivated is returned when reserving or refilling an ingredient which was deactivated
+type ErrIngredientDeactivated struct {
+	ResourceID string
+}
+
+func (e ErrIngredientDeactivated) Error() string {
+	return "ingredient deactivated, resource-id : " + e.ResourceID
+}
+
+// ErrIngredientActive is returned when removing an ingredient which wasn't deactivated first
+type ErrIngredientActive struct {
+	ResourceID string
+}
+
+func (e ErrIngredientActive) Error() string {
+	return "ingredient still active, deactivate it before removing, resource-id : " + e.ResourceID
+}
+
+// ErrIngredientNotEmpty is returned when removing an ingredient which is still on hand, or reserved
+type ErrIngredientNotEmpty struct {
+	ResourceID string
+	OnHand     int
+	Reserved   int
+}
+
+func (e ErrIngredientNotEmpty) Error() string {
+	return "ingredient not empty, resource-id : " + e.ResourceID +
+		", on-hand : " + strconv.Itoa(e.OnHand) + ", reserved : " + strconv.Itoa(e.Reserved)
+}
+
+// ErrMissingID is returned for a request without the id it refers to, Field names the id
+type ErrMissingID struct {
+	Field string
+}
+
+func (e ErrMissingID) Error() string {
+	return "missing " + e.Field
+}
+
+// ErrNoIngredients is returned for an order which would reserve nothing
+type ErrNoIngredients struct {
+	OrderID string
+}
+
+func (e ErrNoIngredients) Error() string {
+	return "no ingredients, order-id : " + e.OrderID
+}
+
+// ErrInvalidQuantity is returned for a negative quantity, or a zero one where nothing would happen
+type ErrInvalidQuantity struct {
+	ResourceID string
+	Quantity   int
+}
+
+func (e ErrInvalidQuantity) Error() string {
+	return "invalid quantity, resource-id : " + e.ResourceID + ", quantity : " + strconv.Itoa(e.Quantity)
+}
+
+type ErrInvalidUpdateType struct {
+	UpdateType string
+}
+
+func (e ErrInvalidUpdateType) Error() string {
+	return "invalid update type : " + e.UpdateType
+}
+
+// ErrInvalidDuration is returned for a duration out of range, Field names it - e.g. a forecast window which isn't positive
+type ErrInvalidDuration struct {
+	Field    string
+	Duration time.Duration
+}
+
+func (e ErrInvalidDuration) Error() string {
+	return "invalid " + e.Field + " : " + e.Duration.String()
+}
+
+// ErrInvalidCount is returned for a count out of range, Field names it - e.g. a negative number of top beverages
+type ErrInvalidCount struct {
+	Field string
+	Count int
+}
+
+func (e ErrInvalidCount) Error() string {
+	return "invalid " + e.Field + " : " + strconv.Itoa(e.Count)
+}
+
+type ErrInvalidObjective struct {
+	Objective string
+}
+
+func (e ErrInvalidObjective) Error() string {
+	return "invalid planning objective : " + e.Objective
+}
@@ -0,0 +1,24 @@
+package reservationmanager_test
+
+import (
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/reservationmanager/reservationmanagertest"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	reservationmanagertest.Run(t, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository) {
+		ledger := resourcemanager.New(resourcemanager.WithClock(clk), resourcemanager.WithEventBus(bus))
+		return ledger, reservationmanager.New(ledger, reservationmanager.WithClock(clk), reservationmanager.WithEventBus(bus))
+	})
+}
+
+func FuzzReservations(f *testing.F) {
+	reservationmanagertest.Fuzz(f, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository) {
+		ledger := resourcemanager.New(resourcemanager.WithClock(clk), resourcemanager.WithEventBus(bus))
+		return ledger, reservationmanager.New(ledger, reservationmanager.WithClock(clk), reservationmanager.WithEventBus(bus))
+	})
+}
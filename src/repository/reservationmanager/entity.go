@@ -1,15 +1,63 @@
 package reservationmanager
 
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "PENDING"
+	StatusCommitted Status = "COMMITTED"
+	StatusCancelled Status = "CANCELLED"
+	// StatusExpired reservations were released because they weren't committed within their TTL
+	StatusExpired Status = "EXPIRED"
+)
+
+// Reservation holds the ingredients of a whole order, it is referred to by its token
+type Reservation struct {
+	Token       string
+	OrderID     string
+	Ingredients []entities.Ingredient
+	Status      Status
+	CreatedAt   time.Time
+	// ExpiresAt is zero for reservations which never expire
+	ExpiresAt time.Time
+	// Lots the ingredients were taken from once committed, if they were refilled with lot-ids
+	Lots []entities.LotUsage
+}
+
 type CreateReservationRequest struct {
-	IngredientID    string
-	ReserveQuantity int
+	OrderID     string
+	Ingredients []entities.Ingredient
+	// TTL is optional, if set - the reservation is released unless committed within it
+	TTL time.Duration
 }
 
 type GetReservationRequest struct {
-	IngredientID string
+	Token string
+}
+
+type CommitReservationRequest struct {
+	Token string
+}
+
+type CancelReservationRequest struct {
+	Token string
+}
+
+// ListReservationsRequest filters reservations by order and status, empty fields match everything
+type ListReservationsRequest struct {
+	OrderID string
+	Status  Status
 }
 
-type DeleteReservationRequest struct {
-	IngredientID   string
-	DeleteQuantity int
+// Snapshot is the pending reservations & the levels of every ingredient on the ledger, at a single instant
+type Snapshot struct {
+	TakenAt time.Time
+	// Pending reservations in the order they were created
+	Pending []*Reservation
+	Levels  []resourcemanager.Levels
 }
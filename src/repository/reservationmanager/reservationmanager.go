@@ -2,69 +2,374 @@ package reservationmanager
 
 import (
 	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
 	"context"
+	"log"
 	"sync"
-	"time"
+
+	"github.com/gofrs/uuid"
 )
 
-// Repository allows us to perform CRUD operatins for reservations
-// TODO: implement TTL for unlocking reservations - in case some are pending for long time
+/*
+	Repository hands out reservations for whole orders on top of the inventory ledger.
+	Every reservation is referred to by its token, so a caller can only ever commit or cancel
+	the quantities it reserved itself.
+
+	Commit & Cancel are idempotent - committing a committed reservation, or cancelling a cancelled one is a no-op.
+	Closed reservations are kept, so that a repeated call still finds them.
+
+	A reservation with a TTL expires if it isn't committed in time - its ingredients are released,
+	and it can no longer be committed. Cancelling an expired reservation is a no-op.
+*/
 type Repository interface {
-	Create(ctx context.Context, request CreateReservationRequest) error
-	Get(ctx context.Context, request GetReservationRequest) (*entities.Ingredient, error)
-	Delete(ctx context.Context, request DeleteReservationRequest) error
+	// Create reserves all ingredients of the order, or none of them
+	Create(ctx context.Context, request CreateReservationRequest) (*Reservation, error)
+	Get(ctx context.Context, request GetReservationRequest) (*Reservation, error)
+	// Commit consumes the reserved ingredients
+	Commit(ctx context.Context, request CommitReservationRequest) error
+	// Cancel releases the reserved ingredients back to the inventory
+	Cancel(ctx context.Context, request CancelReservationRequest) error
+	// List returns matching reservations in the order they were created
+	List(ctx context.Context, request ListReservationsRequest) ([]*Reservation, error)
+	// Snapshot captures the pending reservations together with the levels of the ledger, see repositoryImpl.Snapshot
+	Snapshot(ctx context.Context) (*Snapshot, error)
+}
+
+/*
+	The mutex of a reservation serializes commit & cancel of the same token.
+	settled is the number of ingredients already committed or released on the ledger, so if the ledger fails
+	half way, a repeated commit or cancel continues from where the previous one stopped.
+*/
+type reservation struct {
+	mutex       sync.Mutex
+	reservation Reservation
+	settled     int
+	expiry      clock.Timer
 }
 
 /*
-	Current reservations are stored as a map[ingredient-id]reservedQuantity
-	To prevent concurrent writes to the map, we use read-write mutex
+	Reservations are stored as a map[token]reservation, along with the tokens of every order.
+	To prevent concurrent writes to the maps, we use read-write mutex.
+
+	Every operation working on the ledger read-locks operations for its whole duration, so that a snapshot
+	can write-lock it and see no reservation half way taken or settled.
 */
 type repositoryImpl struct {
+	ledger       resourcemanager.Repository
+	clock        clock.Clock
+	eventBus     eventbus.Bus
+	operations   sync.RWMutex
 	mutex        sync.RWMutex
-	reservations map[string]int
+	reservations map[string]*reservation
+	orders       map[string][]*reservation
+	created      []*reservation
 }
 
-func New() Repository {
-	return &repositoryImpl{
+type Option func(r *repositoryImpl)
+
+// WithClock replaces the wall clock, which is used for creating & expiring reservations
+func WithClock(c clock.Clock) Option {
+	return func(r *repositoryImpl) {
+		r.clock = c
+	}
+}
+
+// WithEventBus publishes reservations being taken & released to the bus
+func WithEventBus(bus eventbus.Bus) Option {
+	return func(r *repositoryImpl) {
+		r.eventBus = bus
+	}
+}
+
+func New(ledger resourcemanager.Repository, opts ...Option) Repository {
+	r := &repositoryImpl{
+		ledger:       ledger,
+		clock:        clock.New(),
 		mutex:        sync.RWMutex{},
-		reservations: make(map[string]int, 0),
+		reservations: make(map[string]*reservation, 0),
+		orders:       make(map[string][]*reservation, 0),
+		created:      make([]*reservation, 0),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *repositoryImpl) Create(ctx context.Context, request CreateReservationRequest) (*Reservation, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	token, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	r.operations.RLock()
+	res, created, err := r.reserve(ctx, token.String(), request)
+	r.operations.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	r.publish(eventbus.TypeReservationTaken, created, created.Ingredients)
+
+	if request.TTL > 0 {
+		// the timer may fire right away, so it is only set once the reservation can be found
+		res.mutex.Lock()
+		res.expiry = r.clock.AfterFunc(request.TTL, func() {
+			r.expire(res)
+		})
+		res.mutex.Unlock()
 	}
+	return created, nil
 }
 
-func (r *repositoryImpl) Create(ctx context.Context, request CreateReservationRequest) error {
-	time.Sleep(1 * time.Microsecond)
+// reserve reserves the ingredients on the ledger, and stores the reservation once all are reserved
+func (r *repositoryImpl) reserve(ctx context.Context, token string, request CreateReservationRequest) (*reservation, *Reservation, error) {
+	ingredients := append([]entities.Ingredient{}, request.Ingredients...)
+	for idx, ingredient := range ingredients {
+		reserveReq := resourcemanager.ReservationRequest{
+			IngredientID: ingredient.ID,
+			Quantity:     ingredient.Quantity,
+		}
+		if err := r.ledger.Reserve(ctx, reserveReq); err != nil {
+			// release what this order already reserved, so it reserves all or nothing
+			if releaseErr := r.release(ctx, ingredients[:idx]); releaseErr != nil {
+				return nil, nil, releaseErr
+			}
+			return nil, nil, err
+		}
+	}
+
+	res := &reservation{
+		reservation: Reservation{
+			Token:       token,
+			OrderID:     request.OrderID,
+			Ingredients: ingredients,
+			Status:      StatusPending,
+			CreatedAt:   r.clock.Now(),
+		},
+	}
+	if request.TTL > 0 {
+		res.reservation.ExpiresAt = res.reservation.CreatedAt.Add(request.TTL)
+	}
+	created := res.snapshot()
 
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	r.reservations[res.reservation.Token] = res
+	r.orders[request.OrderID] = append(r.orders[request.OrderID], res)
+	r.created = append(r.created, res)
+	r.mutex.Unlock()
+	return res, created, nil
+}
+
+// expire releases a reservation which wasn't committed within its TTL
+func (r *repositoryImpl) expire(res *reservation) {
+	r.operations.RLock()
+	defer r.operations.RUnlock()
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
 
-	r.reservations[request.IngredientID] += request.ReserveQuantity
+	if err := r.expireIfDue(context.Background(), res); err != nil {
+		log.Printf("failed to release expired reservation %s: %v", res.reservation.Token, err)
+	}
+}
+
+// expireIfDue must be called with the reservation locked
+func (r *repositoryImpl) expireIfDue(ctx context.Context, res *reservation) error {
+	if res.reservation.Status != StatusPending || res.reservation.ExpiresAt.IsZero() || r.clock.Now().Before(res.reservation.ExpiresAt) {
+		return nil
+	}
+	return r.settle(ctx, res, StatusExpired)
+}
+
+// settle releases the ingredients which aren't settled yet, and closes the reservation with the given status
+func (r *repositoryImpl) settle(ctx context.Context, res *reservation, status Status) error {
+	released := res.reservation.Ingredients[res.settled:]
+	for res.settled < len(res.reservation.Ingredients) {
+		if err := r.release(ctx, res.reservation.Ingredients[res.settled:res.settled+1]); err != nil {
+			return err
+		}
+		res.settled += 1
+	}
+	res.reservation.Status = status
+	if res.expiry != nil {
+		res.expiry.Stop()
+	}
+	r.publish(eventbus.TypeReservationReleased, &res.reservation, released)
 	return nil
 }
 
-func (r *repositoryImpl) Get(ctx context.Context, request GetReservationRequest) (*entities.Ingredient, error) {
-	time.Sleep(1 * time.Microsecond)
+func (r *repositoryImpl) publish(eventType eventbus.Type, res *Reservation, ingredients []entities.Ingredient) {
+	if r.eventBus == nil {
+		return
+	}
+	r.eventBus.Publish(eventbus.Event{
+		Type:        eventType,
+		At:          r.clock.Now(),
+		OrderID:     res.OrderID,
+		Token:       res.Token,
+		Ingredients: append([]entities.Ingredient{}, ingredients...),
+	})
+}
 
+func (r *repositoryImpl) release(ctx context.Context, ingredients []entities.Ingredient) error {
+	for _, ingredient := range ingredients {
+		releaseReq := resourcemanager.ReservationRequest{
+			IngredientID: ingredient.ID,
+			Quantity:     ingredient.Quantity,
+		}
+		if err := r.ledger.Release(ctx, releaseReq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repositoryImpl) get(token string) (*reservation, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	return &entities.Ingredient{
-		ID:       request.IngredientID,
-		Quantity: r.reservations[request.IngredientID],
-	}, nil
+	res, ok := r.reservations[token]
+	if !ok {
+		return nil, entities.ErrReservationNotFound{Token: token}
+	}
+	return res, nil
 }
 
-func (r *repositoryImpl) Delete(ctx context.Context, request DeleteReservationRequest) error {
-	time.Sleep(1 * time.Microsecond)
+func (res *reservation) snapshot() *Reservation {
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
 
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	snapshot := res.reservation
+	snapshot.Ingredients = append([]entities.Ingredient{}, res.reservation.Ingredients...)
+	if res.reservation.Lots != nil {
+		snapshot.Lots = append([]entities.LotUsage{}, res.reservation.Lots...)
+	}
+	return &snapshot
+}
 
-	curVal := r.reservations[request.IngredientID]
-	if request.DeleteQuantity > curVal {
-		return entities.ErrInsufficientResource{
-			ResourceID: request.IngredientID,
+func (r *repositoryImpl) Get(ctx context.Context, request GetReservationRequest) (*Reservation, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	res, err := r.get(request.Token)
+	if err != nil {
+		return nil, err
+	}
+	return res.snapshot(), nil
+}
+
+func (r *repositoryImpl) Commit(ctx context.Context, request CommitReservationRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	res, err := r.get(request.Token)
+	if err != nil {
+		return err
+	}
+
+	r.operations.RLock()
+	defer r.operations.RUnlock()
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
+
+	// the expiry timer might not have fired yet
+	if err := r.expireIfDue(ctx, res); err != nil {
+		return err
+	}
+	switch res.reservation.Status {
+	case StatusCommitted:
+		return nil
+	case StatusCancelled, StatusExpired:
+		return entities.ErrReservationClosed{Token: request.Token, Status: string(res.reservation.Status)}
+	}
+
+	for res.settled < len(res.reservation.Ingredients) {
+		ingredient := res.reservation.Ingredients[res.settled]
+		commitReq := resourcemanager.ReservationRequest{
+			IngredientID: ingredient.ID,
+			Quantity:     ingredient.Quantity,
 		}
+		consumption, err := r.ledger.Commit(ctx, commitReq)
+		if err != nil {
+			return err
+		}
+		res.reservation.Lots = append(res.reservation.Lots, consumption.Lots...)
+		res.settled += 1
+	}
+	res.reservation.Status = StatusCommitted
+	if res.expiry != nil {
+		res.expiry.Stop()
 	}
-	r.reservations[request.IngredientID] -= request.DeleteQuantity
 	return nil
 }
+
+func (r *repositoryImpl) Cancel(ctx context.Context, request CancelReservationRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	res, err := r.get(request.Token)
+	if err != nil {
+		return err
+	}
+
+	r.operations.RLock()
+	defer r.operations.RUnlock()
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
+
+	switch res.reservation.Status {
+	case StatusCancelled, StatusExpired:
+		return nil
+	case StatusCommitted:
+		return entities.ErrReservationClosed{Token: request.Token, Status: string(res.reservation.Status)}
+	}
+	return r.settle(ctx, res, StatusCancelled)
+}
+
+func (r *repositoryImpl) List(ctx context.Context, request ListReservationsRequest) ([]*Reservation, error) {
+	r.mutex.RLock()
+	candidates := r.created
+	if request.OrderID != "" {
+		candidates = r.orders[request.OrderID]
+	}
+	candidates = append([]*reservation{}, candidates...)
+	r.mutex.RUnlock()
+
+	reservations := make([]*Reservation, 0)
+	for _, res := range candidates {
+		snapshot := res.snapshot()
+		if request.Status != "" && snapshot.Status != request.Status {
+			continue
+		}
+		reservations = append(reservations, snapshot)
+	}
+	return reservations, nil
+}
+
+/*
+	Snapshot holds off every operation on the ledger while it lists the pending reservations & takes a snapshot of
+	the ledger. So every reservation was either taken & settled in full, or not at all - and the quantities reserved
+	on the ledger add up to the pending reservations, unless others reserve on the same ledger directly.
+*/
+func (r *repositoryImpl) Snapshot(ctx context.Context) (*Snapshot, error) {
+	r.operations.Lock()
+	defer r.operations.Unlock()
+
+	pending, err := r.List(ctx, ListReservationsRequest{Status: StatusPending})
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := r.ledger.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		TakenAt: ledger.TakenAt,
+		Pending: pending,
+		Levels:  ledger.Levels,
+	}, nil
+}
@@ -2,13 +2,47 @@ package reservationmanager
 
 import (
 	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
 	"context"
-	"github.com/stretchr/testify/assert"
-	"log"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	_OrderID = "order1234"
+	_Milk    = "milk"
+	_Water   = "water"
 )
 
+// newLedger returns a ledger holding the given quantities, with nothing reserved
+func newLedger(quantities map[string]int) resourcemanager.Repository {
+	ledger := resourcemanager.New()
+	for ingredientID, quantity := range quantities {
+		updateReq := resourcemanager.UpdateRequest{
+			IngredientID:     ingredientID,
+			UpdateType:       resourcemanager.UpdateTypeRefill,
+			ResourceQuantity: quantity,
+		}
+		if _, err := ledger.UpdateIngredient(context.Background(), updateReq); err != nil {
+			panic(err)
+		}
+	}
+	return ledger
+}
+
+func levels(ledger resourcemanager.Repository, ingredientID string) *resourcemanager.Levels {
+	got, err := ledger.GetLevels(context.Background(), resourcemanager.GetRequest{IngredientID: ingredientID})
+	if err != nil {
+		panic(err)
+	}
+	return got
+}
+
 func TestNew(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -20,13 +54,15 @@ func TestNew(t *testing.T) {
 				assert.NotNil(t, r)
 				assert.IsType(t, r, &repositoryImpl{})
 				concreteImpl := r.(*repositoryImpl)
+				assert.NotNil(t, concreteImpl.ledger)
 				assert.NotNil(t, concreteImpl.reservations)
+				assert.NotNil(t, concreteImpl.orders)
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := New()
+			got := New(resourcemanager.New())
 			tt.assert(got)
 		})
 	}
@@ -35,155 +71,438 @@ func TestNew(t *testing.T) {
 func Test_repositoryImpl_Create(t *testing.T) {
 	ctx := context.Background()
 
-	type fields struct {
-		mutex        sync.RWMutex
-		reservations map[string]int
+	tests := []struct {
+		name       string
+		quantities map[string]int
+		request    CreateReservationRequest
+		assert     func(ledger resourcemanager.Repository, got *Reservation, err error)
+	}{
+		{
+			name:       "success | all ingredients reserved",
+			quantities: map[string]int{_Milk: 10, _Water: 10},
+			request: CreateReservationRequest{
+				OrderID:     _OrderID,
+				Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 4}, {ID: _Water, Quantity: 6}},
+			},
+			assert: func(ledger resourcemanager.Repository, got *Reservation, err error) {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, got.Token)
+				assert.Equal(t, _OrderID, got.OrderID)
+				assert.Equal(t, StatusPending, got.Status)
+				assert.Equal(t, 4, levels(ledger, _Milk).Reserved)
+				assert.Equal(t, 6, levels(ledger, _Water).Reserved)
+			},
+		},
+		{
+			name:       "error | insufficient ingredient, nothing stays reserved",
+			quantities: map[string]int{_Milk: 10, _Water: 5},
+			request: CreateReservationRequest{
+				OrderID:     _OrderID,
+				Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 4}, {ID: _Water, Quantity: 6}},
+			},
+			assert: func(ledger resourcemanager.Repository, got *Reservation, err error) {
+				assert.IsType(t, entities.ErrInsufficientResource{}, err)
+				assert.Nil(t, got)
+				assert.Equal(t, 0, levels(ledger, _Milk).Reserved)
+				assert.Equal(t, 0, levels(ledger, _Water).Reserved)
+			},
+		},
+		{
+			name:       "error | unknown ingredient",
+			quantities: map[string]int{_Milk: 10},
+			request: CreateReservationRequest{
+				OrderID:     _OrderID,
+				Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 4}, {ID: _Water, Quantity: 6}},
+			},
+			assert: func(ledger resourcemanager.Repository, got *Reservation, err error) {
+				assert.IsType(t, entities.ErrResourceNotAvailable{}, err)
+				assert.Equal(t, 0, levels(ledger, _Milk).Reserved)
+			},
+		},
 	}
-	type args struct {
-		ctx     context.Context
-		request CreateReservationRequest
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger(tt.quantities)
+			r := New(ledger)
+			got, err := r.Create(ctx, tt.request)
+			tt.assert(ledger, got, err)
+		})
 	}
+}
+
+func Test_repositoryImpl_CommitAndCancel(t *testing.T) {
+	ctx := context.Background()
 
-	const _IngredientID = "1234"
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr bool
+		name   string
+		action func(r Repository, token string) error
+		assert func(ledger resourcemanager.Repository, r Repository, token string, err error)
 	}{
 		{
-			name: "success",
-			args: args{
-				ctx: ctx,
-				request: CreateReservationRequest{
-					IngredientID:    _IngredientID,
-					ReserveQuantity: 5,
-				},
+			name: "success | commit consumes the reservation",
+			action: func(r Repository, token string) error {
+				return r.Commit(ctx, CommitReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: _Milk, OnHand: 6, Reserved: 0, Available: 6}, levels(ledger, _Milk))
+				got, _ := r.Get(ctx, GetReservationRequest{Token: token})
+				assert.Equal(t, StatusCommitted, got.Status)
+			},
+		},
+		{
+			name: "success | commit is idempotent",
+			action: func(r Repository, token string) error {
+				if err := r.Commit(ctx, CommitReservationRequest{Token: token}); err != nil {
+					return err
+				}
+				return r.Commit(ctx, CommitReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 6, levels(ledger, _Milk).OnHand)
+			},
+		},
+		{
+			name: "success | cancel releases the reservation",
+			action: func(r Repository, token string) error {
+				return r.Cancel(ctx, CancelReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: _Milk, OnHand: 10, Reserved: 0, Available: 10}, levels(ledger, _Milk))
+				got, _ := r.Get(ctx, GetReservationRequest{Token: token})
+				assert.Equal(t, StatusCancelled, got.Status)
+			},
+		},
+		{
+			name: "success | cancel is idempotent",
+			action: func(r Repository, token string) error {
+				if err := r.Cancel(ctx, CancelReservationRequest{Token: token}); err != nil {
+					return err
+				}
+				return r.Cancel(ctx, CancelReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 0, levels(ledger, _Milk).Reserved)
+			},
+		},
+		{
+			name: "error | commit a cancelled reservation",
+			action: func(r Repository, token string) error {
+				if err := r.Cancel(ctx, CancelReservationRequest{Token: token}); err != nil {
+					return err
+				}
+				return r.Commit(ctx, CommitReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.Equal(t, entities.ErrReservationClosed{Token: token, Status: string(StatusCancelled)}, err)
+				assert.Equal(t, 10, levels(ledger, _Milk).OnHand)
+			},
+		},
+		{
+			name: "error | cancel a committed reservation",
+			action: func(r Repository, token string) error {
+				if err := r.Commit(ctx, CommitReservationRequest{Token: token}); err != nil {
+					return err
+				}
+				return r.Cancel(ctx, CancelReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.Equal(t, entities.ErrReservationClosed{Token: token, Status: string(StatusCommitted)}, err)
+				assert.Equal(t, 6, levels(ledger, _Milk).OnHand)
+			},
+		},
+		{
+			name: "error | unknown token",
+			action: func(r Repository, token string) error {
+				return r.Commit(ctx, CommitReservationRequest{Token: "unknown"})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.Equal(t, entities.ErrReservationNotFound{Token: "unknown"}, err)
+				assert.Equal(t, 4, levels(ledger, _Milk).Reserved)
 			},
-			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := New()
-			if err := r.Create(tt.args.ctx, tt.args.request); (err != nil) != tt.wantErr {
-				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			ledger := newLedger(map[string]int{_Milk: 10})
+			r := New(ledger)
+			created, err := r.Create(ctx, CreateReservationRequest{
+				OrderID:     _OrderID,
+				Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 4}},
+			})
+			if err != nil {
+				panic(err)
 			}
+
+			err = tt.action(r, created.Token)
+			tt.assert(ledger, r, created.Token, err)
 		})
 	}
 }
 
-func Test_repositoryImpl_Delete(t *testing.T) {
+func Test_repositoryImpl_Expiry(t *testing.T) {
 	ctx := context.Background()
 
-	type args struct {
-		ctx     context.Context
-		request DeleteReservationRequest
-	}
-
-	const _IngredientID = "1234"
 	tests := []struct {
-		name           string
-		args           args
-		initQuantities []entities.Ingredient
-		assert         func(err error)
+		name   string
+		action func(c *clock.Fake, r Repository, token string) error
+		assert func(ledger resourcemanager.Repository, r Repository, token string, err error)
 	}{
 		{
-			name: "error - not present quantity",
-			args: args{
-				ctx: ctx,
-				request: DeleteReservationRequest{
-					IngredientID:   _IngredientID,
-					DeleteQuantity: 10,
-				},
+			name: "success | pending within the TTL",
+			action: func(c *clock.Fake, r Repository, token string) error {
+				c.Advance(4 * time.Minute)
+				return nil
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				got, _ := r.Get(ctx, GetReservationRequest{Token: token})
+				assert.Equal(t, StatusPending, got.Status)
+				assert.Equal(t, 4, levels(ledger, _Milk).Reserved)
+			},
+		},
+		{
+			name: "success | released once the TTL passes",
+			action: func(c *clock.Fake, r Repository, token string) error {
+				c.Advance(5 * time.Minute)
+				return nil
 			},
-			assert: func(err error) {
-				assert.Error(t, err)
-				assert.IsType(t, err, entities.ErrInsufficientResource{})
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				got, _ := r.Get(ctx, GetReservationRequest{Token: token})
+				assert.Equal(t, StatusExpired, got.Status)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: _Milk, OnHand: 10, Reserved: 0, Available: 10}, levels(ledger, _Milk))
 			},
 		},
 		{
-			name: "success - already present quantity",
-			args: args{
-				ctx: ctx,
-				request: DeleteReservationRequest{
-					IngredientID:   _IngredientID,
-					DeleteQuantity: 10,
-				},
+			name: "success | committed within the TTL never expires",
+			action: func(c *clock.Fake, r Repository, token string) error {
+				c.Advance(4 * time.Minute)
+				err := r.Commit(ctx, CommitReservationRequest{Token: token})
+				c.Advance(time.Hour)
+				return err
 			},
-			initQuantities: []entities.Ingredient{
-				{ID: _IngredientID, Quantity: 20},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.NoError(t, err)
+				got, _ := r.Get(ctx, GetReservationRequest{Token: token})
+				assert.Equal(t, StatusCommitted, got.Status)
+				assert.Equal(t, 6, levels(ledger, _Milk).OnHand)
+			},
+		},
+		{
+			name: "error | commit an expired reservation",
+			action: func(c *clock.Fake, r Repository, token string) error {
+				c.Advance(5 * time.Minute)
+				return r.Commit(ctx, CommitReservationRequest{Token: token})
+			},
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
+				assert.Equal(t, entities.ErrReservationClosed{Token: token, Status: string(StatusExpired)}, err)
+				assert.Equal(t, 10, levels(ledger, _Milk).OnHand)
+			},
+		},
+		{
+			name: "success | cancel an expired reservation",
+			action: func(c *clock.Fake, r Repository, token string) error {
+				c.Advance(5 * time.Minute)
+				return r.Cancel(ctx, CancelReservationRequest{Token: token})
 			},
-			assert: func(err error) {
+			assert: func(ledger resourcemanager.Repository, r Repository, token string, err error) {
 				assert.NoError(t, err)
+				assert.Equal(t, 0, levels(ledger, _Milk).Reserved)
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := New()
-			for _, ing := range tt.initQuantities {
-				createReq := CreateReservationRequest{
-					IngredientID:    ing.ID,
-					ReserveQuantity: ing.Quantity,
-				}
-				err := r.Create(ctx, createReq)
-				if err != nil {
-					log.Fatal(err)
-				}
+			c := clock.NewFake(time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC))
+			ledger := newLedger(map[string]int{_Milk: 10})
+			r := New(ledger, WithClock(c))
+			created, err := r.Create(ctx, CreateReservationRequest{
+				OrderID:     _OrderID,
+				Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 4}},
+				TTL:         5 * time.Minute,
+			})
+			if err != nil {
+				panic(err)
 			}
-			err := r.Delete(tt.args.ctx, tt.args.request)
-			tt.assert(err)
+			assert.Equal(t, c.Now().Add(5*time.Minute), created.ExpiresAt)
+
+			err = tt.action(c, r, created.Token)
+			tt.assert(ledger, r, created.Token, err)
 		})
 	}
 }
 
-func Test_repositoryImpl_Get(t *testing.T) {
+func Test_repositoryImpl_List(t *testing.T) {
 	ctx := context.Background()
 
-	type fields struct {
-		mutex        sync.RWMutex
-		reservations map[string]int
+	r := New(newLedger(map[string]int{_Milk: 100}))
+	tokens := make(map[string][]string, 0)
+	for _, orderID := range []string{"order1", "order2", "order1"} {
+		created, err := r.Create(ctx, CreateReservationRequest{
+			OrderID:     orderID,
+			Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 1}},
+		})
+		if err != nil {
+			panic(err)
+		}
+		tokens[orderID] = append(tokens[orderID], created.Token)
 	}
-	type args struct {
-		ctx     context.Context
-		request GetReservationRequest
+	if err := r.Commit(ctx, CommitReservationRequest{Token: tokens["order1"][0]}); err != nil {
+		panic(err)
 	}
 
-	const _IngredientID = "1234"
+	listTokens := func(reservations []*Reservation) []string {
+		got := make([]string, 0)
+		for _, res := range reservations {
+			got = append(got, res.Token)
+		}
+		return got
+	}
 
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		assert func(ing *entities.Ingredient, err error)
+		name    string
+		request ListReservationsRequest
+		want    []string
 	}{
 		{
-			name: "success",
-			fields: fields{
-				mutex:        sync.RWMutex{},
-				reservations: make(map[string]int, 0),
-			},
-			args: args{
-				ctx: ctx,
-				request: GetReservationRequest{
-					IngredientID: _IngredientID,
-				},
-			},
-			assert: func(ing *entities.Ingredient, err error) {
-				assert.NoError(t, err)
-				assert.NotNil(t, ing)
-			},
+			name:    "success | all reservations of an order",
+			request: ListReservationsRequest{OrderID: "order1"},
+			want:    tokens["order1"],
+		},
+		{
+			name:    "success | outstanding reservations of an order",
+			request: ListReservationsRequest{OrderID: "order1", Status: StatusPending},
+			want:    tokens["order1"][1:],
+		},
+		{
+			name:    "success | outstanding reservations of all orders",
+			request: ListReservationsRequest{Status: StatusPending},
+			want:    []string{tokens["order2"][0], tokens["order1"][1]},
+		},
+		{
+			name:    "success | unknown order",
+			request: ListReservationsRequest{OrderID: "unknown"},
+			want:    []string{},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := &repositoryImpl{
-				mutex:        tt.fields.mutex,
-				reservations: tt.fields.reservations,
+			got, err := r.List(ctx, tt.request)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, listTokens(got))
+		})
+	}
+}
+
+func Test_repositoryImpl_ConcurrentCommitAndCancel(t *testing.T) {
+	ctx := context.Background()
+
+	ledger := newLedger(map[string]int{_Milk: 100})
+	r := New(ledger)
+	created, err := r.Create(ctx, CreateReservationRequest{
+		OrderID:     _OrderID,
+		Ingredients: []entities.Ingredient{{ID: _Milk, Quantity: 10}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// whichever wins, the reservation is settled exactly once
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = r.Commit(ctx, CommitReservationRequest{Token: created.Token})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = r.Cancel(ctx, CancelReservationRequest{Token: created.Token})
+		}()
+	}
+	wg.Wait()
+
+	got, _ := r.Get(ctx, GetReservationRequest{Token: created.Token})
+	want := map[Status]int{StatusCommitted: 90, StatusCancelled: 100}
+	assert.Equal(t, want[got.Status], levels(ledger, _Milk).OnHand)
+	assert.Equal(t, 0, levels(ledger, _Milk).Reserved)
+}
+
+func Test_repositoryImpl_Snapshot(t *testing.T) {
+	ctx := context.Background()
+
+	ledger := newLedger(map[string]int{_Milk: 1000, _Water: 1000})
+	r := New(ledger)
+	ingredients := []entities.Ingredient{{ID: _Milk, Quantity: 1}, {ID: _Water, Quantity: 2}}
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				created, err := r.Create(ctx, CreateReservationRequest{OrderID: _OrderID, Ingredients: ingredients})
+				if err != nil {
+					continue
+				}
+				if i%2 == 0 {
+					_ = r.Commit(ctx, CommitReservationRequest{Token: created.Token})
+				}
+			}
+		}(i)
+	}
+
+	// no reservation is ever seen half way taken or settled, so the ledger always adds up
+	for i := 0; i < 50; i++ {
+		snapshot, err := r.Snapshot(ctx)
+		assert.NoError(t, err)
+		reserved := map[string]int{}
+		for _, res := range snapshot.Pending {
+			assert.Equal(t, StatusPending, res.Status)
+			for _, ingredient := range res.Ingredients {
+				reserved[ingredient.ID] += ingredient.Quantity
 			}
-			got, err := r.Get(tt.args.ctx, tt.args.request)
-			tt.assert(got, err)
+		}
+		for _, got := range snapshot.Levels {
+			assert.Equal(t, reserved[got.IngredientID], got.Reserved)
+			assert.Equal(t, got.OnHand-got.Reserved, got.Available)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkRepository_CreateAndCommit(b *testing.B) {
+	ctx := context.Background()
+
+	for _, numOfIngredients := range []int{1, 16} {
+		b.Run(strconv.Itoa(numOfIngredients)+"_ingredients", func(b *testing.B) {
+			quantities := make(map[string]int, numOfIngredients)
+			ingredients := make([]entities.Ingredient, numOfIngredients)
+			for idx := range ingredients {
+				ingredients[idx] = entities.Ingredient{ID: "ingredient" + strconv.Itoa(idx), Quantity: 1}
+				quantities[ingredients[idx].ID] = 1 << 30
+			}
+			r := New(newLedger(quantities))
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					created, err := r.Create(ctx, CreateReservationRequest{OrderID: _OrderID, Ingredients: ingredients})
+					if err != nil {
+						continue
+					}
+					_ = r.Commit(ctx, CommitReservationRequest{Token: created.Token})
+				}
+			})
 		})
 	}
 }
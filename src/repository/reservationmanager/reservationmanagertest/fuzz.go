@@ -0,0 +1,117 @@
+package reservationmanagertest
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/repository/resourcemanager/resourcemanagertest"
+	"coffeeMachine/src/services/clock"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+	Fuzz feeds repositories of the factory random orders, commits, cancels & refills - and checks after each one
+	that no level is negative, the ledger reserves exactly what the pending reservations hold, and invalid requests
+	fail with the error of their Validate and change nothing.
+
+	Every request is 3 bytes - the operation and two arguments: the signed quantities of milk & water for an order
+	[ 127 stands for MaxQuantity + 1 ], or which reservation to commit or cancel - an empty token past the last one.
+*/
+func Fuzz(f *testing.F, factory Factory) {
+	f.Add([]byte{0, 30, 20, 1, 0, 0, 0, 10, 10, 2, 1, 0})
+	f.Add([]byte{0, 30, 0xec, 0, 0, 5, 0, 127, 1, 1, 9, 0})
+	f.Add([]byte{0, 90, 40, 0, 20, 20, 3, 50, 0, 0, 20, 5, 2, 0, 0, 4, 0, 0})
+
+	f.Fuzz(func(t *testing.T, requests []byte) {
+		ctx := context.Background()
+		ledger, r := newRepositories(t, factory, clock.NewFake(resourcemanagertest.Start), nil)
+		tokens := make([]string, 0)
+		token := func(b byte) string {
+			if idx := int(b) % (len(tokens) + 1); idx < len(tokens) {
+				return tokens[idx]
+			}
+			return ""
+		}
+
+		for i := 0; i+3 <= len(requests); i += 3 {
+			before := snapshot(t, r)
+			var err, validateErr error
+			switch requests[i] % 5 {
+			case 0:
+				request := reservationmanager.CreateReservationRequest{
+					OrderID: "order",
+					Ingredients: []entities.Ingredient{
+						{ID: "milk", Quantity: fuzzQuantity(requests[i+1])},
+						{ID: "water", Quantity: fuzzQuantity(requests[i+2])},
+					},
+				}
+				validateErr = request.Validate()
+				var created *reservationmanager.Reservation
+				if created, err = r.Create(ctx, request); err == nil {
+					tokens = append(tokens, created.Token)
+				}
+			case 1:
+				request := reservationmanager.CommitReservationRequest{Token: token(requests[i+1])}
+				validateErr, err = request.Validate(), r.Commit(ctx, request)
+			case 2:
+				request := reservationmanager.CancelReservationRequest{Token: token(requests[i+1])}
+				validateErr, err = request.Validate(), r.Cancel(ctx, request)
+			case 3:
+				updateReq := resourcemanager.UpdateRequest{
+					IngredientID:     "milk",
+					UpdateType:       resourcemanager.UpdateTypeRefill,
+					ResourceQuantity: fuzzQuantity(requests[i+1]),
+				}
+				validateErr = updateReq.Validate()
+				_, err = ledger.UpdateIngredient(ctx, updateReq)
+			case 4:
+				request := reservationmanager.GetReservationRequest{Token: token(requests[i+1])}
+				validateErr = request.Validate()
+				_, err = r.Get(ctx, request)
+			}
+
+			after := snapshot(t, r)
+			if validateErr != nil {
+				if !assert.Equal(t, validateErr, err) || !assert.Equal(t, before, after) {
+					return
+				}
+			}
+			if !assertHeld(t, after) {
+				return
+			}
+		}
+	})
+}
+
+func fuzzQuantity(b byte) int {
+	if quantity := int(int8(b)); quantity != 127 {
+		return quantity
+	}
+	return resourcemanager.MaxQuantity + 1
+}
+
+func snapshot(t *testing.T, r reservationmanager.Repository) *reservationmanager.Snapshot {
+	got, err := r.Snapshot(context.Background())
+	assert.NoError(t, err)
+	return got
+}
+
+// assertHeld checks that the ledger reserves exactly what the pending reservations of the snapshot hold
+func assertHeld(t *testing.T, snapshot *reservationmanager.Snapshot) bool {
+	held := make(map[string]int)
+	for _, res := range snapshot.Pending {
+		for _, ingredient := range res.Ingredients {
+			held[ingredient.ID] += ingredient.Quantity
+		}
+	}
+	for _, levels := range snapshot.Levels {
+		if !assert.True(t, levels.OnHand >= 0 && levels.Reserved <= levels.OnHand, "%+v", levels) ||
+			!assert.Equal(t, held[levels.IngredientID], levels.Reserved, levels.IngredientID) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,443 @@
+/*
+	Package reservationmanagertest is the conformance suite of reservationmanager.Repository, as resourcemanagertest
+	is for the ledger - any implementation runs it with the ledger its reservations are taken on.
+*/
+package reservationmanagertest
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/repository/resourcemanager/resourcemanagertest"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns empty reservations on the given clock & the ledger they're taken on, publishing to the bus - which may be nil
+type Factory func(t *testing.T, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository)
+
+// Run runs every test of the suite on repositories of the factory, with 100 milk & 50 water on the ledger
+func Run(t *testing.T, factory Factory) {
+	t.Run("Reservations", func(t *testing.T) { testReservations(t, factory) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, factory) })
+	t.Run("Validation", func(t *testing.T) { testValidation(t, factory) })
+	t.Run("ConcurrentOrders", func(t *testing.T) { testConcurrentOrders(t, factory) })
+	t.Run("ConcurrentCommitAndCancel", func(t *testing.T) { testConcurrentCommitAndCancel(t, factory) })
+	t.Run("ConcurrentSnapshots", func(t *testing.T) { testConcurrentSnapshots(t, factory) })
+}
+
+func newRepositories(t *testing.T, factory Factory, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository) {
+	ledger, r := factory(t, clk, bus)
+	resourcemanagertest.Refill(ledger, "milk", 100)
+	resourcemanagertest.Refill(ledger, "water", 50)
+	return ledger, r
+}
+
+func testReservations(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	start := resourcemanagertest.Start
+	order := []entities.Ingredient{{ID: "milk", Quantity: 30}, {ID: "water", Quantity: 20}}
+	levels := resourcemanagertest.GetLevels
+
+	tests := []struct {
+		name   string
+		assert func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake)
+	}{
+		{
+			name: "success | committed once",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: order})
+				assert.NoError(t, err)
+				assert.NoError(t, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}))
+				assert.NoError(t, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}))
+				assert.Equal(t,
+					entities.ErrReservationClosed{Token: created.Token, Status: string(reservationmanager.StatusCommitted)},
+					r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token}),
+				)
+
+				got, err := r.Get(ctx, reservationmanager.GetReservationRequest{Token: created.Token})
+				assert.NoError(t, err)
+				assert.Equal(t, &reservationmanager.Reservation{
+					Token:       created.Token,
+					OrderID:     "order1",
+					Ingredients: order,
+					Status:      reservationmanager.StatusCommitted,
+					CreatedAt:   start,
+				}, got)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk", OnHand: 70, Available: 70}, levels(ledger, "milk"))
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "water", OnHand: 30, Available: 30}, levels(ledger, "water"))
+			},
+		},
+		{
+			name: "success | cancelled once",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: order})
+				assert.NoError(t, err)
+				assert.Equal(t, 30, levels(ledger, "milk").Reserved)
+				assert.NoError(t, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token}))
+				assert.NoError(t, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token}))
+				assert.Equal(t,
+					entities.ErrReservationClosed{Token: created.Token, Status: string(reservationmanager.StatusCancelled)},
+					r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}),
+				)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Available: 100}, levels(ledger, "milk"))
+			},
+		},
+		{
+			name: "success | lots the order was served from",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				_, err := ledger.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+					IngredientID: "water", UpdateType: resourcemanager.UpdateTypeRefill, ResourceQuantity: 50, LotID: "W1",
+				})
+				assert.NoError(t, err)
+				created, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{
+					OrderID:     "order1",
+					Ingredients: []entities.Ingredient{{ID: "water", Quantity: 80}},
+				})
+				assert.NoError(t, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}))
+
+				got, err := r.Get(ctx, reservationmanager.GetReservationRequest{Token: created.Token})
+				assert.NoError(t, err)
+				assert.Equal(t, []entities.LotUsage{{IngredientID: "water", LotID: "W1", Quantity: 30}}, got.Lots)
+			},
+		},
+		{
+			name: "success | expired unless committed in time",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: order, TTL: time.Minute})
+				assert.NoError(t, err)
+				assert.Equal(t, start.Add(time.Minute), created.ExpiresAt)
+				assert.Equal(t, 30, levels(ledger, "milk").Reserved)
+
+				clk.Advance(time.Minute)
+				assert.Equal(t, 0, levels(ledger, "milk").Reserved)
+				assert.Equal(t,
+					entities.ErrReservationClosed{Token: created.Token, Status: string(reservationmanager.StatusExpired)},
+					r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}),
+				)
+				assert.NoError(t, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token}))
+			},
+		},
+		{
+			name: "success | committed within the TTL",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				created, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: order, TTL: time.Minute})
+				clk.Advance(time.Second)
+				assert.NoError(t, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}))
+
+				clk.Advance(time.Minute)
+				got, err := r.Get(ctx, reservationmanager.GetReservationRequest{Token: created.Token})
+				assert.NoError(t, err)
+				assert.Equal(t, reservationmanager.StatusCommitted, got.Status)
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk", OnHand: 70, Available: 70}, levels(ledger, "milk"))
+			},
+		},
+		{
+			name: "success | listed & snapshot",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				first, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: order})
+				second, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order2", Ingredients: order})
+				assert.NoError(t, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: first.Token}))
+
+				listed, err := r.List(ctx, reservationmanager.ListReservationsRequest{Status: reservationmanager.StatusPending})
+				assert.NoError(t, err)
+				assert.Equal(t, []*reservationmanager.Reservation{second}, listed)
+				listed, err = r.List(ctx, reservationmanager.ListReservationsRequest{OrderID: "order1"})
+				assert.NoError(t, err)
+				assert.Equal(t, 1, len(listed))
+				assert.Equal(t, reservationmanager.StatusCancelled, listed[0].Status)
+
+				snapshot, err := r.Snapshot(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, &reservationmanager.Snapshot{
+					TakenAt: start,
+					Pending: []*reservationmanager.Reservation{second},
+					Levels: []resourcemanager.Levels{
+						{IngredientID: "milk", OnHand: 100, Reserved: 30, Available: 70},
+						{IngredientID: "water", OnHand: 50, Reserved: 20, Available: 30},
+					},
+				}, snapshot)
+			},
+		},
+		{
+			name: "error | nothing reserved unless everything is",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				_, err := r.Create(ctx, reservationmanager.CreateReservationRequest{
+					OrderID:     "order1",
+					Ingredients: []entities.Ingredient{{ID: "milk", Quantity: 30}, {ID: "water", Quantity: 60}},
+				})
+				assert.Equal(t, entities.ErrInsufficientResource{ResourceID: "water"}, err)
+				assert.Equal(t, 0, levels(ledger, "milk").Reserved)
+
+				listed, err := r.List(ctx, reservationmanager.ListReservationsRequest{})
+				assert.NoError(t, err)
+				assert.Empty(t, listed)
+			},
+		},
+		{
+			name: "error | unknown token",
+			assert: func(t *testing.T, ledger resourcemanager.Repository, r reservationmanager.Repository, clk *clock.Fake) {
+				notFound := entities.ErrReservationNotFound{Token: "nope"}
+				_, err := r.Get(ctx, reservationmanager.GetReservationRequest{Token: "nope"})
+				assert.Equal(t, notFound, err)
+				assert.Equal(t, notFound, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: "nope"}))
+				assert.Equal(t, notFound, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: "nope"}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			ledger, r := newRepositories(t, factory, clk, nil)
+			tt.assert(t, ledger, r, clk)
+		})
+	}
+}
+
+func testEvents(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	clk := clock.NewFake(resourcemanagertest.Start)
+	bus := eventbus.New()
+	_, r := newRepositories(t, factory, clk, bus)
+
+	got := make([]eventbus.Event, 0)
+	bus.Subscribe(func(event eventbus.Event) {
+		// tokens are random
+		event.Token = ""
+		got = append(got, event)
+	}, eventbus.Types(eventbus.TypeReservationTaken, eventbus.TypeReservationReleased))
+
+	milk := []entities.Ingredient{{ID: "milk", Quantity: 10}}
+	committed, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: milk})
+	assert.NoError(t, r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: committed.Token}))
+	cancelled, _ := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order2", Ingredients: milk})
+	assert.NoError(t, r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: cancelled.Token}))
+	_, _ = r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order3", Ingredients: milk, TTL: time.Minute})
+	clk.Advance(time.Minute)
+
+	at := resourcemanagertest.Start
+	assert.Equal(t, []eventbus.Event{
+		{Type: eventbus.TypeReservationTaken, At: at, OrderID: "order1", Ingredients: milk},
+		{Type: eventbus.TypeReservationTaken, At: at, OrderID: "order2", Ingredients: milk},
+		{Type: eventbus.TypeReservationReleased, At: at, OrderID: "order2", Ingredients: milk},
+		{Type: eventbus.TypeReservationTaken, At: at, OrderID: "order3", Ingredients: milk},
+		{Type: eventbus.TypeReservationReleased, At: at.Add(time.Minute), OrderID: "order3", Ingredients: milk},
+	}, got)
+}
+
+// testNegativeQuantities checks that whatever an order with a negative quantity does, no level goes below zero
+// testValidation checks that invalid requests fail with their typed error, before anything is reserved
+func testValidation(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	create := func(r reservationmanager.Repository, ingredients ...entities.Ingredient) error {
+		_, err := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order1", Ingredients: ingredients})
+		return err
+	}
+	milk := entities.Ingredient{ID: "milk", Quantity: 30}
+
+	tests := []struct {
+		name    string
+		action  func(r reservationmanager.Repository) error
+		wantErr error
+	}{
+		{
+			name: "error | ordered a negative quantity",
+			action: func(r reservationmanager.Repository) error {
+				return create(r, milk, entities.Ingredient{ID: "water", Quantity: -20})
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "water", Quantity: -20},
+		},
+		{
+			name: "error | ordered nothing of an ingredient",
+			action: func(r reservationmanager.Repository) error {
+				return create(r, milk, entities.Ingredient{ID: "water"})
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "water"},
+		},
+		{
+			name: "error | ordered more than the ledger holds",
+			action: func(r reservationmanager.Repository) error {
+				return create(r, milk, entities.Ingredient{ID: "water", Quantity: resourcemanager.MaxQuantity + 1})
+			},
+			wantErr: entities.ErrQuantityOverflow{ResourceID: "water"},
+		},
+		{
+			name: "error | ordered without an ingredient",
+			action: func(r reservationmanager.Repository) error {
+				return create(r, milk, entities.Ingredient{Quantity: 20})
+			},
+			wantErr: entities.ErrMissingID{Field: "ingredient-id"},
+		},
+		{
+			name: "error | ordered without an order",
+			action: func(r reservationmanager.Repository) error {
+				_, err := r.Create(ctx, reservationmanager.CreateReservationRequest{Ingredients: []entities.Ingredient{milk}})
+				return err
+			},
+			wantErr: entities.ErrMissingID{Field: "order-id"},
+		},
+		{
+			name: "error | ordered no ingredients",
+			action: func(r reservationmanager.Repository) error {
+				return create(r)
+			},
+			wantErr: entities.ErrNoIngredients{OrderID: "order1"},
+		},
+		{
+			name: "error | got without a token",
+			action: func(r reservationmanager.Repository) error {
+				_, err := r.Get(ctx, reservationmanager.GetReservationRequest{})
+				return err
+			},
+			wantErr: entities.ErrMissingID{Field: "token"},
+		},
+		{
+			name: "error | committed without a token",
+			action: func(r reservationmanager.Repository) error {
+				return r.Commit(ctx, reservationmanager.CommitReservationRequest{})
+			},
+			wantErr: entities.ErrMissingID{Field: "token"},
+		},
+		{
+			name: "error | cancelled without a token",
+			action: func(r reservationmanager.Repository) error {
+				return r.Cancel(ctx, reservationmanager.CancelReservationRequest{})
+			},
+			wantErr: entities.ErrMissingID{Field: "token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, r := newRepositories(t, factory, clock.NewFake(resourcemanagertest.Start), nil)
+
+			assert.Equal(t, tt.wantErr, tt.action(r))
+			got, err := r.Snapshot(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, got.Pending)
+			assert.Equal(t, []resourcemanager.Levels{
+				{IngredientID: "milk", OnHand: 100, Available: 100},
+				{IngredientID: "water", OnHand: 50, Available: 50},
+			}, got.Levels)
+		})
+	}
+}
+
+func testConcurrentOrders(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	ledger, r := newRepositories(t, factory, clock.New(), nil)
+
+	// 60 orders for 2 milk & 1 water each, only 50 of them can be served
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	committed := 0
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{
+				OrderID:     "order",
+				Ingredients: []entities.Ingredient{{ID: "milk", Quantity: 2}, {ID: "water", Quantity: 1}},
+			})
+			if err != nil {
+				return
+			}
+			if err := r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token}); err == nil {
+				mutex.Lock()
+				committed += 1
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, committed)
+	assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk"}, resourcemanagertest.GetLevels(ledger, "milk"))
+	assert.Equal(t, &resourcemanager.Levels{IngredientID: "water"}, resourcemanagertest.GetLevels(ledger, "water"))
+}
+
+func testConcurrentCommitAndCancel(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	ledger, r := newRepositories(t, factory, clock.New(), nil)
+	created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{
+		OrderID:     "order1",
+		Ingredients: []entities.Ingredient{{ID: "milk", Quantity: 10}},
+	})
+	assert.NoError(t, err)
+
+	// whichever wins, the reservation is settled exactly once
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token})
+		}()
+	}
+	wg.Wait()
+
+	got, err := r.Get(ctx, reservationmanager.GetReservationRequest{Token: created.Token})
+	assert.NoError(t, err)
+	want := map[reservationmanager.Status]int{reservationmanager.StatusCommitted: 90, reservationmanager.StatusCancelled: 100}
+	assert.Equal(t, want[got.Status], resourcemanagertest.GetLevels(ledger, "milk").OnHand)
+	assert.Equal(t, 0, resourcemanagertest.GetLevels(ledger, "milk").Reserved)
+}
+
+// testConcurrentSnapshots checks that no reservation is ever seen half way taken or settled, so the ledger always adds up
+func testConcurrentSnapshots(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, r := newRepositories(t, factory, clock.New(), nil)
+	ingredients := []entities.Ingredient{{ID: "milk", Quantity: 1}, {ID: "water", Quantity: 1}}
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				created, err := r.Create(ctx, reservationmanager.CreateReservationRequest{OrderID: "order", Ingredients: ingredients})
+				if err != nil {
+					continue
+				}
+				if i%2 == 0 {
+					_ = r.Commit(ctx, reservationmanager.CommitReservationRequest{Token: created.Token})
+				} else {
+					_ = r.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: created.Token})
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < 20; i++ {
+		snapshot, err := r.Snapshot(ctx)
+		assert.NoError(t, err)
+		reserved := map[string]int{}
+		for _, res := range snapshot.Pending {
+			assert.Equal(t, reservationmanager.StatusPending, res.Status)
+			for _, ingredient := range res.Ingredients {
+				reserved[ingredient.ID] += ingredient.Quantity
+			}
+		}
+		for _, got := range snapshot.Levels {
+			assert.Equal(t, reserved[got.IngredientID], got.Reserved)
+			assert.Equal(t, got.OnHand-got.Reserved, got.Available)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+package reservationmanager
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+)
+
+/*
+	Requests are validated before anything is reserved - an order needs an id and at least one ingredient,
+	every ingredient is validated as a reservation on the ledger would be [ see resourcemanager.ReservationRequest.Validate ],
+	and tokens can't be empty.
+*/
+
+func (r CreateReservationRequest) Validate() error {
+	if r.OrderID == "" {
+		return entities.ErrMissingID{Field: "order-id"}
+	}
+	if len(r.Ingredients) == 0 {
+		return entities.ErrNoIngredients{OrderID: r.OrderID}
+	}
+	for _, ingredient := range r.Ingredients {
+		reserveReq := resourcemanager.ReservationRequest{
+			IngredientID: ingredient.ID,
+			Quantity:     ingredient.Quantity,
+		}
+		if err := reserveReq.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateToken(token string) error {
+	if token == "" {
+		return entities.ErrMissingID{Field: "token"}
+	}
+	return nil
+}
+
+func (r GetReservationRequest) Validate() error {
+	return validateToken(r.Token)
+}
+
+func (r CommitReservationRequest) Validate() error {
+	return validateToken(r.Token)
+}
+
+func (r CancelReservationRequest) Validate() error {
+	return validateToken(r.Token)
+}
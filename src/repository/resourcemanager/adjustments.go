@@ -0,0 +1,45 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"time"
+)
+
+/*
+	adjustLots applies the variance of an adjustment to the lots - a shortfall is taken from the unexpired lots
+	in FIFO order, as if it was consumed, and a surplus goes to an anonymous lot since nobody knows where it came from.
+	It must be called with lotsMutex locked, after a sweep - so that everything unreserved is unexpired.
+*/
+func (c *cell) adjustLots(ingredientID string, variance int) {
+	if variance < 0 {
+		c.consumeLots(ingredientID, -variance)
+	} else if variance > 0 {
+		c.addLot("", variance, time.Time{})
+	}
+}
+
+// recordAdjustment logs the adjustment, and publishes the variance with the quantity on hand after it
+func (m *repositoryImpl) recordAdjustment(adjustment entities.Adjustment) {
+	m.adjustmentsMutex.Lock()
+	m.adjustments = append(m.adjustments, adjustment)
+	m.adjustmentsMutex.Unlock()
+
+	m.publishEvent(eventbus.Event{
+		Type:        eventbus.TypeInventoryAdjusted,
+		At:          adjustment.At,
+		Ingredients: []entities.Ingredient{{ID: adjustment.IngredientID, Quantity: adjustment.Variance}},
+		Remaining:   []entities.Ingredient{{ID: adjustment.IngredientID, Quantity: adjustment.Observed}},
+		Reason:      string(adjustment.Reason),
+	})
+}
+
+func (m *repositoryImpl) ListAdjustments(ctx context.Context) ([]entities.Adjustment, error) {
+	m.adjustmentsMutex.Lock()
+	defer m.adjustmentsMutex.Unlock()
+
+	adjustments := make([]entities.Adjustment, len(m.adjustments))
+	copy(adjustments, m.adjustments)
+	return adjustments, nil
+}
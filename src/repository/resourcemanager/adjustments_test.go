@@ -0,0 +1,92 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_repositoryImpl_Adjust(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	adjust := func(quantity int, reason entities.AdjustReason) UpdateRequest {
+		return UpdateRequest{IngredientID: "hot_milk", UpdateType: UpdateTypeAdjust, ResourceQuantity: quantity, Reason: reason}
+	}
+
+	tests := []struct {
+		name            string
+		updateReq       UpdateRequest
+		want            *entities.Ingredient
+		wantErr         error
+		wantLots        []entities.Lot
+		wantAdjustments []entities.Adjustment
+	}{
+		{
+			name:      "success | shortfall taken from the oldest lot",
+			updateReq: adjust(250, entities.AdjustReasonSpillage),
+			want:      &entities.Ingredient{ID: "hot_milk", Quantity: 250},
+			wantLots: []entities.Lot{
+				{ID: "L1", IngredientID: "hot_milk", Quantity: 50},
+				{ID: "L2", IngredientID: "hot_milk", Quantity: 200},
+			},
+			wantAdjustments: []entities.Adjustment{
+				{IngredientID: "hot_milk", Reason: entities.AdjustReasonSpillage, Expected: 400, Observed: 250, Variance: -150, At: start},
+			},
+		},
+		{
+			name:      "success | surplus goes to an anonymous lot",
+			updateReq: adjust(450, entities.AdjustReasonStockTake),
+			want:      &entities.Ingredient{ID: "hot_milk", Quantity: 450},
+			wantLots: []entities.Lot{
+				{ID: "L1", IngredientID: "hot_milk", Quantity: 200},
+				{ID: "L2", IngredientID: "hot_milk", Quantity: 200},
+				{IngredientID: "hot_milk", Quantity: 50},
+			},
+			wantAdjustments: []entities.Adjustment{
+				{IngredientID: "hot_milk", Reason: entities.AdjustReasonStockTake, Expected: 400, Observed: 450, Variance: 50, At: start},
+			},
+		},
+		{
+			name:      "error | below the reserved quantity",
+			updateReq: adjust(50, entities.AdjustReasonWaste),
+			wantErr:   entities.ErrBelowReserved{ResourceID: "hot_milk", Quantity: 50, Reserved: 100},
+			wantLots: []entities.Lot{
+				{ID: "L1", IngredientID: "hot_milk", Quantity: 200},
+				{ID: "L2", IngredientID: "hot_milk", Quantity: 200},
+			},
+			wantAdjustments: []entities.Adjustment{},
+		},
+		{
+			name:      "error | unknown reason",
+			updateReq: adjust(300, "BORROWED"),
+			wantErr:   entities.ErrInvalidAdjustReason{Reason: "BORROWED"},
+			wantLots: []entities.Lot{
+				{ID: "L1", IngredientID: "hot_milk", Quantity: 200},
+				{ID: "L2", IngredientID: "hot_milk", Quantity: 200},
+			},
+			wantAdjustments: []entities.Adjustment{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(WithClock(clock.NewFake(start)))
+			for _, lotID := range []string{"L1", "L2"} {
+				_, _ = m.UpdateIngredient(ctx, UpdateRequest{IngredientID: "hot_milk", UpdateType: UpdateTypeRefill, ResourceQuantity: 200, LotID: lotID})
+			}
+			_ = m.Reserve(ctx, ReservationRequest{IngredientID: "hot_milk", Quantity: 100})
+
+			got, err := m.UpdateIngredient(ctx, tt.updateReq)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+			lots, _ := m.ListLots(ctx, GetRequest{IngredientID: "hot_milk"})
+			assert.Equal(t, tt.wantLots, lots)
+			adjustments, _ := m.ListAdjustments(ctx)
+			assert.Equal(t, tt.wantAdjustments, adjustments)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/*
+	mutexStore is the inventory the ledger replaced, kept as a baseline for BenchmarkPour only.
+	The quantities on hand and the reserved quantities are kept in two maps, each behind a read-write mutex,
+	and the coffee-machine held a mutex of the ingredient while it checked availability & reserved it.
+	The simulated 1µs storage latency of every call is left out, it would only measure the sleeps.
+*/
+type mutexStore struct {
+	onHandMutex   sync.RWMutex
+	onHand        map[string]int
+	reservedMutex sync.RWMutex
+	reserved      map[string]int
+	// mutexes of the ingredients, which the coffee-machine held
+	mutexesMutex sync.Mutex
+	mutexes      map[string]*sync.Mutex
+}
+
+func newMutexStore(inventory []entities.Ingredient) *mutexStore {
+	s := &mutexStore{
+		onHand:   make(map[string]int, len(inventory)),
+		reserved: make(map[string]int, len(inventory)),
+		mutexes:  make(map[string]*sync.Mutex, len(inventory)),
+	}
+	for _, ingredient := range inventory {
+		s.onHand[ingredient.ID] = ingredient.Quantity
+	}
+	return s
+}
+
+func (s *mutexStore) mutex(ingredientID string) *sync.Mutex {
+	s.mutexesMutex.Lock()
+	defer s.mutexesMutex.Unlock()
+
+	if _, ok := s.mutexes[ingredientID]; !ok {
+		s.mutexes[ingredientID] = &sync.Mutex{}
+	}
+	return s.mutexes[ingredientID]
+}
+
+func (s *mutexStore) reserve(ingredient entities.Ingredient) error {
+	mutex := s.mutex(ingredient.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s.onHandMutex.RLock()
+	onHand, ok := s.onHand[ingredient.ID]
+	s.onHandMutex.RUnlock()
+	if !ok {
+		return entities.ErrResourceNotAvailable{ResourceID: ingredient.ID}
+	}
+	s.reservedMutex.RLock()
+	reserved := s.reserved[ingredient.ID]
+	s.reservedMutex.RUnlock()
+
+	if onHand-reserved >= ingredient.Quantity {
+		s.reservedMutex.Lock()
+		s.reserved[ingredient.ID] += ingredient.Quantity
+		s.reservedMutex.Unlock()
+		return nil
+	}
+	if onHand >= ingredient.Quantity {
+		return entities.ErrResourceTemporarilyNotAvailable{ResourceID: ingredient.ID}
+	}
+	return entities.ErrInsufficientResource{ResourceID: ingredient.ID}
+}
+
+func (s *mutexStore) consume(ingredient entities.Ingredient) {
+	mutex := s.mutex(ingredient.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s.onHandMutex.Lock()
+	defer s.onHandMutex.Unlock()
+	s.onHand[ingredient.ID] -= ingredient.Quantity
+}
+
+func (s *mutexStore) release(ingredient entities.Ingredient) {
+	mutex := s.mutex(ingredient.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s.reservedMutex.Lock()
+	defer s.reservedMutex.Unlock()
+	s.reserved[ingredient.ID] -= ingredient.Quantity
+}
+
+// pour reserves every ingredient, consumes them and deletes the reservations - as the coffee-machine did
+func (s *mutexStore) pour(ingredients []entities.Ingredient) error {
+	for idx, ingredient := range ingredients {
+		if err := s.reserve(ingredient); err != nil {
+			for _, reserved := range ingredients[:idx] {
+				s.release(reserved)
+			}
+			return err
+		}
+	}
+	for _, ingredient := range ingredients {
+		s.consume(ingredient)
+	}
+	for _, ingredient := range ingredients {
+		s.release(ingredient)
+	}
+	return nil
+}
+
+// pour reserves every ingredient on the ledger and commits them, releasing the ones reserved if any fails
+func pour(ctx context.Context, m Repository, ingredients []entities.Ingredient) error {
+	for idx, ingredient := range ingredients {
+		if err := m.Reserve(ctx, ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity}); err != nil {
+			for _, reserved := range ingredients[:idx] {
+				_ = m.Release(ctx, ReservationRequest{IngredientID: reserved.ID, Quantity: reserved.Quantity})
+			}
+			return err
+		}
+	}
+	for _, ingredient := range ingredients {
+		if _, err := m.Commit(ctx, ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	BenchmarkPour pours 1000 black teas over 1 and 8 outlets [ goroutines ], once on the mutex based store
+	the ledger replaced and once on the ledger - an op is the whole batch.
+*/
+func BenchmarkPour(b *testing.B) {
+	ctx := context.Background()
+	const numOfDrinks = 1000
+	blackTea := []entities.Ingredient{
+		{ID: "hot_water", Quantity: 300},
+		{ID: "ginger_syrup", Quantity: 30},
+		{ID: "sugar_syrup", Quantity: 50},
+		{ID: "tea_leaves_syrup", Quantity: 30},
+	}
+	inventory := make([]entities.Ingredient, 0, len(blackTea))
+	for _, ingredient := range blackTea {
+		inventory = append(inventory, entities.Ingredient{ID: ingredient.ID, Quantity: ingredient.Quantity * numOfDrinks})
+	}
+
+	stores := []struct {
+		name string
+		// newPour returns a pour of a single drink, on a freshly refilled store
+		newPour func() func() error
+	}{
+		{
+			name: "mutexes",
+			newPour: func() func() error {
+				s := newMutexStore(inventory)
+				return func() error { return s.pour(blackTea) }
+			},
+		},
+		{
+			name: "ledger",
+			newPour: func() func() error {
+				m := New()
+				for _, ingredient := range inventory {
+					if _, err := m.UpdateIngredient(ctx, UpdateRequest{IngredientID: ingredient.ID, UpdateType: UpdateTypeRefill, ResourceQuantity: ingredient.Quantity}); err != nil {
+						panic(err)
+					}
+				}
+				return func() error { return pour(ctx, m, blackTea) }
+			},
+		},
+	}
+	for _, store := range stores {
+		for _, numOfOutlets := range []int{1, 8} {
+			b.Run(store.name+"/"+strconv.Itoa(numOfOutlets)+"_outlets", func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					b.StopTimer()
+					pourOne := store.newPour()
+					drinks := make(chan struct{}, numOfDrinks)
+					for i := 0; i < numOfDrinks; i++ {
+						drinks <- struct{}{}
+					}
+					close(drinks)
+					b.StartTimer()
+
+					wg := sync.WaitGroup{}
+					for outlet := 0; outlet < numOfOutlets; outlet++ {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							for range drinks {
+								// a drink only temporarily unavailable is retried, as the coffee-machine does
+								for {
+									_, retry := pourOne().(entities.ErrResourceTemporarilyNotAvailable)
+									if !retry {
+										break
+									}
+								}
+							}
+						}()
+					}
+					wg.Wait()
+				}
+			})
+		}
+	}
+}
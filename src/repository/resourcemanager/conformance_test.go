@@ -0,0 +1,21 @@
+package resourcemanager_test
+
+import (
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/repository/resourcemanager/resourcemanagertest"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	resourcemanagertest.Run(t, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return resourcemanager.New(resourcemanager.WithClock(clk), resourcemanager.WithEventBus(bus))
+	})
+}
+
+func FuzzLedger(f *testing.F) {
+	resourcemanagertest.Fuzz(f, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return resourcemanager.New(resourcemanager.WithClock(clk), resourcemanager.WithEventBus(bus))
+	})
+}
@@ -1,18 +1,70 @@
 package resourcemanager
 
+import (
+	"coffeeMachine/src/entities"
+	"time"
+)
+
 type UpdateType string
 
 const (
 	UpdateTypeConsume = "CONSUME"
 	UpdateTypeRefill  = "REFILL"
+	// UpdateTypeAdjust sets the quantity on hand to ResourceQuantity, e.g. what a stock-take counted
+	UpdateTypeAdjust = "ADJUST"
 )
 
 type UpdateRequest struct {
 	IngredientID     string
 	UpdateType       UpdateType // can i use option???
 	ResourceQuantity int
+	// LotID & ExpiresAt are optional, for refills - a lot without an expiry never expires
+	LotID     string
+	ExpiresAt time.Time
+	// Reason is required for adjustments
+	Reason entities.AdjustReason
+}
+
+// RefillRequest is a single refill of RefillMany, LotID & ExpiresAt are optional as for UpdateRequest
+type RefillRequest struct {
+	IngredientID string
+	Quantity     int
+	LotID        string
+	ExpiresAt    time.Time
+}
+
+type IngredientRequest struct {
+	IngredientID string
 }
 
 type GetRequest struct {
 	IngredientID string
 }
+
+type ReservationRequest struct {
+	IngredientID string
+	Quantity     int
+}
+
+// Levels of an ingredient in the ledger, where Available = OnHand - Reserved
+type Levels struct {
+	IngredientID string
+	OnHand       int
+	Reserved     int
+	Available    int
+	// Deactivated ingredients can't be reserved or refilled, see DeactivateIngredient
+	Deactivated bool
+}
+
+// Snapshot is the levels of every ingredient at a single instant, sorted by ingredient-id
+type Snapshot struct {
+	TakenAt time.Time
+	Levels  []Levels
+}
+
+// Consumption is the result of committing a reservation, with the lots the quantity was taken from
+type Consumption struct {
+	IngredientID string
+	OnHand       int
+	Lots         []entities.LotUsage
+}
@@ -0,0 +1,82 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"context"
+	"sync/atomic"
+)
+
+/*
+	An ingredient is active once it's added or refilled. Deactivating it stops new reservations, refills & direct
+	consumption - but reservations already taken can still be committed or released, and its quantity can still
+	be adjusted. Once nothing is on hand or reserved any more, it can be removed.
+
+	The status only changes with the ingredient's shard write-locked, while updates hold it read-locked -
+	so an update either completes before the change, or sees the new status.
+*/
+const (
+	statusActive int32 = iota
+	statusDeactivated
+	statusRemoved
+)
+
+func (c *cell) deactivated() bool {
+	return atomic.LoadInt32(&c.status) == statusDeactivated
+}
+
+// AddIngredient adds an ingredient with nothing on hand, or activates it again if it was deactivated
+func (m *repositoryImpl) AddIngredient(ctx context.Context, req IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	s := m.shardFor(req.IngredientID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if c, ok := s.cells[req.IngredientID]; ok {
+		atomic.StoreInt32(&c.status, statusActive)
+		return nil
+	}
+	s.cells[req.IngredientID] = newCell(s)
+	return nil
+}
+
+func (m *repositoryImpl) DeactivateIngredient(ctx context.Context, req IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	s := m.shardFor(req.IngredientID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.cells[req.IngredientID]
+	if !ok {
+		return entities.ErrResourceNotAvailable{ResourceID: req.IngredientID}
+	}
+	atomic.StoreInt32(&c.status, statusDeactivated)
+	return nil
+}
+
+// RemoveIngredient removes a deactivated ingredient, once it's empty - refilling it later adds it again
+func (m *repositoryImpl) RemoveIngredient(ctx context.Context, req IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	s := m.shardFor(req.IngredientID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.cells[req.IngredientID]
+	if !ok {
+		return entities.ErrResourceNotAvailable{ResourceID: req.IngredientID}
+	}
+	if !c.deactivated() {
+		return entities.ErrIngredientActive{ResourceID: req.IngredientID}
+	}
+	if onHand, reserved := unpack(atomic.LoadUint64(&c.word)); onHand > 0 || reserved > 0 {
+		return entities.ErrIngredientNotEmpty{ResourceID: req.IngredientID, OnHand: onHand, Reserved: reserved}
+	}
+	atomic.StoreInt32(&c.status, statusRemoved)
+	delete(s.cells, req.IngredientID)
+	return nil
+}
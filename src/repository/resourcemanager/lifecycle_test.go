@@ -0,0 +1,158 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_repositoryImpl_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	milk := IngredientRequest{IngredientID: "milk"}
+	reservation := ReservationRequest{IngredientID: "milk", Quantity: 40}
+	refill := func(m Repository, quantity int) error {
+		_, err := m.UpdateIngredient(ctx, UpdateRequest{IngredientID: "milk", UpdateType: UpdateTypeRefill, ResourceQuantity: quantity})
+		return err
+	}
+
+	tests := []struct {
+		name       string
+		action     func(m Repository) error
+		wantErr    error
+		wantLevels *Levels
+		// wantLevelsErr is set if the ingredient shouldn't be there any more
+		wantLevelsErr error
+	}{
+		{
+			name: "success | added with nothing on hand",
+			action: func(m Repository) error {
+				if err := m.AddIngredient(ctx, IngredientRequest{IngredientID: "oat_milk"}); err != nil {
+					return err
+				}
+				levels, err := m.GetLevels(ctx, GetRequest{IngredientID: "oat_milk"})
+				assert.Equal(t, &Levels{IngredientID: "oat_milk"}, levels)
+				return err
+			},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "success | reservation taken before deactivating is committed",
+			action: func(m Repository) error {
+				if err := m.DeactivateIngredient(ctx, milk); err != nil {
+					return err
+				}
+				_, err := m.Commit(ctx, reservation)
+				return err
+			},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 60, Available: 60, Deactivated: true},
+		},
+		{
+			name: "success | deactivated, emptied & removed",
+			action: func(m Repository) error {
+				if err := m.DeactivateIngredient(ctx, milk); err != nil {
+					return err
+				}
+				if err := m.Release(ctx, reservation); err != nil {
+					return err
+				}
+				if _, err := m.UpdateIngredient(ctx, UpdateRequest{
+					IngredientID: "milk", UpdateType: UpdateTypeAdjust, Reason: entities.AdjustReasonWaste,
+				}); err != nil {
+					return err
+				}
+				return m.RemoveIngredient(ctx, milk)
+			},
+			wantLevelsErr: entities.ErrResourceNotAvailable{ResourceID: "milk"},
+		},
+		{
+			name: "success | removed & refilled again",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				_ = m.Release(ctx, reservation)
+				_, _ = m.UpdateIngredient(ctx, UpdateRequest{IngredientID: "milk", UpdateType: UpdateTypeAdjust, Reason: entities.AdjustReasonWaste})
+				_ = m.RemoveIngredient(ctx, milk)
+				return refill(m, 10)
+			},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 10, Available: 10},
+		},
+		{
+			name: "success | activated again",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				if err := m.AddIngredient(ctx, milk); err != nil {
+					return err
+				}
+				return refill(m, 10)
+			},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 110, Reserved: 40, Available: 70},
+		},
+		{
+			name: "error | deactivated ingredient can't be reserved",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				return m.Reserve(ctx, ReservationRequest{IngredientID: "milk", Quantity: 10})
+			},
+			wantErr:    entities.ErrIngredientDeactivated{ResourceID: "milk"},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60, Deactivated: true},
+		},
+		{
+			name: "error | deactivated ingredient can't be refilled",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				return refill(m, 10)
+			},
+			wantErr:    entities.ErrIngredientDeactivated{ResourceID: "milk"},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60, Deactivated: true},
+		},
+		{
+			name: "error | deactivated ingredient can't be refilled in bulk",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				_, err := m.RefillMany(ctx, []RefillRequest{{IngredientID: "milk", Quantity: 10}})
+				return err
+			},
+			wantErr:    entities.ErrIngredientDeactivated{ResourceID: "milk"},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60, Deactivated: true},
+		},
+		{
+			name: "error | active ingredient can't be removed",
+			action: func(m Repository) error {
+				return m.RemoveIngredient(ctx, milk)
+			},
+			wantErr:    entities.ErrIngredientActive{ResourceID: "milk"},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | ingredient on hand & reserved can't be removed",
+			action: func(m Repository) error {
+				_ = m.DeactivateIngredient(ctx, milk)
+				return m.RemoveIngredient(ctx, milk)
+			},
+			wantErr:    entities.ErrIngredientNotEmpty{ResourceID: "milk", OnHand: 100, Reserved: 40},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60, Deactivated: true},
+		},
+		{
+			name: "error | unknown ingredient",
+			action: func(m Repository) error {
+				return m.DeactivateIngredient(ctx, IngredientRequest{IngredientID: "oat_milk"})
+			},
+			wantErr:    entities.ErrResourceNotAvailable{ResourceID: "oat_milk"},
+			wantLevels: &Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			_ = refill(m, 100)
+			_ = m.Reserve(ctx, reservation)
+
+			assert.Equal(t, tt.wantErr, tt.action(m))
+			levels, err := m.GetLevels(ctx, GetRequest{IngredientID: "milk"})
+			assert.Equal(t, tt.wantLevelsErr, err)
+			assert.Equal(t, tt.wantLevels, levels)
+		})
+	}
+}
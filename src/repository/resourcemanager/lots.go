@@ -0,0 +1,185 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	lot is a refill of an ingredient, quantities are consumed from the lots of an ingredient in the order
+	they were refilled [ FIFO ], skipping expired ones. Refills without a lot-id go to anonymous lots, which
+	never expire - they are never reported as used by a drink, since there is nothing to trace.
+*/
+type lot struct {
+	id        string
+	remaining int
+	expiresAt time.Time
+	expired   bool
+	// writtenOff is the quantity removed from the quantity on hand, once the lot expired
+	writtenOff int
+}
+
+func (l *lot) toEntity(ingredientID string) entities.Lot {
+	return entities.Lot{
+		ID:           l.id,
+		IngredientID: ingredientID,
+		Quantity:     l.remaining,
+		ExpiresAt:    l.expiresAt,
+		Expired:      l.expired,
+		WrittenOff:   l.writtenOff,
+	}
+}
+
+// unexpired returns the quantity of lots which haven't expired, it must be called with lotsMutex locked
+func (c *cell) unexpired() int {
+	quantity := 0
+	for _, l := range c.lots {
+		if !l.expired {
+			quantity += l.remaining
+		}
+	}
+	return quantity
+}
+
+// addLot must be called with lotsMutex locked, consecutive anonymous refills are merged into one lot
+func (c *cell) addLot(id string, quantity int, expiresAt time.Time) {
+	if last := len(c.lots) - 1; id == "" && expiresAt.IsZero() && last >= 0 && c.lots[last].id == "" && c.lots[last].expiresAt.IsZero() {
+		c.lots[last].remaining += quantity
+		return
+	}
+	c.lots = append(c.lots, &lot{id: id, remaining: quantity, expiresAt: expiresAt})
+	if !expiresAt.IsZero() && expiresAt.UnixNano() < atomic.LoadInt64(&c.nextExpiry) {
+		atomic.StoreInt64(&c.nextExpiry, expiresAt.UnixNano())
+	}
+}
+
+/*
+	consumeLots takes the quantity from the unexpired lots in FIFO order, and drops the lots it depleted -
+	expired lots are kept, so that they can still be reported.
+	It must be called with lotsMutex locked, after checking that enough is unexpired.
+*/
+func (c *cell) consumeLots(ingredientID string, quantity int) []entities.LotUsage {
+	var usage []entities.LotUsage
+	for _, l := range c.lots {
+		if quantity == 0 {
+			break
+		}
+		if l.expired || l.remaining == 0 {
+			continue
+		}
+		taken := l.remaining
+		if taken > quantity {
+			taken = quantity
+		}
+		l.remaining -= taken
+		quantity -= taken
+		if l.id != "" {
+			usage = append(usage, entities.LotUsage{IngredientID: ingredientID, LotID: l.id, Quantity: taken})
+		}
+	}
+
+	lots := c.lots[:0]
+	for _, l := range c.lots {
+		if l.remaining > 0 || l.expired {
+			lots = append(lots, l)
+		}
+	}
+	c.lots = lots
+	return usage
+}
+
+// isDue tells if a lot may have expired since the last sweep, without reading the clock unless some lot expires
+func (m *repositoryImpl) isDue(c *cell) (time.Time, bool) {
+	nextExpiry := atomic.LoadInt64(&c.nextExpiry)
+	if nextExpiry == math.MaxInt64 {
+		return time.Time{}, false
+	}
+	now := m.clock.Now()
+	return now, nextExpiry <= now.UnixNano()
+}
+
+// sweepIfDue writes off expired lots, if any lot expired since the last sweep.
+// It's cheap when nothing is due, so every operation calls it before looking at the quantities
+func (m *repositoryImpl) sweepIfDue(ingredientID string, c *cell) {
+	if _, due := m.isDue(c); !due {
+		return
+	}
+
+	c.lotsMutex.Lock()
+	events := m.sweep(ingredientID, c)
+	c.lotsMutex.Unlock()
+
+	for _, event := range events {
+		m.publishEvent(event)
+	}
+}
+
+/*
+	sweep marks the lots which are due as expired, and writes off their quantities - removing them from the
+	quantity on hand. Quantities held by reservations are never written off from under them though, so an expired
+	lot is only written off as far as the unreserved quantity allows. The rest is written off by later sweeps,
+	once reservations are released. Committing them fails meanwhile, since only unexpired lots are consumed.
+
+	It must be called with lotsMutex locked, and returns the events to publish once it's unlocked.
+*/
+func (m *repositoryImpl) sweep(ingredientID string, c *cell) []eventbus.Event {
+	now, due := m.isDue(c)
+	if !due {
+		return nil
+	}
+	events := make([]eventbus.Event, 0)
+	nextExpiry := int64(math.MaxInt64)
+	for _, l := range c.lots {
+		if !l.expired && !l.expiresAt.IsZero() && !now.Before(l.expiresAt) {
+			l.expired = true
+		}
+		if !l.expired {
+			if !l.expiresAt.IsZero() && l.expiresAt.UnixNano() < nextExpiry {
+				nextExpiry = l.expiresAt.UnixNano()
+			}
+			continue
+		}
+		if l.remaining == 0 {
+			continue
+		}
+
+		writtenOff := 0
+		onHand, _ := c.update(ingredientID, func(onHand, reserved int) (int, int, error) {
+			writtenOff = l.remaining
+			if writtenOff > onHand-reserved {
+				writtenOff = onHand - reserved
+			}
+			return onHand - writtenOff, reserved, nil
+		})
+		l.remaining -= writtenOff
+		l.writtenOff += writtenOff
+		if l.remaining > 0 {
+			// held by reservations, so it's swept again by the next operation
+			nextExpiry = math.MinInt64
+		}
+		if writtenOff > 0 {
+			events = append(events, eventbus.Event{
+				Type:        eventbus.TypeLotExpired,
+				At:          now,
+				LotID:       l.id,
+				Ingredients: []entities.Ingredient{{ID: ingredientID, Quantity: writtenOff}},
+				Remaining:   []entities.Ingredient{{ID: ingredientID, Quantity: onHand}},
+			})
+		}
+	}
+	atomic.StoreInt64(&c.nextExpiry, nextExpiry)
+	return events
+}
+
+// firstExpiredLot returns the id of the first expired lot which isn't written off yet, it must be called with lotsMutex locked
+func (c *cell) firstExpiredLot() string {
+	for _, l := range c.lots {
+		if l.expired && l.remaining > 0 {
+			return l.id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package resourcemanager
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_repositoryImpl_Lots(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	refill := func(m Repository, lotID string, quantity int, expiresAt time.Time) error {
+		_, err := m.UpdateIngredient(ctx, UpdateRequest{
+			IngredientID:     "hot_milk",
+			UpdateType:       UpdateTypeRefill,
+			ResourceQuantity: quantity,
+			LotID:            lotID,
+			ExpiresAt:        expiresAt,
+		})
+		return err
+	}
+	reserveAndCommit := func(m Repository, quantity int) (*Consumption, error) {
+		req := ReservationRequest{IngredientID: "hot_milk", Quantity: quantity}
+		if err := m.Reserve(ctx, req); err != nil {
+			return nil, err
+		}
+		return m.Commit(ctx, req)
+	}
+
+	tests := []struct {
+		name   string
+		action func(m Repository, fakeClock *clock.Fake) (*Consumption, error)
+		assert func(m Repository, consumption *Consumption, err error, expired []eventbus.Event)
+	}{
+		{
+			name: "success | consumed in the order of refills",
+			action: func(m Repository, fakeClock *clock.Fake) (*Consumption, error) {
+				_ = refill(m, "L1", 100, start.Add(time.Hour))
+				_ = refill(m, "L2", 100, start.Add(2*time.Hour))
+				return reserveAndCommit(m, 150)
+			},
+			assert: func(m Repository, consumption *Consumption, err error, expired []eventbus.Event) {
+				assert.NoError(t, err)
+				assert.Equal(t, &Consumption{
+					IngredientID: "hot_milk",
+					OnHand:       50,
+					Lots: []entities.LotUsage{
+						{IngredientID: "hot_milk", LotID: "L1", Quantity: 100},
+						{IngredientID: "hot_milk", LotID: "L2", Quantity: 50},
+					},
+				}, consumption)
+				lots, _ := m.ListLots(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, []entities.Lot{
+					{ID: "L2", IngredientID: "hot_milk", Quantity: 50, ExpiresAt: start.Add(2 * time.Hour)},
+				}, lots)
+			},
+		},
+		{
+			name: "success | anonymous lots aren't traced",
+			action: func(m Repository, fakeClock *clock.Fake) (*Consumption, error) {
+				_ = refill(m, "", 100, time.Time{})
+				_ = refill(m, "", 100, time.Time{})
+				return reserveAndCommit(m, 150)
+			},
+			assert: func(m Repository, consumption *Consumption, err error, expired []eventbus.Event) {
+				assert.NoError(t, err)
+				assert.Nil(t, consumption.Lots)
+				lots, _ := m.ListLots(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, []entities.Lot{{IngredientID: "hot_milk", Quantity: 50}}, lots)
+			},
+		},
+		{
+			name: "success | expired lot excluded & reported",
+			action: func(m Repository, fakeClock *clock.Fake) (*Consumption, error) {
+				_ = refill(m, "L1", 100, start.Add(time.Hour))
+				_ = refill(m, "L2", 100, time.Time{})
+				fakeClock.Advance(time.Hour)
+				return reserveAndCommit(m, 50)
+			},
+			assert: func(m Repository, consumption *Consumption, err error, expired []eventbus.Event) {
+				assert.NoError(t, err)
+				assert.Equal(t, []entities.LotUsage{{IngredientID: "hot_milk", LotID: "L2", Quantity: 50}}, consumption.Lots)
+				levels, _ := m.GetLevels(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, &Levels{IngredientID: "hot_milk", OnHand: 50, Reserved: 0, Available: 50}, levels)
+				lots, _ := m.ListLots(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, entities.Lot{ID: "L1", IngredientID: "hot_milk", ExpiresAt: start.Add(time.Hour), Expired: true, WrittenOff: 100}, lots[0])
+				assert.Len(t, expired, 1)
+				assert.Equal(t, "L1", expired[0].LotID)
+				assert.Equal(t, []entities.Ingredient{{ID: "hot_milk", Quantity: 100}}, expired[0].Ingredients)
+			},
+		},
+		{
+			name: "error | lot expired while reserved",
+			action: func(m Repository, fakeClock *clock.Fake) (*Consumption, error) {
+				_ = refill(m, "L1", 100, start.Add(time.Hour))
+				req := ReservationRequest{IngredientID: "hot_milk", Quantity: 80}
+				if err := m.Reserve(ctx, req); err != nil {
+					return nil, err
+				}
+				fakeClock.Advance(time.Hour)
+				// only the unreserved part is written off, till the reservation is released
+				levels, _ := m.GetLevels(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, &Levels{IngredientID: "hot_milk", OnHand: 80, Reserved: 80, Available: 0}, levels)
+
+				consumption, err := m.Commit(ctx, req)
+				if releaseErr := m.Release(ctx, req); releaseErr != nil {
+					return nil, releaseErr
+				}
+				levels, _ = m.GetLevels(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, &Levels{IngredientID: "hot_milk", OnHand: 0, Reserved: 0, Available: 0}, levels)
+				return consumption, err
+			},
+			assert: func(m Repository, consumption *Consumption, err error, expired []eventbus.Event) {
+				assert.Equal(t, entities.ErrLotExpired{ResourceID: "hot_milk", LotID: "L1"}, err)
+				assert.Len(t, expired, 2)
+			},
+		},
+		{
+			name: "error | refilled lot already expired",
+			action: func(m Repository, fakeClock *clock.Fake) (*Consumption, error) {
+				return nil, refill(m, "L1", 100, start)
+			},
+			assert: func(m Repository, consumption *Consumption, err error, expired []eventbus.Event) {
+				assert.Equal(t, entities.ErrLotExpired{ResourceID: "hot_milk", LotID: "L1"}, err)
+				_, err = m.ListLots(ctx, GetRequest{IngredientID: "hot_milk"})
+				assert.Equal(t, entities.ErrResourceNotAvailable{ResourceID: "hot_milk"}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(start)
+			bus := eventbus.New()
+			expired := make([]eventbus.Event, 0)
+			bus.Subscribe(func(event eventbus.Event) {
+				expired = append(expired, event)
+			}, eventbus.Types(eventbus.TypeLotExpired))
+
+			m := New(WithClock(fakeClock), WithEventBus(bus))
+			consumption, err := tt.action(m, fakeClock)
+			tt.assert(m, consumption, err, expired)
+		})
+	}
+}
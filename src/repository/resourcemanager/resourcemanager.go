@@ -2,67 +2,633 @@ package resourcemanager
 
 import (
 	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
 	"context"
+	"hash/fnv"
+	"math"
+	"sort"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
-// Repository manages the inventory - provides methods to get/modify the inventory
+/*
+	Repository is the inventory ledger - for every ingredient it tracks the quantity on hand,
+	and how much of it is reserved by pending orders. The rest is available.
+	Reservations are taken, committed or released in a single atomic operation,
+	so the reserved quantity can never drift from the quantity on hand.
+
+	The quantity on hand is made of lots [ see lot ], expired lots are excluded from it automatically.
+*/
 type Repository interface {
 	UpdateIngredient(ctx context.Context, updateReq UpdateRequest) (*entities.Ingredient, error)
+	// GetIngredient returns the quantity on hand, including reserved quantities
 	GetIngredient(ctx context.Context, getReq GetRequest) (*entities.Ingredient, error)
+	GetLevels(ctx context.Context, getReq GetRequest) (*Levels, error)
+	// Reserve fails with ErrResourceTemporarilyNotAvailable if the quantity is only unavailable because of other reservations
+	Reserve(ctx context.Context, req ReservationRequest) error
+	// Commit consumes a previously reserved quantity, it fails with ErrLotExpired if the lots it was reserved from expired
+	Commit(ctx context.Context, req ReservationRequest) (*Consumption, error)
+	Release(ctx context.Context, req ReservationRequest) error
+	// ListLots returns the lots of the ingredient in FIFO order, expired lots included
+	ListLots(ctx context.Context, getReq GetRequest) ([]entities.Lot, error)
+	// ListAdjustments returns the variance recorded by every adjustment, in the order they were made
+	ListAdjustments(ctx context.Context) ([]entities.Adjustment, error)
+	// RefillMany applies every refill or none of them, see repositoryImpl.RefillMany
+	RefillMany(ctx context.Context, refillReqs []RefillRequest) ([]entities.Ingredient, error)
+	// ListIngredients returns the quantity on hand of every ingredient ever refilled, sorted by id
+	ListIngredients(ctx context.Context) ([]entities.Ingredient, error)
+	// Snapshot captures the levels of every ingredient at a single instant, see repositoryImpl.Snapshot
+	Snapshot(ctx context.Context) (*Snapshot, error)
+	// AddIngredient, DeactivateIngredient & RemoveIngredient drive the lifecycle of an ingredient, see lifecycle.go
+	AddIngredient(ctx context.Context, req IngredientRequest) error
+	DeactivateIngredient(ctx context.Context, req IngredientRequest) error
+	RemoveIngredient(ctx context.Context, req IngredientRequest) error
+}
+
+const numOfShards = 64
+
+/*
+	The quantities of an ingredient are packed into a single 64 bit word -
+	the lower 32 bits hold the quantity on hand, and the upper 32 bits the reserved quantity.
+	So every update (reserve, commit, release, consume, refill) is a single compare-and-swap on the word,
+	and checking availability can never see the two quantities out of sync.
+
+	Updates changing the quantity on hand also hold lotsMutex, so that the lots always add up to it.
+	Reserving & releasing only change the reserved quantity, so they stay lock-free.
+*/
+type cell struct {
+	word  uint64
+	shard *shard
+	// status is active, deactivated or removed - it only changes with the shard write-locked, see lifecycle.go
+	status int32
+	// nextExpiry is when the next lot expires [ unix nanos ], see sweepIfDue
+	nextExpiry int64
+	lotsMutex  sync.Mutex
+	lots       []*lot
+}
+
+const (
+	quantityBits = 32
+	maxQuantity  = 1<<quantityBits - 1
+)
+
+func pack(onHand, reserved int) uint64 {
+	return uint64(reserved)<<quantityBits | uint64(onHand)
+}
+
+func unpack(word uint64) (onHand, reserved int) {
+	return int(word & maxQuantity), int(word >> quantityBits)
 }
 
 /*
-	Currently available resources are stored as a map[ingredient-id]quantity
-	To prevent concurrent writes to the map, we use read-write mutex
+	Cells are spread over shards by the hash of the ingredient-id.
+	A shard's mutex guards its map - it is write-locked when a new ingredient is added,
+	all other operations just read-lock it to look up the cell, and then work on the cell lock-free.
+	Updates of a cell also read-lock its shard, so that a snapshot can hold every update off by write-locking all shards.
 */
+type shard struct {
+	mutex sync.RWMutex
+	cells map[string]*cell
+}
+
 type repositoryImpl struct {
-	mutex              sync.RWMutex
-	availableResources map[string]int
+	shards   []*shard
+	eventBus eventbus.Bus
+	clock    clock.Clock
+	// adjustmentsMutex guards adjustments, the log of every adjustment
+	adjustmentsMutex sync.Mutex
+	adjustments      []entities.Adjustment
 }
 
-func New() Repository {
-	return &repositoryImpl{
-		mutex:              sync.RWMutex{},
-		availableResources: make(map[string]int, 0),
+type Option func(m *repositoryImpl)
+
+// WithClock replaces the wall clock, which expires lots
+func WithClock(clk clock.Clock) Option {
+	return func(m *repositoryImpl) {
+		m.clock = clk
 	}
 }
 
-func (m *repositoryImpl) UpdateIngredient(ctx context.Context, updateReq UpdateRequest) (*entities.Ingredient, error) {
-	time.Sleep(1 * time.Microsecond)
+// WithEventBus publishes refills & consumption of ingredients to the bus
+func WithEventBus(bus eventbus.Bus) Option {
+	return func(m *repositoryImpl) {
+		m.eventBus = bus
+	}
+}
 
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+func New(opts ...Option) Repository {
+	shards := make([]*shard, numOfShards)
+	for idx := range shards {
+		shards[idx] = &shard{
+			mutex: sync.RWMutex{},
+			cells: make(map[string]*cell, 0),
+		}
+	}
+	m := &repositoryImpl{
+		shards:      shards,
+		clock:       clock.New(),
+		adjustments: make([]entities.Adjustment, 0),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *repositoryImpl) publish(eventType eventbus.Type, ingredientID string, quantity, onHand int) {
+	m.publishEvent(eventbus.Event{
+		Type:        eventType,
+		Ingredients: []entities.Ingredient{{ID: ingredientID, Quantity: quantity}},
+		Remaining:   []entities.Ingredient{{ID: ingredientID, Quantity: onHand}},
+	})
+}
+
+// publishEvent stamps the event with the ledger's clock, unless it's stamped already
+func (m *repositoryImpl) publishEvent(event eventbus.Event) {
+	if m.eventBus == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = m.clock.Now()
+	}
+	m.eventBus.Publish(event)
+}
+
+func (m *repositoryImpl) shardFor(ingredientID string) *shard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(ingredientID))
+	return m.shards[hash.Sum32()%numOfShards]
+}
+
+func (m *repositoryImpl) getCell(ingredientID string) (*cell, bool) {
+	s := m.shardFor(ingredientID)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c, ok := s.cells[ingredientID]
+	return c, ok
+}
+
+func (m *repositoryImpl) getOrCreateCell(ingredientID string) *cell {
+	if c, ok := m.getCell(ingredientID); ok {
+		return c
+	}
+
+	s := m.shardFor(ingredientID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.cells[ingredientID]; !ok {
+		s.cells[ingredientID] = newCell(s)
+	}
+	return s.cells[ingredientID]
+}
+
+func newCell(s *shard) *cell {
+	return &cell{shard: s, nextExpiry: math.MaxInt64}
+}
+
+// update applies fn to the quantities of the cell until the compare-and-swap succeeds, or fn fails
+func (c *cell) update(ingredientID string, fn func(onHand, reserved int) (int, int, error)) (int, error) {
+	c.shard.mutex.RLock()
+	defer c.shard.mutex.RUnlock()
+
+	// the cell was looked up before the ingredient was removed
+	if atomic.LoadInt32(&c.status) == statusRemoved {
+		return 0, entities.ErrResourceNotAvailable{ResourceID: ingredientID}
+	}
+	for {
+		old := atomic.LoadUint64(&c.word)
+		onHand, reserved := unpack(old)
+		newOnHand, newReserved, err := fn(onHand, reserved)
+		if err != nil {
+			return onHand, err
+		}
+		if newOnHand < 0 || newOnHand > maxQuantity || newReserved < 0 || newReserved > maxQuantity {
+			return onHand, entities.ErrQuantityOverflow{ResourceID: ingredientID}
+		}
+		if atomic.CompareAndSwapUint64(&c.word, old, pack(newOnHand, newReserved)) {
+			return newOnHand, nil
+		}
+	}
+}
+
+func (m *repositoryImpl) UpdateIngredient(ctx context.Context, updateReq UpdateRequest) (*entities.Ingredient, error) {
+	if err := updateReq.Validate(); err != nil {
+		return nil, err
+	}
+	var c *cell
+	var fn func(onHand, reserved int) (int, int, error)
+	// expected is the quantity on hand an adjustment replaced
+	expected := 0
 
 	switch updateReq.UpdateType {
 	case UpdateTypeConsume:
-		if val, ok := m.availableResources[updateReq.IngredientID]; !ok || val < updateReq.ResourceQuantity {
+		var ok bool
+		if c, ok = m.getCell(updateReq.IngredientID); !ok {
 			return nil, entities.ErrResourceNotAvailable{ResourceID: updateReq.IngredientID}
 		}
-
-		m.availableResources[updateReq.IngredientID] = m.availableResources[updateReq.IngredientID] - updateReq.ResourceQuantity
+		// reserved quantities are spoken for, only the rest can be consumed directly
+		fn = func(onHand, reserved int) (int, int, error) {
+			if c.deactivated() {
+				return 0, 0, entities.ErrIngredientDeactivated{ResourceID: updateReq.IngredientID}
+			}
+			if onHand-reserved < updateReq.ResourceQuantity {
+				return 0, 0, entities.ErrResourceNotAvailable{ResourceID: updateReq.IngredientID}
+			}
+			return onHand - updateReq.ResourceQuantity, reserved, nil
+		}
 	case UpdateTypeRefill:
-		m.availableResources[updateReq.IngredientID] = m.availableResources[updateReq.IngredientID] + updateReq.ResourceQuantity
+		if !updateReq.ExpiresAt.IsZero() && !m.clock.Now().Before(updateReq.ExpiresAt) {
+			return nil, entities.ErrLotExpired{ResourceID: updateReq.IngredientID, LotID: updateReq.LotID}
+		}
+		c = m.getOrCreateCell(updateReq.IngredientID)
+		fn = func(onHand, reserved int) (int, int, error) {
+			if c.deactivated() {
+				return 0, 0, entities.ErrIngredientDeactivated{ResourceID: updateReq.IngredientID}
+			}
+			return onHand + updateReq.ResourceQuantity, reserved, nil
+		}
+	case UpdateTypeAdjust:
+		c = m.getOrCreateCell(updateReq.IngredientID)
+		// reserved quantities are spoken for, so what's counted can't be less
+		fn = func(onHand, reserved int) (int, int, error) {
+			if updateReq.ResourceQuantity < reserved {
+				return 0, 0, entities.ErrBelowReserved{
+					ResourceID: updateReq.IngredientID,
+					Quantity:   updateReq.ResourceQuantity,
+					Reserved:   reserved,
+				}
+			}
+			expected = onHand
+			return updateReq.ResourceQuantity, reserved, nil
+		}
+	}
+
+	c.lotsMutex.Lock()
+	events := m.sweep(updateReq.IngredientID, c)
+	onHand, err := c.update(updateReq.IngredientID, fn)
+	if err == nil {
+		switch updateReq.UpdateType {
+		case UpdateTypeConsume:
+			// after a sweep, everything unreserved is unexpired
+			c.consumeLots(updateReq.IngredientID, updateReq.ResourceQuantity)
+		case UpdateTypeRefill:
+			c.addLot(updateReq.LotID, updateReq.ResourceQuantity, updateReq.ExpiresAt)
+		case UpdateTypeAdjust:
+			c.adjustLots(updateReq.IngredientID, onHand-expected)
+		}
 	}
+	c.lotsMutex.Unlock()
 
+	for _, event := range events {
+		m.publishEvent(event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch updateReq.UpdateType {
+	case UpdateTypeConsume:
+		m.publish(eventbus.TypeIngredientConsumed, updateReq.IngredientID, updateReq.ResourceQuantity, onHand)
+	case UpdateTypeRefill:
+		m.publish(eventbus.TypeRefilled, updateReq.IngredientID, updateReq.ResourceQuantity, onHand)
+	case UpdateTypeAdjust:
+		m.recordAdjustment(entities.Adjustment{
+			IngredientID: updateReq.IngredientID,
+			Reason:       updateReq.Reason,
+			Expected:     expected,
+			Observed:     onHand,
+			Variance:     onHand - expected,
+			At:           m.clock.Now(),
+		})
+	}
 	return &entities.Ingredient{
 		ID:       updateReq.IngredientID,
-		Quantity: m.availableResources[updateReq.IngredientID],
+		Quantity: onHand,
 	}, nil
 }
 
 func (m *repositoryImpl) GetIngredient(ctx context.Context, getReq GetRequest) (*entities.Ingredient, error) {
-	time.Sleep(1 * time.Microsecond)
-
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	if _, ok := m.availableResources[getReq.IngredientID]; !ok {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	c, ok := m.getCell(getReq.IngredientID)
+	if !ok {
 		return nil, entities.ErrResourceNotAvailable{ResourceID: getReq.IngredientID}
 	}
+	m.sweepIfDue(getReq.IngredientID, c)
+	onHand, _ := unpack(atomic.LoadUint64(&c.word))
 	return &entities.Ingredient{
 		ID:       getReq.IngredientID,
-		Quantity: m.availableResources[getReq.IngredientID],
+		Quantity: onHand,
+	}, nil
+}
+
+// GetLevels returns the quantities of the ingredient as of a single point in time
+func (m *repositoryImpl) GetLevels(ctx context.Context, getReq GetRequest) (*Levels, error) {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	c, ok := m.getCell(getReq.IngredientID)
+	if !ok {
+		return nil, entities.ErrResourceNotAvailable{ResourceID: getReq.IngredientID}
+	}
+	m.sweepIfDue(getReq.IngredientID, c)
+	onHand, reserved := unpack(atomic.LoadUint64(&c.word))
+	return &Levels{
+		IngredientID: getReq.IngredientID,
+		OnHand:       onHand,
+		Reserved:     reserved,
+		Available:    onHand - reserved,
+		Deactivated:  c.deactivated(),
+	}, nil
+}
+
+/*
+	Reserve follows these rules:
+	If the quantity is readily available [ on hand - reserved ], we reserve it.
+	If it is on hand but reserved by others, those reservations might still be released - so it's a temporary error.
+	Otherwise there just isn't enough.
+*/
+func (m *repositoryImpl) Reserve(ctx context.Context, req ReservationRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	c, ok := m.getCell(req.IngredientID)
+	if !ok {
+		return entities.ErrResourceNotAvailable{ResourceID: req.IngredientID}
+	}
+	m.sweepIfDue(req.IngredientID, c)
+
+	_, err := c.update(req.IngredientID, func(onHand, reserved int) (int, int, error) {
+		if c.deactivated() {
+			return 0, 0, entities.ErrIngredientDeactivated{ResourceID: req.IngredientID}
+		}
+		if onHand-reserved >= req.Quantity {
+			return onHand, reserved + req.Quantity, nil
+		}
+		if onHand >= req.Quantity {
+			return 0, 0, entities.ErrResourceTemporarilyNotAvailable{ResourceID: req.IngredientID}
+		}
+		return 0, 0, entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+	})
+	return err
+}
+
+/*
+	Commit consumes the reserved quantity from the unexpired lots, in FIFO order.
+	Reservations aren't tied to lots, so if lots expired after the quantity was reserved - there might not be
+	enough unexpired quantity left. Then the commit fails, and the reservation should be released.
+*/
+func (m *repositoryImpl) Commit(ctx context.Context, req ReservationRequest) (*Consumption, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	c, ok := m.getCell(req.IngredientID)
+	if !ok {
+		return nil, entities.ErrResourceNotAvailable{ResourceID: req.IngredientID}
+	}
+
+	c.lotsMutex.Lock()
+	events := m.sweep(req.IngredientID, c)
+	var lots []entities.LotUsage
+	onHand, err := c.update(req.IngredientID, func(onHand, reserved int) (int, int, error) {
+		if reserved < req.Quantity {
+			return 0, 0, entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+		}
+		if c.unexpired() < req.Quantity {
+			return 0, 0, entities.ErrLotExpired{ResourceID: req.IngredientID, LotID: c.firstExpiredLot()}
+		}
+		return onHand - req.Quantity, reserved - req.Quantity, nil
+	})
+	if err == nil {
+		lots = c.consumeLots(req.IngredientID, req.Quantity)
+	}
+	c.lotsMutex.Unlock()
+
+	for _, event := range events {
+		m.publishEvent(event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.publish(eventbus.TypeIngredientConsumed, req.IngredientID, req.Quantity, onHand)
+	return &Consumption{
+		IngredientID: req.IngredientID,
+		OnHand:       onHand,
+		Lots:         lots,
 	}, nil
 }
+
+func (m *repositoryImpl) Release(ctx context.Context, req ReservationRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	c, ok := m.getCell(req.IngredientID)
+	if !ok {
+		return entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+	}
+
+	_, err := c.update(req.IngredientID, func(onHand, reserved int) (int, int, error) {
+		if reserved < req.Quantity {
+			return 0, 0, entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+		}
+		return onHand, reserved - req.Quantity, nil
+	})
+	return err
+}
+
+func (m *repositoryImpl) ListLots(ctx context.Context, getReq GetRequest) ([]entities.Lot, error) {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	c, ok := m.getCell(getReq.IngredientID)
+	if !ok {
+		return nil, entities.ErrResourceNotAvailable{ResourceID: getReq.IngredientID}
+	}
+
+	c.lotsMutex.Lock()
+	events := m.sweep(getReq.IngredientID, c)
+	lots := make([]entities.Lot, 0, len(c.lots))
+	for _, l := range c.lots {
+		lots = append(lots, l.toEntity(getReq.IngredientID))
+	}
+	c.lotsMutex.Unlock()
+
+	for _, event := range events {
+		m.publishEvent(event)
+	}
+	return lots, nil
+}
+
+func (m *repositoryImpl) ListIngredients(ctx context.Context) ([]entities.Ingredient, error) {
+	ingredients := make([]entities.Ingredient, 0)
+	for _, ingredientID := range m.ingredientIDs() {
+		ingredient, err := m.GetIngredient(ctx, GetRequest{IngredientID: ingredientID})
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, *ingredient)
+	}
+	return ingredients, nil
+}
+
+// ingredientIDs returns the id of every ingredient, sorted
+func (m *repositoryImpl) ingredientIDs() []string {
+	ingredientIDs := make([]string, 0)
+	for _, s := range m.shards {
+		s.mutex.RLock()
+		for ingredientID := range s.cells {
+			ingredientIDs = append(ingredientIDs, ingredientID)
+		}
+		s.mutex.RUnlock()
+	}
+	sort.Strings(ingredientIDs)
+	return ingredientIDs
+}
+
+/*
+	Snapshot write-locks every shard [ in order, so snapshots never deadlock each other ], which holds off all updates
+	while the quantities are read - so no reservation, commit or refill is ever seen half way, across ingredients.
+	Updates in flight are waited for, and the ones arriving meanwhile wait for the snapshot.
+
+	Expired lots are written off before locking, so the quantities on hand exclude them as GetLevels does.
+*/
+func (m *repositoryImpl) Snapshot(ctx context.Context) (*Snapshot, error) {
+	for _, ingredientID := range m.ingredientIDs() {
+		if c, ok := m.getCell(ingredientID); ok {
+			m.sweepIfDue(ingredientID, c)
+		}
+	}
+
+	for _, s := range m.shards {
+		s.mutex.Lock()
+	}
+	levels := make([]Levels, 0)
+	for _, s := range m.shards {
+		for ingredientID, c := range s.cells {
+			onHand, reserved := unpack(atomic.LoadUint64(&c.word))
+			levels = append(levels, Levels{
+				IngredientID: ingredientID,
+				OnHand:       onHand,
+				Reserved:     reserved,
+				Available:    onHand - reserved,
+				Deactivated:  c.deactivated(),
+			})
+		}
+	}
+	takenAt := m.clock.Now()
+	for _, s := range m.shards {
+		s.mutex.Unlock()
+	}
+
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].IngredientID < levels[j].IngredientID
+	})
+	return &Snapshot{TakenAt: takenAt, Levels: levels}, nil
+}
+
+/*
+	RefillMany applies the refills atomically - either all of them, or none if one is invalid. The cells are
+	locked in the order of ingredient-ids, and then their shards are write-locked like Snapshot does,
+	so that no reservation or snapshot ever sees only some of the refills.
+
+	It returns the quantity on hand of every refilled ingredient, sorted by id.
+*/
+func (m *repositoryImpl) RefillMany(ctx context.Context, refillReqs []RefillRequest) ([]entities.Ingredient, error) {
+	now := m.clock.Now()
+	cells := make(map[string]*cell, len(refillReqs))
+	for _, req := range refillReqs {
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		if !req.ExpiresAt.IsZero() && !now.Before(req.ExpiresAt) {
+			return nil, entities.ErrLotExpired{ResourceID: req.IngredientID, LotID: req.LotID}
+		}
+		if _, ok := cells[req.IngredientID]; !ok {
+			cells[req.IngredientID] = m.getOrCreateCell(req.IngredientID)
+		}
+	}
+	ingredientIDs := make([]string, 0, len(cells))
+	for ingredientID := range cells {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	sort.Strings(ingredientIDs)
+
+	events := make([]eventbus.Event, 0)
+	for _, ingredientID := range ingredientIDs {
+		c := cells[ingredientID]
+		c.lotsMutex.Lock()
+		events = append(events, m.sweep(ingredientID, c)...)
+	}
+	onHands, err := m.refillAll(refillReqs, cells)
+	if err == nil {
+		for _, req := range refillReqs {
+			cells[req.IngredientID].addLot(req.LotID, req.Quantity, req.ExpiresAt)
+		}
+	}
+	for _, ingredientID := range ingredientIDs {
+		cells[ingredientID].lotsMutex.Unlock()
+	}
+
+	for _, event := range events {
+		m.publishEvent(event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for idx, req := range refillReqs {
+		m.publish(eventbus.TypeRefilled, req.IngredientID, req.Quantity, onHands[idx])
+	}
+	ingredients := make([]entities.Ingredient, 0, len(ingredientIDs))
+	for _, ingredientID := range ingredientIDs {
+		onHand, _ := unpack(atomic.LoadUint64(&cells[ingredientID].word))
+		ingredients = append(ingredients, entities.Ingredient{ID: ingredientID, Quantity: onHand})
+	}
+	return ingredients, nil
+}
+
+// refillAll adds up the refills with the shards of the cells write-locked, and returns the quantity on hand after each refill
+func (m *repositoryImpl) refillAll(refillReqs []RefillRequest, cells map[string]*cell) ([]int, error) {
+	locked := make([]*shard, 0)
+	for _, s := range m.shards {
+		for _, c := range cells {
+			if c.shard == s {
+				s.mutex.Lock()
+				locked = append(locked, s)
+				break
+			}
+		}
+	}
+	defer func() {
+		for _, s := range locked {
+			s.mutex.Unlock()
+		}
+	}()
+
+	words := make(map[string]uint64, len(cells))
+	for ingredientID, c := range cells {
+		switch atomic.LoadInt32(&c.status) {
+		case statusDeactivated:
+			return nil, entities.ErrIngredientDeactivated{ResourceID: ingredientID}
+		case statusRemoved:
+			return nil, entities.ErrResourceNotAvailable{ResourceID: ingredientID}
+		}
+		words[ingredientID] = atomic.LoadUint64(&c.word)
+	}
+	onHands := make([]int, 0, len(refillReqs))
+	for _, req := range refillReqs {
+		onHand, reserved := unpack(words[req.IngredientID])
+		onHand += req.Quantity
+		if onHand < 0 || onHand > maxQuantity {
+			return nil, entities.ErrQuantityOverflow{ResourceID: req.IngredientID}
+		}
+		words[req.IngredientID] = pack(onHand, reserved)
+		onHands = append(onHands, onHand)
+	}
+	for ingredientID, word := range words {
+		atomic.StoreUint64(&cells[ingredientID].word, word)
+	}
+	return onHands, nil
+}
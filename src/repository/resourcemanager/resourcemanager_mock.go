@@ -63,3 +63,178 @@ func (mr *MockRepositoryMockRecorder) GetIngredient(ctx, getReq interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIngredient", reflect.TypeOf((*MockRepository)(nil).GetIngredient), ctx, getReq)
 }
+
+// GetLevels mocks base method
+func (m *MockRepository) GetLevels(ctx context.Context, getReq GetRequest) (*Levels, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLevels", ctx, getReq)
+	ret0, _ := ret[0].(*Levels)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLevels indicates an expected call of GetLevels
+func (mr *MockRepositoryMockRecorder) GetLevels(ctx, getReq interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLevels", reflect.TypeOf((*MockRepository)(nil).GetLevels), ctx, getReq)
+}
+
+// Reserve mocks base method
+func (m *MockRepository) Reserve(ctx context.Context, req ReservationRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reserve indicates an expected call of Reserve
+func (mr *MockRepositoryMockRecorder) Reserve(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockRepository)(nil).Reserve), ctx, req)
+}
+
+// Commit mocks base method
+func (m *MockRepository) Commit(ctx context.Context, req ReservationRequest) (*Consumption, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", ctx, req)
+	ret0, _ := ret[0].(*Consumption)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Commit indicates an expected call of Commit
+func (mr *MockRepositoryMockRecorder) Commit(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockRepository)(nil).Commit), ctx, req)
+}
+
+// Release mocks base method
+func (m *MockRepository) Release(ctx context.Context, req ReservationRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release
+func (mr *MockRepositoryMockRecorder) Release(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockRepository)(nil).Release), ctx, req)
+}
+
+// ListLots mocks base method
+func (m *MockRepository) ListLots(ctx context.Context, getReq GetRequest) ([]entities.Lot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLots", ctx, getReq)
+	ret0, _ := ret[0].([]entities.Lot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLots indicates an expected call of ListLots
+func (mr *MockRepositoryMockRecorder) ListLots(ctx, getReq interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLots", reflect.TypeOf((*MockRepository)(nil).ListLots), ctx, getReq)
+}
+
+// ListIngredients mocks base method
+func (m *MockRepository) ListIngredients(ctx context.Context) ([]entities.Ingredient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListIngredients", ctx)
+	ret0, _ := ret[0].([]entities.Ingredient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListIngredients indicates an expected call of ListIngredients
+func (mr *MockRepositoryMockRecorder) ListIngredients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListIngredients", reflect.TypeOf((*MockRepository)(nil).ListIngredients), ctx)
+}
+
+// Snapshot mocks base method
+func (m *MockRepository) Snapshot(ctx context.Context) (*Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Snapshot", ctx)
+	ret0, _ := ret[0].(*Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Snapshot indicates an expected call of Snapshot
+func (mr *MockRepositoryMockRecorder) Snapshot(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockRepository)(nil).Snapshot), ctx)
+}
+
+// RefillMany mocks base method
+func (m *MockRepository) RefillMany(ctx context.Context, refillReqs []RefillRequest) ([]entities.Ingredient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefillMany", ctx, refillReqs)
+	ret0, _ := ret[0].([]entities.Ingredient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefillMany indicates an expected call of RefillMany
+func (mr *MockRepositoryMockRecorder) RefillMany(ctx, refillReqs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefillMany", reflect.TypeOf((*MockRepository)(nil).RefillMany), ctx, refillReqs)
+}
+
+// ListAdjustments mocks base method
+func (m *MockRepository) ListAdjustments(ctx context.Context) ([]entities.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAdjustments", ctx)
+	ret0, _ := ret[0].([]entities.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAdjustments indicates an expected call of ListAdjustments
+func (mr *MockRepositoryMockRecorder) ListAdjustments(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAdjustments", reflect.TypeOf((*MockRepository)(nil).ListAdjustments), ctx)
+}
+
+// AddIngredient mocks base method
+func (m *MockRepository) AddIngredient(ctx context.Context, req IngredientRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddIngredient", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddIngredient indicates an expected call of AddIngredient
+func (mr *MockRepositoryMockRecorder) AddIngredient(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddIngredient", reflect.TypeOf((*MockRepository)(nil).AddIngredient), ctx, req)
+}
+
+// DeactivateIngredient mocks base method
+func (m *MockRepository) DeactivateIngredient(ctx context.Context, req IngredientRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeactivateIngredient", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeactivateIngredient indicates an expected call of DeactivateIngredient
+func (mr *MockRepositoryMockRecorder) DeactivateIngredient(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeactivateIngredient", reflect.TypeOf((*MockRepository)(nil).DeactivateIngredient), ctx, req)
+}
+
+// RemoveIngredient mocks base method
+func (m *MockRepository) RemoveIngredient(ctx context.Context, req IngredientRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveIngredient", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveIngredient indicates an expected call of RemoveIngredient
+func (mr *MockRepositoryMockRecorder) RemoveIngredient(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveIngredient", reflect.TypeOf((*MockRepository)(nil).RemoveIngredient), ctx, req)
+}
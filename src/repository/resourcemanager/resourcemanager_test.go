@@ -3,9 +3,12 @@ package resourcemanager
 import (
 	"coffeeMachine/src/entities"
 	"context"
-	"github.com/stretchr/testify/assert"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNew(t *testing.T) {
@@ -19,8 +22,10 @@ func TestNew(t *testing.T) {
 				assert.NotNil(t, repository)
 				assert.IsType(t, &repositoryImpl{}, repository)
 				concreteRepositoryImpl := repository.(*repositoryImpl)
-				assert.NotNil(t, concreteRepositoryImpl.availableResources)
-				assert.NotNil(t, concreteRepositoryImpl.mutex)
+				assert.Len(t, concreteRepositoryImpl.shards, numOfShards)
+				for _, s := range concreteRepositoryImpl.shards {
+					assert.NotNil(t, s.cells)
+				}
 			},
 		},
 	}
@@ -32,11 +37,21 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// newWithQuantities returns a repository holding the given on-hand and reserved quantities
+func newWithQuantities(onHand map[string]int, reserved map[string]int) *repositoryImpl {
+	m := New().(*repositoryImpl)
+	for ingredientID, quantity := range onHand {
+		c := m.getOrCreateCell(ingredientID)
+		c.word = pack(quantity, reserved[ingredientID])
+		c.addLot("", quantity, time.Time{})
+	}
+	return m
+}
+
 func Test_managerImpl_GetIngredient(t *testing.T) {
 	ctx := context.Background()
 
 	type fields struct {
-		mutex              map[string]*sync.RWMutex
 		availableResources map[string]int
 	}
 	type args struct {
@@ -48,7 +63,6 @@ func Test_managerImpl_GetIngredient(t *testing.T) {
 		_IngredientID = "Ingredient1234"
 	)
 
-	mutexes := make(map[string]*sync.RWMutex, 0)
 	tests := []struct {
 		name   string
 		fields fields
@@ -67,12 +81,12 @@ func Test_managerImpl_GetIngredient(t *testing.T) {
 				availableResources: map[string]int{
 					_IngredientID: 5,
 				},
-				mutex: mutexes,
 			},
 			assert: func(ingredient *entities.Ingredient, err error) {
 				assert.NoError(t, err)
 				assert.NotNil(t, ingredient)
 				assert.Equal(t, _IngredientID, ingredient.ID)
+				assert.Equal(t, 5, ingredient.Quantity)
 			},
 		},
 		{
@@ -85,20 +99,16 @@ func Test_managerImpl_GetIngredient(t *testing.T) {
 			},
 			fields: fields{
 				availableResources: make(map[string]int, 0),
-				mutex:              mutexes,
 			},
 			assert: func(ingredient *entities.Ingredient, err error) {
-				assert.EqualError(t, err, entities.ErrResourceNotAvailable.Error())
+				assert.EqualError(t, err, entities.ErrResourceNotAvailable{ResourceID: _IngredientID}.Error())
 				assert.Nil(t, ingredient)
 			},
 		},
 	}
 	for _, testIdx := range tests {
 		tt := testIdx
-		m := &repositoryImpl{
-			mutex:              tt.fields.mutex,
-			availableResources: tt.fields.availableResources,
-		}
+		m := newWithQuantities(tt.fields.availableResources, nil)
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			got, err := m.GetIngredient(tt.args.ctx, tt.args.getReq)
@@ -111,8 +121,8 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 	ctx := context.Background()
 
 	type fields struct {
-		mutex              map[string]*sync.RWMutex
 		availableResources map[string]int
+		reservedResources  map[string]int
 	}
 	type args struct {
 		ctx       context.Context
@@ -123,12 +133,11 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 		_IngredientID = "Ingredient1234"
 	)
 
-	mutexes := make(map[string]*sync.RWMutex, 0)
 	tests := []struct {
 		name   string
 		fields fields
 		args   args
-		assert func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error)
+		assert func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error)
 	}{
 		{
 			name: "success | update-action = refill, new ingredient",
@@ -141,10 +150,9 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 				},
 			},
 			fields: fields{
-				mutex:              mutexes,
 				availableResources: map[string]int{},
 			},
-			assert: func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error) {
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
 				assert.NoError(t, err)
 				assert.NotNil(t, ingredient)
 				assert.Equal(t, 5, ingredient.Quantity)
@@ -161,19 +169,39 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 				},
 			},
 			fields: fields{
-				mutex: mutexes,
 				availableResources: map[string]int{
 					_IngredientID: 5,
 				},
 			},
-			assert: func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error) {
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
 				assert.NoError(t, err)
 				assert.NotNil(t, ingredient)
 				assert.Equal(t, 10, ingredient.Quantity)
 			},
 		},
 		{
-			name: "success | update-action = consume, ingredient not already present",
+			name: "error | update-action = refill, quantity overflows",
+			args: args{
+				ctx: ctx,
+				updateReq: UpdateRequest{
+					IngredientID:     _IngredientID,
+					UpdateType:       UpdateTypeRefill,
+					ResourceQuantity: maxQuantity,
+				},
+			},
+			fields: fields{
+				availableResources: map[string]int{
+					_IngredientID: 5,
+				},
+			},
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
+				assert.IsType(t, entities.ErrQuantityOverflow{}, err)
+				got, _ := repositoryImpl.GetIngredient(ctx, GetRequest{IngredientID: _IngredientID})
+				assert.Equal(t, 5, got.Quantity)
+			},
+		},
+		{
+			name: "error | update-action = consume, ingredient not already present",
 			args: args{
 				ctx: ctx,
 				updateReq: UpdateRequest{
@@ -183,11 +211,10 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 				},
 			},
 			fields: fields{
-				mutex:              mutexes,
 				availableResources: map[string]int{},
 			},
-			assert: func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error) {
-				assert.EqualError(t, err, entities.ErrResourceNotAvailable.Error())
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
+				assert.EqualError(t, err, entities.ErrResourceNotAvailable{ResourceID: _IngredientID}.Error())
 			},
 		},
 		{
@@ -201,12 +228,11 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 				},
 			},
 			fields: fields{
-				mutex: mutexes,
 				availableResources: map[string]int{
 					_IngredientID: 10,
 				},
 			},
-			assert: func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error) {
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
 				assert.NoError(t, err)
 				assert.Equal(t, 5, ingredient.Quantity)
 			},
@@ -222,24 +248,43 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 				},
 			},
 			fields: fields{
-				mutex: mutexes,
 				availableResources: map[string]int{
 					_IngredientID: 5,
 				},
 			},
-			assert: func(repositoryImpl repositoryImpl, ingredient *entities.Ingredient, err error) {
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
+				assert.NoError(t, err)
+				got, err := repositoryImpl.GetIngredient(ctx, GetRequest{IngredientID: _IngredientID})
 				assert.NoError(t, err)
-				assert.NotContains(t, repositoryImpl.availableResources, _IngredientID)
-				assert.NotContains(t, repositoryImpl.mutex, _IngredientID)
+				assert.Equal(t, 0, got.Quantity)
+			},
+		},
+		{
+			name: "error | update-action = consume, quantity is reserved",
+			args: args{
+				ctx: ctx,
+				updateReq: UpdateRequest{
+					IngredientID:     _IngredientID,
+					UpdateType:       UpdateTypeConsume,
+					ResourceQuantity: 5,
+				},
+			},
+			fields: fields{
+				availableResources: map[string]int{
+					_IngredientID: 8,
+				},
+				reservedResources: map[string]int{
+					_IngredientID: 4,
+				},
+			},
+			assert: func(repositoryImpl *repositoryImpl, ingredient *entities.Ingredient, err error) {
+				assert.IsType(t, entities.ErrResourceNotAvailable{}, err)
 			},
 		},
 	}
 	for _, testIdx := range tests {
 		tt := testIdx
-		m := repositoryImpl{
-			mutex:              tt.fields.mutex,
-			availableResources: tt.fields.availableResources,
-		}
+		m := newWithQuantities(tt.fields.availableResources, tt.fields.reservedResources)
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			got, err := m.UpdateIngredient(tt.args.ctx, tt.args.updateReq)
@@ -247,3 +292,382 @@ func Test_managerImpl_UpdateIngredient(t *testing.T) {
 		})
 	}
 }
+
+func Test_repositoryImpl_GetLevels(t *testing.T) {
+	ctx := context.Background()
+
+	const _IngredientID = "Ingredient1234"
+
+	tests := []struct {
+		name    string
+		onHand  map[string]int
+		want    *Levels
+		wantErr error
+	}{
+		{
+			name:   "success | partly reserved",
+			onHand: map[string]int{_IngredientID: 10},
+			want:   &Levels{IngredientID: _IngredientID, OnHand: 10, Reserved: 6, Available: 4},
+		},
+		{
+			name:    "error | unknown ingredient",
+			onHand:  map[string]int{},
+			wantErr: entities.ErrResourceNotAvailable{ResourceID: _IngredientID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWithQuantities(tt.onHand, map[string]int{_IngredientID: 6})
+			got, err := m.GetLevels(ctx, GetRequest{IngredientID: _IngredientID})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_repositoryImpl_ListIngredientsAndSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		onHand          map[string]int
+		reserved        map[string]int
+		wantIngredients []entities.Ingredient
+		wantLevels      []Levels
+	}{
+		{
+			name:     "success | sorted by id",
+			onHand:   map[string]int{"water": 10, "milk": 5, "sugar": 0},
+			reserved: map[string]int{"water": 4},
+			wantIngredients: []entities.Ingredient{
+				{ID: "milk", Quantity: 5},
+				{ID: "sugar", Quantity: 0},
+				{ID: "water", Quantity: 10},
+			},
+			wantLevels: []Levels{
+				{IngredientID: "milk", OnHand: 5, Available: 5},
+				{IngredientID: "sugar"},
+				{IngredientID: "water", OnHand: 10, Reserved: 4, Available: 6},
+			},
+		},
+		{
+			name:            "success | empty",
+			onHand:          map[string]int{},
+			wantIngredients: []entities.Ingredient{},
+			wantLevels:      []Levels{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWithQuantities(tt.onHand, tt.reserved)
+			ingredients, err := m.ListIngredients(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantIngredients, ingredients)
+
+			snapshot, err := m.Snapshot(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLevels, snapshot.Levels)
+			assert.False(t, snapshot.TakenAt.IsZero())
+		})
+	}
+}
+
+func Test_repositoryImpl_RefillMany(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		refillReqs []RefillRequest
+		want       []entities.Ingredient
+		wantErr    error
+		wantLevels []Levels
+	}{
+		{
+			name: "success | new & existing ingredients, sorted by id",
+			refillReqs: []RefillRequest{
+				{IngredientID: "water", Quantity: 100},
+				{IngredientID: "ginger_syrup", Quantity: 50, LotID: "G-1"},
+				{IngredientID: "water", Quantity: 20},
+			},
+			want: []entities.Ingredient{{ID: "ginger_syrup", Quantity: 50}, {ID: "water", Quantity: 130}},
+			wantLevels: []Levels{
+				{IngredientID: "ginger_syrup", OnHand: 50, Available: 50},
+				{IngredientID: "milk", OnHand: 5, Available: 5},
+				{IngredientID: "water", OnHand: 130, Reserved: 4, Available: 126},
+			},
+		},
+		{
+			name: "error | overflow, nothing refilled",
+			refillReqs: []RefillRequest{
+				{IngredientID: "milk", Quantity: 100},
+				{IngredientID: "water", Quantity: maxQuantity},
+			},
+			wantErr: entities.ErrQuantityOverflow{ResourceID: "water"},
+			wantLevels: []Levels{
+				{IngredientID: "milk", OnHand: 5, Available: 5},
+				{IngredientID: "water", OnHand: 10, Reserved: 4, Available: 6},
+			},
+		},
+		{
+			name: "error | lot already expired, nothing refilled",
+			refillReqs: []RefillRequest{
+				{IngredientID: "milk", Quantity: 100},
+				{IngredientID: "water", Quantity: 100, LotID: "W-1", ExpiresAt: time.Unix(1, 0)},
+			},
+			wantErr: entities.ErrLotExpired{ResourceID: "water", LotID: "W-1"},
+			wantLevels: []Levels{
+				{IngredientID: "milk", OnHand: 5, Available: 5},
+				{IngredientID: "water", OnHand: 10, Reserved: 4, Available: 6},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWithQuantities(map[string]int{"water": 10, "milk": 5}, map[string]int{"water": 4})
+			got, err := m.RefillMany(ctx, tt.refillReqs)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+
+			snapshot, _ := m.Snapshot(ctx)
+			assert.Equal(t, tt.wantLevels, snapshot.Levels)
+		})
+	}
+}
+
+func Test_repositoryImpl_RefillMany_Snapshot(t *testing.T) {
+	ctx := context.Background()
+
+	m := New()
+	refillReqs := []RefillRequest{{IngredientID: "milk", Quantity: 1}, {IngredientID: "water", Quantity: 1}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_, _ = m.RefillMany(ctx, refillReqs)
+		}
+	}()
+
+	// both ingredients are always refilled together, so a snapshot never sees them apart
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		snapshot, err := m.Snapshot(ctx)
+		assert.NoError(t, err)
+		if len(snapshot.Levels) == 2 {
+			assert.Equal(t, snapshot.Levels[0].OnHand, snapshot.Levels[1].OnHand)
+		}
+	}
+}
+
+func Test_repositoryImpl_Reserve(t *testing.T) {
+	ctx := context.Background()
+
+	const _IngredientID = "Ingredient1234"
+
+	tests := []struct {
+		name     string
+		onHand   map[string]int
+		reserved map[string]int
+		req      ReservationRequest
+		assert   func(m *repositoryImpl, err error)
+	}{
+		{
+			name:   "success | quantity readily available",
+			onHand: map[string]int{_IngredientID: 10},
+			req:    ReservationRequest{IngredientID: _IngredientID, Quantity: 5},
+			assert: func(m *repositoryImpl, err error) {
+				assert.NoError(t, err)
+				levels, _ := m.GetLevels(ctx, GetRequest{IngredientID: _IngredientID})
+				// reserving doesn't change the quantity on hand
+				assert.Equal(t, &Levels{IngredientID: _IngredientID, OnHand: 10, Reserved: 5, Available: 5}, levels)
+			},
+		},
+		{
+			name:     "error | quantity on hand, but reserved by others",
+			onHand:   map[string]int{_IngredientID: 10},
+			reserved: map[string]int{_IngredientID: 6},
+			req:      ReservationRequest{IngredientID: _IngredientID, Quantity: 5},
+			assert: func(m *repositoryImpl, err error) {
+				assert.IsType(t, entities.ErrResourceTemporarilyNotAvailable{}, err)
+			},
+		},
+		{
+			name:   "error | quantity not on hand",
+			onHand: map[string]int{_IngredientID: 4},
+			req:    ReservationRequest{IngredientID: _IngredientID, Quantity: 5},
+			assert: func(m *repositoryImpl, err error) {
+				assert.IsType(t, entities.ErrInsufficientResource{}, err)
+			},
+		},
+		{
+			name:   "error | unknown ingredient",
+			onHand: map[string]int{},
+			req:    ReservationRequest{IngredientID: _IngredientID, Quantity: 5},
+			assert: func(m *repositoryImpl, err error) {
+				assert.IsType(t, entities.ErrResourceNotAvailable{}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWithQuantities(tt.onHand, tt.reserved)
+			err := m.Reserve(ctx, tt.req)
+			tt.assert(m, err)
+		})
+	}
+}
+
+func Test_repositoryImpl_CommitAndRelease(t *testing.T) {
+	ctx := context.Background()
+
+	const _IngredientID = "Ingredient1234"
+
+	tests := []struct {
+		name   string
+		action func(m *repositoryImpl) error
+		assert func(m *repositoryImpl, err error)
+	}{
+		{
+			name: "success | commit consumes the reserved quantity",
+			action: func(m *repositoryImpl) error {
+				_, err := m.Commit(ctx, ReservationRequest{IngredientID: _IngredientID, Quantity: 4})
+				return err
+			},
+			assert: func(m *repositoryImpl, err error) {
+				assert.NoError(t, err)
+				onHand, reserved := unpack(m.getOrCreateCell(_IngredientID).word)
+				assert.Equal(t, 6, onHand)
+				assert.Equal(t, 2, reserved)
+			},
+		},
+		{
+			name: "error | commit more than reserved",
+			action: func(m *repositoryImpl) error {
+				_, err := m.Commit(ctx, ReservationRequest{IngredientID: _IngredientID, Quantity: 7})
+				return err
+			},
+			assert: func(m *repositoryImpl, err error) {
+				assert.IsType(t, entities.ErrInsufficientResource{}, err)
+			},
+		},
+		{
+			name: "success | release keeps the quantity on hand",
+			action: func(m *repositoryImpl) error {
+				return m.Release(ctx, ReservationRequest{IngredientID: _IngredientID, Quantity: 6})
+			},
+			assert: func(m *repositoryImpl, err error) {
+				assert.NoError(t, err)
+				onHand, reserved := unpack(m.getOrCreateCell(_IngredientID).word)
+				assert.Equal(t, 10, onHand)
+				assert.Equal(t, 0, reserved)
+			},
+		},
+		{
+			name: "error | release more than reserved",
+			action: func(m *repositoryImpl) error {
+				return m.Release(ctx, ReservationRequest{IngredientID: _IngredientID, Quantity: 7})
+			},
+			assert: func(m *repositoryImpl, err error) {
+				assert.IsType(t, entities.ErrInsufficientResource{}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWithQuantities(map[string]int{_IngredientID: 10}, map[string]int{_IngredientID: 6})
+			err := tt.action(m)
+			tt.assert(m, err)
+		})
+	}
+}
+
+func Test_repositoryImpl_ConcurrentReservations(t *testing.T) {
+	ctx := context.Background()
+
+	const _IngredientID = "Ingredient1234"
+	m := newWithQuantities(map[string]int{_IngredientID: 100}, nil)
+
+	// 200 concurrent reservations of 1 unit, exactly 100 of them can succeed
+	succeeded := make(chan bool, 200)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := ReservationRequest{IngredientID: _IngredientID, Quantity: 1}
+			if err := m.Reserve(ctx, req); err != nil {
+				succeeded <- false
+				return
+			}
+			_, err := m.Commit(ctx, req)
+			succeeded <- err == nil
+		}()
+	}
+	wg.Wait()
+	close(succeeded)
+
+	cnt := 0
+	for ok := range succeeded {
+		if ok {
+			cnt += 1
+		}
+	}
+	assert.Equal(t, 100, cnt)
+	onHand, reserved := unpack(m.getOrCreateCell(_IngredientID).word)
+	assert.Equal(t, 0, onHand)
+	assert.Equal(t, 0, reserved)
+}
+
+func BenchmarkRepository_ReserveAndRelease(b *testing.B) {
+	ctx := context.Background()
+
+	for _, numOfIngredients := range []int{1, 16} {
+		b.Run(strconv.Itoa(numOfIngredients)+"_ingredients", func(b *testing.B) {
+			m := New().(*repositoryImpl)
+			ingredientIDs := make([]string, numOfIngredients)
+			for idx := range ingredientIDs {
+				ingredientIDs[idx] = "ingredient" + strconv.Itoa(idx)
+				c := m.getOrCreateCell(ingredientIDs[idx])
+				c.word = pack(maxQuantity, 0)
+				c.addLot("", maxQuantity, time.Time{})
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				idx := 0
+				for pb.Next() {
+					req := ReservationRequest{IngredientID: ingredientIDs[idx%numOfIngredients], Quantity: 1}
+					if err := m.Reserve(ctx, req); err == nil {
+						_ = m.Release(ctx, req)
+					}
+					idx += 1
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRepository_UpdateIngredient(b *testing.B) {
+	ctx := context.Background()
+
+	m := New()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		idx := 0
+		for pb.Next() {
+			updateType := UpdateType(UpdateTypeRefill)
+			if idx%2 == 1 {
+				updateType = UpdateTypeConsume
+			}
+			_, _ = m.UpdateIngredient(ctx, UpdateRequest{
+				IngredientID:     "ingredient" + strconv.Itoa(idx%16),
+				UpdateType:       updateType,
+				ResourceQuantity: 1,
+			})
+			idx += 1
+		}
+	})
+}
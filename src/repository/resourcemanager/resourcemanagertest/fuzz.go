@@ -0,0 +1,188 @@
+package resourcemanagertest
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+	Fuzz feeds ledgers of the factory random requests, and checks after each one that the ledger still holds:
+	no quantity is negative or more than MaxQuantity, nothing more is reserved than is on hand, invalid requests
+	fail with the error of their Validate and change nothing, and valid ones change the levels as they should.
+
+		func FuzzLedger(f *testing.F) {
+			resourcemanagertest.Fuzz(f, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+				return NewLedger(openDB(t), WithClock(clk), WithEventBus(bus))
+			})
+		}
+
+	Every request is 3 bytes - the operation, the ingredient [ milk, water, or none ] and a signed quantity,
+	where 127 stands for MaxQuantity + 1.
+*/
+func Fuzz(f *testing.F, factory Factory) {
+	f.Add([]byte{4, 0, 100, 0, 0, 40, 1, 0, 20, 2, 0, 20})
+	f.Add([]byte{4, 0, 100, 0, 0, 0xce, 3, 0, 0x80, 5, 0, 10, 3, 1, 1})
+	f.Add([]byte{6, 1, 50, 6, 0, 0xff, 7, 0, 10, 0, 2, 10, 4, 0, 127})
+	f.Add([]byte{4, 0, 0, 5, 0, 0, 0, 0, 127, 5, 1, 127})
+
+	f.Fuzz(func(t *testing.T, requests []byte) {
+		m := factory(t, clock.NewFake(Start), nil)
+		for i := 0; i+3 <= len(requests); i += 3 {
+			op := fuzzOp{kind: requests[i] % 8, ingredientID: fuzzIngredients[int(requests[i+1])%len(fuzzIngredients)]}
+			op.quantity = int(int8(requests[i+2]))
+			if op.quantity == 127 {
+				op.quantity = resourcemanager.MaxQuantity + 1
+			}
+
+			before := levelsByID(t, m)
+			err := op.apply(m)
+			after := levelsByID(t, m)
+			for ingredientID, got := range after {
+				if !assert.True(t, got.OnHand >= 0 && got.OnHand <= resourcemanager.MaxQuantity, "%s on hand %d", ingredientID, got.OnHand) ||
+					!assert.True(t, got.Reserved >= 0 && got.Reserved <= got.OnHand, "%s reserved %d of %d", ingredientID, got.Reserved, got.OnHand) ||
+					!assert.Equal(t, got.OnHand-got.Reserved, got.Available) {
+					return
+				}
+			}
+			if validateErr := op.validate(); validateErr != nil {
+				if !assert.Equal(t, validateErr, err, "%+v", op) || !assert.Equal(t, before, after, "%+v", op) {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				if !assert.Equal(t, before, after, "%+v failed with %v", op, err) {
+					return
+				}
+				continue
+			}
+			if !assert.Equal(t, op.expect(before), after, "%+v", op) {
+				return
+			}
+		}
+	})
+}
+
+var fuzzIngredients = []string{"milk", "water", ""}
+
+// fuzzOp is a single request of Fuzz
+type fuzzOp struct {
+	kind         byte
+	ingredientID string
+	quantity     int
+}
+
+func (op fuzzOp) reservation() resourcemanager.ReservationRequest {
+	return resourcemanager.ReservationRequest{IngredientID: op.ingredientID, Quantity: op.quantity}
+}
+
+func (op fuzzOp) update() resourcemanager.UpdateRequest {
+	updateTypes := map[byte]resourcemanager.UpdateType{
+		3: resourcemanager.UpdateTypeConsume,
+		4: resourcemanager.UpdateTypeRefill,
+		5: resourcemanager.UpdateTypeAdjust,
+		7: "DRAIN",
+	}
+	return resourcemanager.UpdateRequest{
+		IngredientID:     op.ingredientID,
+		UpdateType:       updateTypes[op.kind],
+		ResourceQuantity: op.quantity,
+		Reason:           entities.AdjustReasonStockTake,
+	}
+}
+
+// refills of kind 6 refill a unit of water along with the ingredient
+func (op fuzzOp) refills() []resourcemanager.RefillRequest {
+	return []resourcemanager.RefillRequest{
+		{IngredientID: op.ingredientID, Quantity: op.quantity},
+		{IngredientID: "water", Quantity: 1},
+	}
+}
+
+func (op fuzzOp) validate() error {
+	switch op.kind {
+	case 0, 1, 2:
+		return op.reservation().Validate()
+	case 6:
+		for _, req := range op.refills() {
+			if err := req.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return op.update().Validate()
+	}
+}
+
+func (op fuzzOp) apply(m resourcemanager.Repository) error {
+	ctx := context.Background()
+	var err error
+	switch op.kind {
+	case 0:
+		err = m.Reserve(ctx, op.reservation())
+	case 1:
+		_, err = m.Commit(ctx, op.reservation())
+	case 2:
+		err = m.Release(ctx, op.reservation())
+	case 6:
+		_, err = m.RefillMany(ctx, op.refills())
+	default:
+		_, err = m.UpdateIngredient(ctx, op.update())
+	}
+	return err
+}
+
+// expect returns the levels after the request succeeded, nothing expires since the clock stands still
+func (op fuzzOp) expect(before map[string]resourcemanager.Levels) map[string]resourcemanager.Levels {
+	want := make(map[string]resourcemanager.Levels, len(before)+2)
+	for ingredientID, levels := range before {
+		want[ingredientID] = levels
+	}
+	change := func(ingredientID string, fn func(levels *resourcemanager.Levels)) {
+		levels := want[ingredientID]
+		levels.IngredientID = ingredientID
+		fn(&levels)
+		levels.Available = levels.OnHand - levels.Reserved
+		want[ingredientID] = levels
+	}
+
+	switch op.kind {
+	case 0:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) { levels.Reserved += op.quantity })
+	case 1:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) {
+			levels.OnHand -= op.quantity
+			levels.Reserved -= op.quantity
+		})
+	case 2:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) { levels.Reserved -= op.quantity })
+	case 3:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) { levels.OnHand -= op.quantity })
+	case 4:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) { levels.OnHand += op.quantity })
+	case 5:
+		change(op.ingredientID, func(levels *resourcemanager.Levels) { levels.OnHand = op.quantity })
+	case 6:
+		for _, req := range op.refills() {
+			quantity := req.Quantity
+			change(req.IngredientID, func(levels *resourcemanager.Levels) { levels.OnHand += quantity })
+		}
+	}
+	return want
+}
+
+func levelsByID(t *testing.T, m resourcemanager.Repository) map[string]resourcemanager.Levels {
+	snapshot, err := m.Snapshot(context.Background())
+	assert.NoError(t, err)
+	levels := make(map[string]resourcemanager.Levels)
+	for _, l := range snapshot.Levels {
+		levels[l.IngredientID] = l
+	}
+	return levels
+}
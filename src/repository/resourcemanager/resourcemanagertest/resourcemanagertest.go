@@ -0,0 +1,637 @@
+/*
+	Package resourcemanagertest is the conformance suite of resourcemanager.Repository - any ledger, in memory,
+	in a database or remote, runs it to prove that it behaves like the in-memory one:
+
+		func TestConformance(t *testing.T) {
+			resourcemanagertest.Run(t, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+				return NewLedger(openDB(t), WithClock(clk), WithEventBus(bus))
+			})
+		}
+*/
+package resourcemanagertest
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Start is the time of the fake clock every ledger starts on
+var Start = time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+// Factory returns an empty ledger on the given clock, publishing to the bus - which may be nil
+type Factory func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository
+
+// Run runs every test of the suite on ledgers of the factory, each on a ledger of its own
+func Run(t *testing.T, factory Factory) {
+	t.Run("Updates", func(t *testing.T) { testUpdates(t, factory) })
+	t.Run("Lots", func(t *testing.T) { testLots(t, factory) })
+	t.Run("Adjustments", func(t *testing.T) { testAdjustments(t, factory) })
+	t.Run("RefillMany", func(t *testing.T) { testRefillMany(t, factory) })
+	t.Run("Lifecycle", func(t *testing.T) { testLifecycle(t, factory) })
+	t.Run("Snapshot", func(t *testing.T) { testSnapshot(t, factory) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, factory) })
+	t.Run("Validation", func(t *testing.T) { testValidation(t, factory) })
+	t.Run("ConcurrentReservations", func(t *testing.T) { testConcurrentReservations(t, factory) })
+	t.Run("ConcurrentSnapshots", func(t *testing.T) { testConcurrentSnapshots(t, factory) })
+}
+
+// Refill refills the ledger with an anonymous lot, it panics if the refill fails
+func Refill(ledger resourcemanager.Repository, ingredientID string, quantity int) {
+	updateReq := resourcemanager.UpdateRequest{IngredientID: ingredientID, UpdateType: resourcemanager.UpdateTypeRefill, ResourceQuantity: quantity}
+	if _, err := ledger.UpdateIngredient(context.Background(), updateReq); err != nil {
+		panic(err)
+	}
+}
+
+// GetLevels returns the levels of the ingredient, it panics if there's no such ingredient
+func GetLevels(ledger resourcemanager.Repository, ingredientID string) *resourcemanager.Levels {
+	got, err := ledger.GetLevels(context.Background(), resourcemanager.GetRequest{IngredientID: ingredientID})
+	if err != nil {
+		panic(err)
+	}
+	return got
+}
+
+func testUpdates(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	reservation := resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 40}
+	update := func(m resourcemanager.Repository, updateType resourcemanager.UpdateType, quantity int) error {
+		_, err := m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+			IngredientID: "milk", UpdateType: updateType, ResourceQuantity: quantity, Reason: entities.AdjustReasonStockTake,
+		})
+		return err
+	}
+
+	tests := []struct {
+		name       string
+		action     func(m resourcemanager.Repository) error
+		wantErr    error
+		wantLevels *resourcemanager.Levels
+	}{
+		{
+			name: "success | reserved",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 60})
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 100},
+		},
+		{
+			name: "success | committed",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.Commit(ctx, reservation)
+				return err
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 60, Available: 60},
+		},
+		{
+			name: "success | released",
+			action: func(m resourcemanager.Repository) error {
+				return m.Release(ctx, reservation)
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Available: 100},
+		},
+		{
+			name: "success | consumed what isn't reserved",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeConsume, 60)
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 40, Reserved: 40},
+		},
+		{
+			name: "success | refilled",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeRefill, 50)
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 150, Reserved: 40, Available: 110},
+		},
+		{
+			name: "success | adjusted",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeAdjust, 90)
+			},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 90, Reserved: 40, Available: 50},
+		},
+		{
+			name: "error | reserved by others",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 80})
+			},
+			wantErr:    entities.ErrResourceTemporarilyNotAvailable{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | not enough on hand",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 101})
+			},
+			wantErr:    entities.ErrInsufficientResource{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | unknown ingredient",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "oat_milk", Quantity: 1})
+			},
+			wantErr:    entities.ErrResourceNotAvailable{ResourceID: "oat_milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | committed more than reserved",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 41})
+				return err
+			},
+			wantErr:    entities.ErrInsufficientResource{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | released more than reserved",
+			action: func(m resourcemanager.Repository) error {
+				return m.Release(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 41})
+			},
+			wantErr:    entities.ErrInsufficientResource{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | consumed what is reserved",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeConsume, 61)
+			},
+			wantErr:    entities.ErrResourceNotAvailable{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | refill overflows",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeRefill, 1<<32)
+			},
+			wantErr:    entities.ErrQuantityOverflow{ResourceID: "milk"},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+		{
+			name: "error | adjusted below reserved",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateTypeAdjust, 30)
+			},
+			wantErr:    entities.ErrBelowReserved{ResourceID: "milk", Quantity: 30, Reserved: 40},
+			wantLevels: &resourcemanager.Levels{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := factory(t, clock.NewFake(Start), nil)
+			Refill(m, "milk", 100)
+			assert.NoError(t, m.Reserve(ctx, reservation))
+
+			assert.Equal(t, tt.wantErr, tt.action(m))
+			assert.Equal(t, tt.wantLevels, GetLevels(m, "milk"))
+		})
+	}
+}
+
+func testLots(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	clk := clock.NewFake(Start)
+	m := factory(t, clk, nil)
+
+	_, err := m.RefillMany(ctx, []resourcemanager.RefillRequest{
+		{IngredientID: "milk", Quantity: 100, LotID: "L1", ExpiresAt: Start.Add(time.Hour)},
+		{IngredientID: "milk", Quantity: 100, LotID: "L2"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150}))
+
+	// the reservation holds half of the expired lot, so only the other half is written off
+	clk.Advance(2 * time.Hour)
+	assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk", OnHand: 150, Reserved: 150}, GetLevels(m, "milk"))
+	_, err = m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150})
+	assert.Equal(t, entities.ErrLotExpired{ResourceID: "milk", LotID: "L1"}, err)
+
+	// once released, the rest is written off
+	assert.NoError(t, m.Release(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150}))
+	lots, err := m.ListLots(ctx, resourcemanager.GetRequest{IngredientID: "milk"})
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.Lot{
+		{ID: "L1", IngredientID: "milk", ExpiresAt: Start.Add(time.Hour), Expired: true, WrittenOff: 100},
+		{ID: "L2", IngredientID: "milk", Quantity: 100},
+	}, lots)
+
+	assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 60}))
+	consumption, err := m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 60})
+	assert.NoError(t, err)
+	assert.Equal(t, &resourcemanager.Consumption{
+		IngredientID: "milk",
+		OnHand:       40,
+		Lots:         []entities.LotUsage{{IngredientID: "milk", LotID: "L2", Quantity: 60}},
+	}, consumption)
+
+	_, err = m.ListLots(ctx, resourcemanager.GetRequest{IngredientID: "oat_milk"})
+	assert.Equal(t, entities.ErrResourceNotAvailable{ResourceID: "oat_milk"}, err)
+}
+
+func testAdjustments(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	m := factory(t, clock.NewFake(Start), nil)
+	Refill(m, "water", 100)
+
+	got, err := m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID: "water", UpdateType: resourcemanager.UpdateTypeAdjust, ResourceQuantity: 80, Reason: entities.AdjustReasonSpillage,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &entities.Ingredient{ID: "water", Quantity: 80}, got)
+
+	_, err = m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID: "water", UpdateType: resourcemanager.UpdateTypeAdjust, ResourceQuantity: 10, Reason: "BORROWED",
+	})
+	assert.Equal(t, entities.ErrInvalidAdjustReason{Reason: "BORROWED"}, err)
+
+	adjustments, err := m.ListAdjustments(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.Adjustment{
+		{IngredientID: "water", Reason: entities.AdjustReasonSpillage, Expected: 100, Observed: 80, Variance: -20, At: Start},
+	}, adjustments)
+}
+
+func testRefillMany(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		refillReqs []resourcemanager.RefillRequest
+		want       []entities.Ingredient
+		wantErr    error
+		// wantMilk is the quantity of milk on hand after the refills
+		wantMilk int
+	}{
+		{
+			name: "success | sorted by ingredient",
+			refillReqs: []resourcemanager.RefillRequest{
+				{IngredientID: "water", Quantity: 50},
+				{IngredientID: "milk", Quantity: 10},
+				{IngredientID: "water", Quantity: 50},
+			},
+			want:     []entities.Ingredient{{ID: "milk", Quantity: 110}, {ID: "water", Quantity: 100}},
+			wantMilk: 110,
+		},
+		{
+			name: "error | nothing refilled if one overflows",
+			refillReqs: []resourcemanager.RefillRequest{
+				{IngredientID: "milk", Quantity: 10},
+				{IngredientID: "water", Quantity: 1 << 32},
+			},
+			wantErr:  entities.ErrQuantityOverflow{ResourceID: "water"},
+			wantMilk: 100,
+		},
+		{
+			name: "error | nothing refilled if a lot expired",
+			refillReqs: []resourcemanager.RefillRequest{
+				{IngredientID: "milk", Quantity: 10},
+				{IngredientID: "water", Quantity: 10, LotID: "W1", ExpiresAt: Start},
+			},
+			wantErr:  entities.ErrLotExpired{ResourceID: "water", LotID: "W1"},
+			wantMilk: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := factory(t, clock.NewFake(Start), nil)
+			Refill(m, "milk", 100)
+
+			got, err := m.RefillMany(ctx, tt.refillReqs)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantMilk, GetLevels(m, "milk").OnHand)
+		})
+	}
+}
+
+func testLifecycle(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	milk := resourcemanager.IngredientRequest{IngredientID: "milk"}
+	m := factory(t, clock.NewFake(Start), nil)
+
+	assert.NoError(t, m.AddIngredient(ctx, milk))
+	assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk"}, GetLevels(m, "milk"))
+	Refill(m, "milk", 100)
+	assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 40}))
+
+	// a reservation taken before deactivating can still be committed, but nothing new
+	assert.NoError(t, m.DeactivateIngredient(ctx, milk))
+	assert.Equal(t,
+		entities.ErrIngredientDeactivated{ResourceID: "milk"},
+		m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 10}),
+	)
+	_, err := m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{IngredientID: "milk", UpdateType: resourcemanager.UpdateTypeRefill, ResourceQuantity: 10})
+	assert.Equal(t, entities.ErrIngredientDeactivated{ResourceID: "milk"}, err)
+	_, err = m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, entities.ErrIngredientNotEmpty{ResourceID: "milk", OnHand: 60}, m.RemoveIngredient(ctx, milk))
+
+	_, err = m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{IngredientID: "milk", UpdateType: resourcemanager.UpdateTypeAdjust, Reason: entities.AdjustReasonWaste})
+	assert.NoError(t, err)
+	assert.NoError(t, m.RemoveIngredient(ctx, milk))
+	_, err = m.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "milk"})
+	assert.Equal(t, entities.ErrResourceNotAvailable{ResourceID: "milk"}, err)
+
+	assert.Equal(t, entities.ErrResourceNotAvailable{ResourceID: "milk"}, m.DeactivateIngredient(ctx, milk))
+	Refill(m, "water", 10)
+	assert.Equal(t, entities.ErrIngredientActive{ResourceID: "water"}, m.RemoveIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: "water"}))
+}
+
+func testSnapshot(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	m := factory(t, clock.NewFake(Start), nil)
+	Refill(m, "water", 50)
+	Refill(m, "milk", 100)
+	assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 40}))
+	assert.NoError(t, m.DeactivateIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: "water"}))
+
+	snapshot, err := m.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &resourcemanager.Snapshot{
+		TakenAt: Start,
+		Levels: []resourcemanager.Levels{
+			{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60},
+			{IngredientID: "water", OnHand: 50, Available: 50, Deactivated: true},
+		},
+	}, snapshot)
+
+	ingredients, err := m.ListIngredients(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.Ingredient{{ID: "milk", Quantity: 100}, {ID: "water", Quantity: 50}}, ingredients)
+}
+
+func testEvents(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	clk := clock.NewFake(Start)
+	bus := eventbus.New()
+	got := make([]eventbus.Event, 0)
+	bus.Subscribe(func(event eventbus.Event) {
+		got = append(got, event)
+	})
+	m := factory(t, clk, bus)
+
+	_, err := m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID: "milk", UpdateType: resourcemanager.UpdateTypeRefill, ResourceQuantity: 100, LotID: "L1", ExpiresAt: Start.Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 30}))
+	_, err = m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 30})
+	assert.NoError(t, err)
+	_, err = m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{IngredientID: "milk", UpdateType: resourcemanager.UpdateTypeConsume, ResourceQuantity: 20})
+	assert.NoError(t, err)
+	clk.Advance(time.Hour)
+	_, err = m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID: "milk", UpdateType: resourcemanager.UpdateTypeAdjust, ResourceQuantity: 5, Reason: entities.AdjustReasonStockTake,
+	})
+	assert.NoError(t, err)
+
+	milk := func(quantity int) []entities.Ingredient {
+		return []entities.Ingredient{{ID: "milk", Quantity: quantity}}
+	}
+	assert.Equal(t, []eventbus.Event{
+		{Type: eventbus.TypeRefilled, At: Start, Ingredients: milk(100), Remaining: milk(100)},
+		{Type: eventbus.TypeIngredientConsumed, At: Start, Ingredients: milk(30), Remaining: milk(70)},
+		{Type: eventbus.TypeIngredientConsumed, At: Start, Ingredients: milk(20), Remaining: milk(50)},
+		{Type: eventbus.TypeLotExpired, At: Start.Add(time.Hour), LotID: "L1", Ingredients: milk(50), Remaining: milk(0)},
+		{Type: eventbus.TypeInventoryAdjusted, At: Start.Add(time.Hour), Ingredients: milk(5), Remaining: milk(5), Reason: string(entities.AdjustReasonStockTake)},
+	}, got)
+}
+
+// testValidation checks that invalid requests fail with their typed error, before changing anything
+func testValidation(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	update := func(m resourcemanager.Repository, updateReq resourcemanager.UpdateRequest) error {
+		_, err := m.UpdateIngredient(ctx, updateReq)
+		return err
+	}
+	updateMilk := func(updateType resourcemanager.UpdateType, quantity int) resourcemanager.UpdateRequest {
+		return resourcemanager.UpdateRequest{
+			IngredientID: "milk", UpdateType: updateType, ResourceQuantity: quantity, Reason: entities.AdjustReasonStockTake,
+		}
+	}
+	negative := resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: -50}
+	invalid := entities.ErrInvalidQuantity{ResourceID: "milk", Quantity: -50}
+
+	tests := []struct {
+		name    string
+		action  func(m resourcemanager.Repository) error
+		wantErr error
+	}{
+		{
+			name:    "error | reserved a negative quantity",
+			action:  func(m resourcemanager.Repository) error { return m.Reserve(ctx, negative) },
+			wantErr: invalid,
+		},
+		{
+			name: "error | committed a negative quantity",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.Commit(ctx, negative)
+				return err
+			},
+			wantErr: invalid,
+		},
+		{
+			name:    "error | released a negative quantity",
+			action:  func(m resourcemanager.Repository) error { return m.Release(ctx, negative) },
+			wantErr: invalid,
+		},
+		{
+			name: "error | reserved nothing",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk"})
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk"},
+		},
+		{
+			name: "error | reserved more than the ledger holds",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: resourcemanager.MaxQuantity + 1})
+			},
+			wantErr: entities.ErrQuantityOverflow{ResourceID: "milk"},
+		},
+		{
+			name: "error | reserved without an ingredient",
+			action: func(m resourcemanager.Repository) error {
+				return m.Reserve(ctx, resourcemanager.ReservationRequest{Quantity: 10})
+			},
+			wantErr: entities.ErrMissingID{Field: "ingredient-id"},
+		},
+		{
+			name: "error | consumed a negative quantity",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeConsume, -150))
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk", Quantity: -150},
+		},
+		{
+			name: "error | consumed nothing",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeConsume, 0))
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk"},
+		},
+		{
+			name: "error | refilled a negative quantity",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeRefill, -150))
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk", Quantity: -150},
+		},
+		{
+			name: "error | adjusted to a negative quantity",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeAdjust, -150))
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk", Quantity: -150},
+		},
+		{
+			name: "error | adjusted beyond what the ledger holds",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeAdjust, resourcemanager.MaxQuantity+1))
+			},
+			wantErr: entities.ErrQuantityOverflow{ResourceID: "milk"},
+		},
+		{
+			name:    "error | unknown update type",
+			action:  func(m resourcemanager.Repository) error { return update(m, updateMilk("DRAIN", 10)) },
+			wantErr: entities.ErrInvalidUpdateType{UpdateType: "DRAIN"},
+		},
+		{
+			name: "error | updated without an ingredient",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, resourcemanager.UpdateRequest{UpdateType: resourcemanager.UpdateTypeRefill, ResourceQuantity: 10})
+			},
+			wantErr: entities.ErrMissingID{Field: "ingredient-id"},
+		},
+		{
+			name: "error | refilled many, one of them negative",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.RefillMany(ctx, []resourcemanager.RefillRequest{
+					{IngredientID: "milk", Quantity: 10},
+					{IngredientID: "water", Quantity: -150},
+				})
+				return err
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "water", Quantity: -150},
+		},
+		{
+			name: "error | levels without an ingredient",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.GetLevels(ctx, resourcemanager.GetRequest{})
+				return err
+			},
+			wantErr: entities.ErrMissingID{Field: "ingredient-id"},
+		},
+		{
+			name: "error | added without an ingredient",
+			action: func(m resourcemanager.Repository) error {
+				return m.AddIngredient(ctx, resourcemanager.IngredientRequest{})
+			},
+			wantErr: entities.ErrMissingID{Field: "ingredient-id"},
+		},
+		{
+			name: "error | refilled nothing",
+			action: func(m resourcemanager.Repository) error {
+				return update(m, updateMilk(resourcemanager.UpdateTypeRefill, 0))
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "milk", Quantity: 0},
+		},
+		{
+			name: "error | refilled nothing of many",
+			action: func(m resourcemanager.Repository) error {
+				_, err := m.RefillMany(ctx, []resourcemanager.RefillRequest{{IngredientID: "milk", Quantity: 10}, {IngredientID: "water"}})
+				return err
+			},
+			wantErr: entities.ErrInvalidQuantity{ResourceID: "water", Quantity: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := factory(t, clock.NewFake(Start), nil)
+			Refill(m, "milk", 100)
+			assert.NoError(t, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 40}))
+
+			assert.Equal(t, tt.wantErr, tt.action(m))
+			snapshot, err := m.Snapshot(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []resourcemanager.Levels{{IngredientID: "milk", OnHand: 100, Reserved: 40, Available: 60}}, snapshot.Levels)
+		})
+	}
+}
+
+func testConcurrentReservations(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	m := factory(t, clock.New(), nil)
+	Refill(m, "milk", 100)
+
+	// 200 concurrent reservations of 1 unit, exactly 100 of them can succeed
+	succeeded := make(chan bool, 200)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 1}
+			if err := m.Reserve(ctx, req); err != nil {
+				succeeded <- false
+				return
+			}
+			_, err := m.Commit(ctx, req)
+			succeeded <- err == nil
+		}()
+	}
+	wg.Wait()
+	close(succeeded)
+
+	cnt := 0
+	for ok := range succeeded {
+		if ok {
+			cnt += 1
+		}
+	}
+	assert.Equal(t, 100, cnt)
+	assert.Equal(t, &resourcemanager.Levels{IngredientID: "milk"}, GetLevels(m, "milk"))
+}
+
+// testConcurrentSnapshots reserves & releases two ingredients together, a snapshot must never see only one of them
+func testConcurrentSnapshots(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	m := factory(t, clock.New(), nil)
+	_, err := m.RefillMany(ctx, []resourcemanager.RefillRequest{{IngredientID: "milk", Quantity: 1000}, {IngredientID: "water", Quantity: 1000}})
+	assert.NoError(t, err)
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, _ = m.RefillMany(ctx, []resourcemanager.RefillRequest{{IngredientID: "milk", Quantity: 1}, {IngredientID: "water", Quantity: 1}})
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		snapshot, err := m.Snapshot(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(snapshot.Levels))
+		assert.Equal(t, snapshot.Levels[0].OnHand, snapshot.Levels[1].OnHand)
+	}
+	close(stop)
+	wg.Wait()
+}
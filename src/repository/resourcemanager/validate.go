@@ -0,0 +1,77 @@
+package resourcemanager
+
+import "coffeeMachine/src/entities"
+
+/*
+	Requests are validated before they reach the ledger, by every implementation of Repository alike -
+	ids can't be empty, and quantities can't be negative or more than MaxQuantity. Only adjustments may be zero
+	[ a stock-take may find the ingredient empty ], refilling, reserving, committing, releasing or consuming nothing
+	is a mistake of the caller - an ingredient with nothing on hand is added with AddIngredient.
+*/
+
+// MaxQuantity is the most the ledger holds of an ingredient, on hand or reserved
+const MaxQuantity = maxQuantity
+
+var adjustReasons = map[entities.AdjustReason]bool{
+	entities.AdjustReasonSpillage:  true,
+	entities.AdjustReasonStockTake: true,
+	entities.AdjustReasonWaste:     true,
+}
+
+func validateID(ingredientID string) error {
+	if ingredientID == "" {
+		return entities.ErrMissingID{Field: "ingredient-id"}
+	}
+	return nil
+}
+
+func validateQuantity(ingredientID string, quantity int, allowZero bool) error {
+	if quantity > MaxQuantity {
+		return entities.ErrQuantityOverflow{ResourceID: ingredientID}
+	}
+	if quantity < 0 || quantity == 0 && !allowZero {
+		return entities.ErrInvalidQuantity{ResourceID: ingredientID, Quantity: quantity}
+	}
+	return nil
+}
+
+func (r UpdateRequest) Validate() error {
+	if err := validateID(r.IngredientID); err != nil {
+		return err
+	}
+	switch r.UpdateType {
+	case UpdateTypeConsume:
+		return validateQuantity(r.IngredientID, r.ResourceQuantity, false)
+	case UpdateTypeRefill:
+		return validateQuantity(r.IngredientID, r.ResourceQuantity, false)
+	case UpdateTypeAdjust:
+		if !adjustReasons[r.Reason] {
+			return entities.ErrInvalidAdjustReason{Reason: string(r.Reason)}
+		}
+		return validateQuantity(r.IngredientID, r.ResourceQuantity, true)
+	default:
+		return entities.ErrInvalidUpdateType{UpdateType: string(r.UpdateType)}
+	}
+}
+
+func (r RefillRequest) Validate() error {
+	if err := validateID(r.IngredientID); err != nil {
+		return err
+	}
+	return validateQuantity(r.IngredientID, r.Quantity, false)
+}
+
+func (r ReservationRequest) Validate() error {
+	if err := validateID(r.IngredientID); err != nil {
+		return err
+	}
+	return validateQuantity(r.IngredientID, r.Quantity, false)
+}
+
+func (r GetRequest) Validate() error {
+	return validateID(r.IngredientID)
+}
+
+func (r IngredientRequest) Validate() error {
+	return validateID(r.IngredientID)
+}
@@ -0,0 +1,645 @@
+package sqlstore
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"database/sql"
+	"sort"
+)
+
+const (
+	statusActive      = 0
+	statusDeactivated = 1
+)
+
+// querier is either the database, or a transaction on it
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type ingredientRow struct {
+	onHand   int
+	reserved int
+	status   int
+}
+
+// getIngredient returns false if there's no such ingredient
+func getIngredient(ctx context.Context, q querier, ingredientID string) (ingredientRow, bool, error) {
+	var row ingredientRow
+	err := q.QueryRowContext(ctx,
+		`SELECT on_hand, reserved, status FROM ingredients WHERE id = ?`, ingredientID,
+	).Scan(&row.onHand, &row.reserved, &row.status)
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	}
+	return row, err == nil, err
+}
+
+// ensureIngredient adds the ingredient with nothing on hand, unless it's there already
+func ensureIngredient(ctx context.Context, tx *sql.Tx, ingredientID string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO ingredients (id) VALUES (?) ON CONFLICT (id) DO NOTHING`, ingredientID)
+	return err
+}
+
+type ledger struct {
+	*store
+}
+
+/*
+	NewLedger returns the ledger kept in the database, it behaves like resourcemanager.New - except that the
+	events of a failed operation are never published, since the transaction is rolled back.
+	The tables must have been created by Migrate.
+*/
+func NewLedger(db *sql.DB, opts ...Option) resourcemanager.Repository {
+	return &ledger{store: newStore(db, opts)}
+}
+
+func consumed(ingredientID string, quantity, onHand int) eventbus.Event {
+	return eventbus.Event{
+		Type:        eventbus.TypeIngredientConsumed,
+		Ingredients: []entities.Ingredient{{ID: ingredientID, Quantity: quantity}},
+		Remaining:   []entities.Ingredient{{ID: ingredientID, Quantity: onHand}},
+	}
+}
+
+func (l *ledger) UpdateIngredient(ctx context.Context, updateReq resourcemanager.UpdateRequest) (*entities.Ingredient, error) {
+	if err := updateReq.Validate(); err != nil {
+		return nil, err
+	}
+	switch updateReq.UpdateType {
+	case resourcemanager.UpdateTypeConsume:
+		return l.consume(ctx, updateReq)
+	case resourcemanager.UpdateTypeRefill:
+		ingredients, err := l.RefillMany(ctx, []resourcemanager.RefillRequest{{
+			IngredientID: updateReq.IngredientID,
+			Quantity:     updateReq.ResourceQuantity,
+			LotID:        updateReq.LotID,
+			ExpiresAt:    updateReq.ExpiresAt,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		return &ingredients[0], nil
+	default:
+		return l.adjust(ctx, updateReq)
+	}
+}
+
+// consume takes the quantity directly - reserved quantities are spoken for, only the rest can be consumed
+func (l *ledger) consume(ctx context.Context, updateReq resourcemanager.UpdateRequest) (*entities.Ingredient, error) {
+	ingredientID, quantity := updateReq.IngredientID, updateReq.ResourceQuantity
+	onHand := 0
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		if _, ok, err := getIngredient(ctx, tx, ingredientID); err != nil || !ok {
+			return nil, notAvailable(ingredientID, err)
+		}
+		events, err := l.sweep(ctx, tx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.ExecContext(ctx,
+			`UPDATE ingredients SET on_hand = on_hand - ? WHERE id = ? AND status = ? AND on_hand - reserved >= ?`,
+			quantity, ingredientID, statusActive, quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := rowsAffected(result); err != nil || !ok {
+			if err == nil {
+				err = l.rejection(ctx, tx, ingredientID, entities.ErrResourceNotAvailable{ResourceID: ingredientID})
+			}
+			return nil, err
+		}
+		if _, err := consumeLots(ctx, tx, ingredientID, quantity); err != nil {
+			return nil, err
+		}
+		row, _, err := getIngredient(ctx, tx, ingredientID)
+		onHand = row.onHand
+		return append(events, consumed(ingredientID, quantity, onHand)), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entities.Ingredient{ID: ingredientID, Quantity: onHand}, nil
+}
+
+// rejection tells why a conditional update didn't match - the ingredient is deactivated, or else err
+func (l *ledger) rejection(ctx context.Context, tx *sql.Tx, ingredientID string, err error) error {
+	row, ok, getErr := getIngredient(ctx, tx, ingredientID)
+	if getErr != nil {
+		return getErr
+	}
+	if ok && row.status == statusDeactivated {
+		return entities.ErrIngredientDeactivated{ResourceID: ingredientID}
+	}
+	return err
+}
+
+// notAvailable returns err, or that the ingredient isn't available if there's no error
+func notAvailable(ingredientID string, err error) error {
+	if err != nil {
+		return err
+	}
+	return entities.ErrResourceNotAvailable{ResourceID: ingredientID}
+}
+
+// adjust sets the quantity on hand to what was counted, it can't be less than what reservations hold
+func (l *ledger) adjust(ctx context.Context, updateReq resourcemanager.UpdateRequest) (*entities.Ingredient, error) {
+	ingredientID, quantity := updateReq.IngredientID, updateReq.ResourceQuantity
+
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		if err := ensureIngredient(ctx, tx, ingredientID); err != nil {
+			return nil, err
+		}
+		events, err := l.sweep(ctx, tx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		row, _, err := getIngredient(ctx, tx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.ExecContext(ctx,
+			`UPDATE ingredients SET on_hand = ? WHERE id = ? AND reserved <= ?`, quantity, ingredientID, quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := rowsAffected(result); err != nil || !ok {
+			if err == nil {
+				err = entities.ErrBelowReserved{ResourceID: ingredientID, Quantity: quantity, Reserved: row.reserved}
+			}
+			return nil, err
+		}
+		if err := adjustLots(ctx, tx, ingredientID, quantity-row.onHand); err != nil {
+			return nil, err
+		}
+
+		adjustment := entities.Adjustment{
+			IngredientID: ingredientID,
+			Reason:       updateReq.Reason,
+			Expected:     row.onHand,
+			Observed:     quantity,
+			Variance:     quantity - row.onHand,
+			At:           l.clock.Now(),
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO adjustments (ingredient_id, reason, expected, observed, at) VALUES (?, ?, ?, ?, ?)`,
+			ingredientID, string(adjustment.Reason), adjustment.Expected, adjustment.Observed, toNanos(adjustment.At),
+		); err != nil {
+			return nil, err
+		}
+		return append(events, eventbus.Event{
+			Type:        eventbus.TypeInventoryAdjusted,
+			At:          adjustment.At,
+			Ingredients: []entities.Ingredient{{ID: ingredientID, Quantity: adjustment.Variance}},
+			Remaining:   []entities.Ingredient{{ID: ingredientID, Quantity: adjustment.Observed}},
+			Reason:      string(adjustment.Reason),
+		}), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entities.Ingredient{ID: ingredientID, Quantity: quantity}, nil
+}
+
+// levels sweeps the ingredient, and returns its quantities
+func (l *ledger) levels(ctx context.Context, ingredientID string) (*resourcemanager.Levels, error) {
+	var levels *resourcemanager.Levels
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		if _, ok, err := getIngredient(ctx, tx, ingredientID); err != nil || !ok {
+			return nil, notAvailable(ingredientID, err)
+		}
+		events, err := l.sweep(ctx, tx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		row, _, err := getIngredient(ctx, tx, ingredientID)
+		levels = row.toLevels(ingredientID)
+		return events, err
+	})
+	return levels, err
+}
+
+func (row ingredientRow) toLevels(ingredientID string) *resourcemanager.Levels {
+	return &resourcemanager.Levels{
+		IngredientID: ingredientID,
+		OnHand:       row.onHand,
+		Reserved:     row.reserved,
+		Available:    row.onHand - row.reserved,
+		Deactivated:  row.status == statusDeactivated,
+	}
+}
+
+func (l *ledger) GetIngredient(ctx context.Context, getReq resourcemanager.GetRequest) (*entities.Ingredient, error) {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	levels, err := l.levels(ctx, getReq.IngredientID)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.Ingredient{ID: getReq.IngredientID, Quantity: levels.OnHand}, nil
+}
+
+func (l *ledger) GetLevels(ctx context.Context, getReq resourcemanager.GetRequest) (*resourcemanager.Levels, error) {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	return l.levels(ctx, getReq.IngredientID)
+}
+
+func (l *ledger) Reserve(ctx context.Context, req resourcemanager.ReservationRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	return l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		return l.reserve(ctx, tx, req)
+	})
+}
+
+// reserve follows the rules of the in-memory ledger, see resourcemanager.repositoryImpl.Reserve
+func (s *store) reserve(ctx context.Context, tx *sql.Tx, req resourcemanager.ReservationRequest) ([]eventbus.Event, error) {
+	if _, ok, err := getIngredient(ctx, tx, req.IngredientID); err != nil || !ok {
+		return nil, notAvailable(req.IngredientID, err)
+	}
+	events, err := s.sweep(ctx, tx, req.IngredientID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE ingredients SET reserved = reserved + ? WHERE id = ? AND status = ? AND on_hand - reserved >= ?`,
+		req.Quantity, req.IngredientID, statusActive, req.Quantity,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := rowsAffected(result); err != nil || ok {
+		return events, err
+	}
+
+	row, _, err := getIngredient(ctx, tx, req.IngredientID)
+	switch {
+	case err != nil:
+		return nil, err
+	case row.status == statusDeactivated:
+		return nil, entities.ErrIngredientDeactivated{ResourceID: req.IngredientID}
+	case row.onHand >= req.Quantity:
+		return nil, entities.ErrResourceTemporarilyNotAvailable{ResourceID: req.IngredientID}
+	default:
+		return nil, entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+	}
+}
+
+func (l *ledger) Commit(ctx context.Context, req resourcemanager.ReservationRequest) (*resourcemanager.Consumption, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	var consumption *resourcemanager.Consumption
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		var events []eventbus.Event
+		var err error
+		consumption, events, err = l.commit(ctx, tx, req)
+		return events, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return consumption, nil
+}
+
+// commit consumes the reserved quantity from the unexpired lots, it fails with ErrLotExpired if not enough is unexpired
+func (s *store) commit(ctx context.Context, tx *sql.Tx, req resourcemanager.ReservationRequest) (*resourcemanager.Consumption, []eventbus.Event, error) {
+	if _, ok, err := getIngredient(ctx, tx, req.IngredientID); err != nil || !ok {
+		return nil, nil, notAvailable(req.IngredientID, err)
+	}
+	events, err := s.sweep(ctx, tx, req.IngredientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE ingredients SET on_hand = on_hand - ?, reserved = reserved - ? WHERE id = ? AND reserved >= ?`,
+		req.Quantity, req.Quantity, req.IngredientID, req.Quantity,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok, err := rowsAffected(result); err != nil || !ok {
+		if err == nil {
+			err = entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+		}
+		return nil, nil, err
+	}
+
+	// the update is checked against the lots before they're consumed, it's rolled back if they fall short
+	quantity, err := unexpired(ctx, tx, req.IngredientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if quantity < req.Quantity {
+		lotID, err := firstExpiredLot(ctx, tx, req.IngredientID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, entities.ErrLotExpired{ResourceID: req.IngredientID, LotID: lotID}
+	}
+	lots, err := consumeLots(ctx, tx, req.IngredientID, req.Quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+	row, _, err := getIngredient(ctx, tx, req.IngredientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resourcemanager.Consumption{
+		IngredientID: req.IngredientID,
+		OnHand:       row.onHand,
+		Lots:         lots,
+	}, append(events, consumed(req.IngredientID, req.Quantity, row.onHand)), nil
+}
+
+func (l *ledger) Release(ctx context.Context, req resourcemanager.ReservationRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	return l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		return nil, release(ctx, tx, req)
+	})
+}
+
+func release(ctx context.Context, tx *sql.Tx, req resourcemanager.ReservationRequest) error {
+	result, err := tx.ExecContext(ctx,
+		`UPDATE ingredients SET reserved = reserved - ? WHERE id = ? AND reserved >= ?`,
+		req.Quantity, req.IngredientID, req.Quantity,
+	)
+	if err != nil {
+		return err
+	}
+	if ok, err := rowsAffected(result); err != nil || !ok {
+		if err == nil {
+			err = entities.ErrInsufficientResource{ResourceID: req.IngredientID}
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *ledger) ListLots(ctx context.Context, getReq resourcemanager.GetRequest) ([]entities.Lot, error) {
+	if err := getReq.Validate(); err != nil {
+		return nil, err
+	}
+	lots := make([]entities.Lot, 0)
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		if _, ok, err := getIngredient(ctx, tx, getReq.IngredientID); err != nil || !ok {
+			return nil, notAvailable(getReq.IngredientID, err)
+		}
+		events, err := l.sweep(ctx, tx, getReq.IngredientID)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := listLots(ctx, tx, getReq.IngredientID)
+		for _, row := range rows {
+			lots = append(lots, row.toEntity(getReq.IngredientID))
+		}
+		return events, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lots, nil
+}
+
+func (l *ledger) ListAdjustments(ctx context.Context) ([]entities.Adjustment, error) {
+	rows, err := l.db.QueryContext(ctx, `SELECT ingredient_id, reason, expected, observed, at FROM adjustments ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := make([]entities.Adjustment, 0)
+	for rows.Next() {
+		var adjustment entities.Adjustment
+		var at int64
+		if err := rows.Scan(&adjustment.IngredientID, &adjustment.Reason, &adjustment.Expected, &adjustment.Observed, &at); err != nil {
+			return nil, err
+		}
+		adjustment.Variance = adjustment.Observed - adjustment.Expected
+		adjustment.At = fromNanos(at)
+		adjustments = append(adjustments, adjustment)
+	}
+	return adjustments, rows.Err()
+}
+
+/*
+	RefillMany applies the refills in a single transaction - either all of them, or none if one is invalid.
+	It returns the quantity on hand of every refilled ingredient, sorted by id.
+*/
+func (l *ledger) RefillMany(ctx context.Context, refillReqs []resourcemanager.RefillRequest) ([]entities.Ingredient, error) {
+	now := l.clock.Now()
+	ingredientIDs := make([]string, 0, len(refillReqs))
+	for _, req := range refillReqs {
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		if !req.ExpiresAt.IsZero() && !now.Before(req.ExpiresAt) {
+			return nil, entities.ErrLotExpired{ResourceID: req.IngredientID, LotID: req.LotID}
+		}
+		ingredientIDs = append(ingredientIDs, req.IngredientID)
+	}
+	ingredientIDs = uniqueSorted(ingredientIDs)
+
+	ingredients := make([]entities.Ingredient, 0, len(ingredientIDs))
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		events := make([]eventbus.Event, 0)
+		for _, ingredientID := range ingredientIDs {
+			if err := ensureIngredient(ctx, tx, ingredientID); err != nil {
+				return nil, err
+			}
+			swept, err := l.sweep(ctx, tx, ingredientID)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, swept...)
+		}
+
+		for _, req := range refillReqs {
+			result, err := tx.ExecContext(ctx,
+				`UPDATE ingredients SET on_hand = on_hand + ? WHERE id = ? AND status = ? AND on_hand + ? BETWEEN 0 AND ?`,
+				req.Quantity, req.IngredientID, statusActive, req.Quantity, resourcemanager.MaxQuantity,
+			)
+			if err != nil {
+				return nil, err
+			}
+			if ok, err := rowsAffected(result); err != nil || !ok {
+				if err == nil {
+					err = l.rejection(ctx, tx, req.IngredientID, entities.ErrQuantityOverflow{ResourceID: req.IngredientID})
+				}
+				return nil, err
+			}
+			if err := addLot(ctx, tx, req.IngredientID, req.LotID, req.Quantity, req.ExpiresAt); err != nil {
+				return nil, err
+			}
+			row, _, err := getIngredient(ctx, tx, req.IngredientID)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, eventbus.Event{
+				Type:        eventbus.TypeRefilled,
+				Ingredients: []entities.Ingredient{{ID: req.IngredientID, Quantity: req.Quantity}},
+				Remaining:   []entities.Ingredient{{ID: req.IngredientID, Quantity: row.onHand}},
+			})
+		}
+
+		for _, ingredientID := range ingredientIDs {
+			row, _, err := getIngredient(ctx, tx, ingredientID)
+			if err != nil {
+				return nil, err
+			}
+			ingredients = append(ingredients, entities.Ingredient{ID: ingredientID, Quantity: row.onHand})
+		}
+		return events, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ingredients, nil
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for idx, value := range values {
+		if idx == 0 || value != values[idx-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func (l *ledger) ListIngredients(ctx context.Context) ([]entities.Ingredient, error) {
+	snapshot, err := l.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ingredients := make([]entities.Ingredient, 0, len(snapshot.Levels))
+	for _, levels := range snapshot.Levels {
+		ingredients = append(ingredients, entities.Ingredient{ID: levels.IngredientID, Quantity: levels.OnHand})
+	}
+	return ingredients, nil
+}
+
+// Snapshot reads every ingredient in a single transaction, once expired lots are written off
+func (l *ledger) Snapshot(ctx context.Context) (*resourcemanager.Snapshot, error) {
+	if err := l.sweepAll(ctx); err != nil {
+		return nil, err
+	}
+	var snapshot *resourcemanager.Snapshot
+	err := l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		levels, err := listLevels(ctx, tx)
+		snapshot = &resourcemanager.Snapshot{TakenAt: l.clock.Now(), Levels: levels}
+		return nil, err
+	})
+	return snapshot, err
+}
+
+// sweepAll writes off the expired lots of every ingredient, each in its own transaction
+func (s *store) sweepAll(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT ingredient_id FROM lots WHERE expires_at != 0 ORDER BY ingredient_id`)
+	if err != nil {
+		return err
+	}
+	ingredientIDs := make([]string, 0)
+	for rows.Next() {
+		var ingredientID string
+		if err := rows.Scan(&ingredientID); err != nil {
+			rows.Close()
+			return err
+		}
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ingredientID := range ingredientIDs {
+		if err := s.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+			return s.sweep(ctx, tx, ingredientID)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listLevels returns the levels of every ingredient, sorted by id
+func listLevels(ctx context.Context, q querier) ([]resourcemanager.Levels, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, on_hand, reserved, status FROM ingredients ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := make([]resourcemanager.Levels, 0)
+	for rows.Next() {
+		var ingredientID string
+		var row ingredientRow
+		if err := rows.Scan(&ingredientID, &row.onHand, &row.reserved, &row.status); err != nil {
+			return nil, err
+		}
+		levels = append(levels, *row.toLevels(ingredientID))
+	}
+	return levels, rows.Err()
+}
+
+// AddIngredient adds an ingredient with nothing on hand, or activates it again if it was deactivated
+func (l *ledger) AddIngredient(ctx context.Context, req resourcemanager.IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	_, err := l.db.ExecContext(ctx,
+		`INSERT INTO ingredients (id) VALUES (?) ON CONFLICT (id) DO UPDATE SET status = ?`, req.IngredientID, statusActive,
+	)
+	return err
+}
+
+func (l *ledger) DeactivateIngredient(ctx context.Context, req resourcemanager.IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	result, err := l.db.ExecContext(ctx, `UPDATE ingredients SET status = ? WHERE id = ?`, statusDeactivated, req.IngredientID)
+	if err != nil {
+		return err
+	}
+	if ok, err := rowsAffected(result); err != nil || !ok {
+		return notAvailable(req.IngredientID, err)
+	}
+	return nil
+}
+
+// RemoveIngredient removes a deactivated ingredient with its lots, once it's empty
+func (l *ledger) RemoveIngredient(ctx context.Context, req resourcemanager.IngredientRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	return l.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		row, ok, err := getIngredient(ctx, tx, req.IngredientID)
+		switch {
+		case err != nil || !ok:
+			return nil, notAvailable(req.IngredientID, err)
+		case row.status != statusDeactivated:
+			return nil, entities.ErrIngredientActive{ResourceID: req.IngredientID}
+		case row.onHand > 0 || row.reserved > 0:
+			return nil, entities.ErrIngredientNotEmpty{ResourceID: req.IngredientID, OnHand: row.onHand, Reserved: row.reserved}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM lots WHERE ingredient_id = ?`, req.IngredientID); err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM ingredients WHERE id = ?`, req.IngredientID)
+		return nil, err
+	})
+}
@@ -0,0 +1,209 @@
+package sqlstore
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// lotRow is a row of the lots table, they work like the lots of the in-memory ledger
+type lotRow struct {
+	seq        int64
+	id         string
+	remaining  int
+	expiresAt  int64
+	expired    bool
+	writtenOff int
+}
+
+func (l lotRow) toEntity(ingredientID string) entities.Lot {
+	return entities.Lot{
+		ID:           l.id,
+		IngredientID: ingredientID,
+		Quantity:     l.remaining,
+		ExpiresAt:    fromNanos(l.expiresAt),
+		Expired:      l.expired,
+		WrittenOff:   l.writtenOff,
+	}
+}
+
+// toNanos & fromNanos store times as unix nanos, the zero time as 0
+func toNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromNanos(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// queryLots reads every matching lot before returning, so that the transaction can go on with other statements
+func queryLots(ctx context.Context, q querier, query string, args ...interface{}) ([]lotRow, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := make([]lotRow, 0)
+	for rows.Next() {
+		var l lotRow
+		if err := rows.Scan(&l.seq, &l.id, &l.remaining, &l.expiresAt, &l.expired, &l.writtenOff); err != nil {
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
+
+const lotColumns = `seq, lot_id, remaining, expires_at, expired, written_off`
+
+func listLots(ctx context.Context, q querier, ingredientID string) ([]lotRow, error) {
+	return queryLots(ctx, q, `SELECT `+lotColumns+` FROM lots WHERE ingredient_id = ? ORDER BY seq`, ingredientID)
+}
+
+// addLot merges consecutive anonymous refills into one lot, as the in-memory ledger does
+func addLot(ctx context.Context, tx *sql.Tx, ingredientID, lotID string, quantity int, expiresAt time.Time) error {
+	if lotID == "" && expiresAt.IsZero() {
+		last, err := queryLots(ctx, tx, `SELECT `+lotColumns+` FROM lots WHERE ingredient_id = ? ORDER BY seq DESC LIMIT 1`, ingredientID)
+		if err != nil {
+			return err
+		}
+		if len(last) > 0 && last[0].id == "" && last[0].expiresAt == 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE lots SET remaining = remaining + ? WHERE seq = ?`, quantity, last[0].seq)
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO lots (ingredient_id, lot_id, remaining, expires_at) VALUES (?, ?, ?, ?)`,
+		ingredientID, lotID, quantity, toNanos(expiresAt),
+	)
+	return err
+}
+
+/*
+	consumeLots takes the quantity from the unexpired lots in FIFO order, and drops the lots it depleted -
+	expired lots are kept, so that they can still be reported. It must be called after a sweep,
+	and after checking that enough is unexpired.
+*/
+func consumeLots(ctx context.Context, tx *sql.Tx, ingredientID string, quantity int) ([]entities.LotUsage, error) {
+	lots, err := queryLots(ctx, tx,
+		`SELECT `+lotColumns+` FROM lots WHERE ingredient_id = ? AND expired = 0 AND remaining > 0 ORDER BY seq`,
+		ingredientID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []entities.LotUsage
+	for _, l := range lots {
+		if quantity == 0 {
+			break
+		}
+		taken := l.remaining
+		if taken > quantity {
+			taken = quantity
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE lots SET remaining = remaining - ? WHERE seq = ?`, taken, l.seq); err != nil {
+			return nil, err
+		}
+		quantity -= taken
+		if l.id != "" {
+			usage = append(usage, entities.LotUsage{IngredientID: ingredientID, LotID: l.id, Quantity: taken})
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM lots WHERE ingredient_id = ? AND remaining = 0 AND expired = 0`, ingredientID); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// adjustLots takes a shortfall from the lots as if it was consumed, and puts a surplus in an anonymous lot
+func adjustLots(ctx context.Context, tx *sql.Tx, ingredientID string, variance int) error {
+	if variance < 0 {
+		_, err := consumeLots(ctx, tx, ingredientID, -variance)
+		return err
+	}
+	if variance > 0 {
+		return addLot(ctx, tx, ingredientID, "", variance, time.Time{})
+	}
+	return nil
+}
+
+// unexpired returns the quantity of lots which haven't expired
+func unexpired(ctx context.Context, tx *sql.Tx, ingredientID string) (int, error) {
+	quantity := 0
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(remaining), 0) FROM lots WHERE ingredient_id = ? AND expired = 0`, ingredientID,
+	).Scan(&quantity)
+	return quantity, err
+}
+
+// firstExpiredLot returns the id of the first expired lot which isn't written off yet
+func firstExpiredLot(ctx context.Context, tx *sql.Tx, ingredientID string) (string, error) {
+	lots, err := queryLots(ctx, tx,
+		`SELECT `+lotColumns+` FROM lots WHERE ingredient_id = ? AND expired = 1 AND remaining > 0 ORDER BY seq LIMIT 1`,
+		ingredientID,
+	)
+	if err != nil || len(lots) == 0 {
+		return "", err
+	}
+	return lots[0].id, nil
+}
+
+/*
+	sweep marks the lots which are due as expired, and writes off their quantities from the quantity on hand.
+	As in the in-memory ledger, quantities held by reservations are never written off from under them -
+	the rest of an expired lot is written off by later sweeps, once reservations are released.
+*/
+func (s *store) sweep(ctx context.Context, tx *sql.Tx, ingredientID string) ([]eventbus.Event, error) {
+	now := s.clock.Now()
+	lots, err := queryLots(ctx, tx,
+		`SELECT `+lotColumns+` FROM lots WHERE ingredient_id = ?
+		AND (expired = 1 AND remaining > 0 OR expired = 0 AND expires_at != 0 AND expires_at <= ?) ORDER BY seq`,
+		ingredientID, now.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]eventbus.Event, 0)
+	for _, l := range lots {
+		row, _, err := getIngredient(ctx, tx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		writtenOff := l.remaining
+		if writtenOff > row.onHand-row.reserved {
+			writtenOff = row.onHand - row.reserved
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE lots SET expired = 1, remaining = remaining - ?, written_off = written_off + ? WHERE seq = ?`,
+			writtenOff, writtenOff, l.seq,
+		); err != nil {
+			return nil, err
+		}
+		if writtenOff == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE ingredients SET on_hand = on_hand - ? WHERE id = ?`, writtenOff, ingredientID); err != nil {
+			return nil, err
+		}
+		events = append(events, eventbus.Event{
+			Type:        eventbus.TypeLotExpired,
+			At:          now,
+			LotID:       l.id,
+			Ingredients: []entities.Ingredient{{ID: ingredientID, Quantity: writtenOff}},
+			Remaining:   []entities.Ingredient{{ID: ingredientID, Quantity: row.onHand - writtenOff}},
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,391 @@
+package sqlstore
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+/*
+	reservations work on the ledger in the same database, so that an order is reserved, committed or released
+	in a single transaction - all of its ingredients, or none of them.
+
+	A reservation with a TTL is expired by a timer, as in the in-memory repository. Timers don't survive a restart,
+	so List, Snapshot & Commit also expire the reservations which are due before looking at them.
+*/
+type reservations struct {
+	*store
+	// timersMutex guards timers, the expiry timers of pending reservations by token
+	timersMutex sync.Mutex
+	timers      map[string]clock.Timer
+}
+
+// NewReservations returns the reservations kept in the database, on the ledger of NewLedger on the same database
+func NewReservations(db *sql.DB, opts ...Option) reservationmanager.Repository {
+	return &reservations{
+		store:  newStore(db, opts),
+		timers: make(map[string]clock.Timer, 0),
+	}
+}
+
+func (r *reservations) event(eventType eventbus.Type, res *reservationmanager.Reservation) eventbus.Event {
+	return eventbus.Event{
+		Type:        eventType,
+		At:          r.clock.Now(),
+		OrderID:     res.OrderID,
+		Token:       res.Token,
+		Ingredients: append([]entities.Ingredient{}, res.Ingredients...),
+	}
+}
+
+func (r *reservations) Create(ctx context.Context, request reservationmanager.CreateReservationRequest) (*reservationmanager.Reservation, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	token, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	now := fromNanos(toNanos(r.clock.Now()))
+	created := &reservationmanager.Reservation{
+		Token:       token.String(),
+		OrderID:     request.OrderID,
+		Ingredients: append([]entities.Ingredient{}, request.Ingredients...),
+		Status:      reservationmanager.StatusPending,
+		CreatedAt:   now,
+	}
+	if request.TTL > 0 {
+		created.ExpiresAt = now.Add(request.TTL)
+	}
+
+	err = r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		events := make([]eventbus.Event, 0)
+		for _, ingredient := range created.Ingredients {
+			swept, err := r.reserve(ctx, tx, resourcemanager.ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity})
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, swept...)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO reservations (token, order_id, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+			created.Token, created.OrderID, string(created.Status), toNanos(created.CreatedAt), toNanos(created.ExpiresAt),
+		); err != nil {
+			return nil, err
+		}
+		for idx, ingredient := range created.Ingredients {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO reservation_ingredients (token, position, ingredient_id, quantity) VALUES (?, ?, ?, ?)`,
+				created.Token, idx, ingredient.ID, ingredient.Quantity,
+			); err != nil {
+				return nil, err
+			}
+		}
+		return append(events, r.event(eventbus.TypeReservationTaken, created)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if request.TTL > 0 {
+		r.timersMutex.Lock()
+		r.timers[created.Token] = r.clock.AfterFunc(request.TTL, func() {
+			if err := r.expireIfDue(context.Background(), created.Token); err != nil {
+				log.Printf("failed to release expired reservation %s: %v", created.Token, err)
+			}
+		})
+		r.timersMutex.Unlock()
+	}
+	return created, nil
+}
+
+// stopTimer is only called once the transaction which closed the reservation was committed - if it failed,
+// the reservation is still pending and the timer must still expire it
+func (r *reservations) stopTimer(token string) {
+	r.timersMutex.Lock()
+	defer r.timersMutex.Unlock()
+
+	if timer, ok := r.timers[token]; ok {
+		timer.Stop()
+		delete(r.timers, token)
+	}
+}
+
+// get reads the reservation with its ingredients & lots
+func get(ctx context.Context, q querier, token string) (*reservationmanager.Reservation, error) {
+	res := &reservationmanager.Reservation{Token: token}
+	var createdAt, expiresAt int64
+	err := q.QueryRowContext(ctx,
+		`SELECT order_id, status, created_at, expires_at FROM reservations WHERE token = ?`, token,
+	).Scan(&res.OrderID, &res.Status, &createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, entities.ErrReservationNotFound{Token: token}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.CreatedAt, res.ExpiresAt = fromNanos(createdAt), fromNanos(expiresAt)
+
+	rows, err := q.QueryContext(ctx, `SELECT ingredient_id, quantity FROM reservation_ingredients WHERE token = ? ORDER BY position`, token)
+	if err != nil {
+		return nil, err
+	}
+	res.Ingredients = make([]entities.Ingredient, 0)
+	for rows.Next() {
+		var ingredient entities.Ingredient
+		if err := rows.Scan(&ingredient.ID, &ingredient.Quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res.Ingredients = append(res.Ingredients, ingredient)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT ingredient_id, lot_id, quantity FROM reservation_lots WHERE token = ? ORDER BY position`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var usage entities.LotUsage
+		if err := rows.Scan(&usage.IngredientID, &usage.LotID, &usage.Quantity); err != nil {
+			return nil, err
+		}
+		res.Lots = append(res.Lots, usage)
+	}
+	return res, rows.Err()
+}
+
+func (r *reservations) Get(ctx context.Context, request reservationmanager.GetReservationRequest) (*reservationmanager.Reservation, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	return get(ctx, r.db, request.Token)
+}
+
+// expireIfDue releases the reservation if it's pending past its TTL, in its own transaction
+func (r *reservations) expireIfDue(ctx context.Context, token string) error {
+	expired := false
+	err := r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		res, err := get(ctx, tx, token)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status != reservationmanager.StatusPending || res.ExpiresAt.IsZero() || r.clock.Now().Before(res.ExpiresAt) {
+			return nil, nil
+		}
+		expired = true
+		return r.settle(ctx, tx, res, reservationmanager.StatusExpired)
+	})
+	if err != nil {
+		return err
+	}
+	if expired {
+		r.stopTimer(token)
+	}
+	return nil
+}
+
+// expireDue expires every pending reservation past its TTL
+func (r *reservations) expireDue(ctx context.Context) error {
+	tokens, err := r.tokens(ctx,
+		`SELECT token FROM reservations WHERE status = ? AND expires_at != 0 AND expires_at <= ? ORDER BY seq`,
+		string(reservationmanager.StatusPending), r.clock.Now().UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := r.expireIfDue(ctx, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reservations) tokens(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]string, 0)
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// settle releases the ingredients of the reservation, and closes it with the given status
+func (r *reservations) settle(ctx context.Context, tx *sql.Tx, res *reservationmanager.Reservation, status reservationmanager.Status) ([]eventbus.Event, error) {
+	for _, ingredient := range res.Ingredients {
+		if err := release(ctx, tx, resourcemanager.ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE reservations SET status = ? WHERE token = ?`, string(status), res.Token); err != nil {
+		return nil, err
+	}
+	return []eventbus.Event{r.event(eventbus.TypeReservationReleased, res)}, nil
+}
+
+func (r *reservations) Commit(ctx context.Context, request reservationmanager.CommitReservationRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	// the expiry timer might not have fired yet
+	if err := r.expireIfDue(ctx, request.Token); err != nil {
+		return err
+	}
+
+	err := r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		res, err := get(ctx, tx, request.Token)
+		if err != nil {
+			return nil, err
+		}
+		switch res.Status {
+		case reservationmanager.StatusCommitted:
+			return nil, nil
+		case reservationmanager.StatusCancelled, reservationmanager.StatusExpired:
+			return nil, entities.ErrReservationClosed{Token: request.Token, Status: string(res.Status)}
+		}
+
+		events := make([]eventbus.Event, 0)
+		lots := make([]entities.LotUsage, 0)
+		for _, ingredient := range res.Ingredients {
+			consumption, consumed, err := r.commit(ctx, tx, resourcemanager.ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity})
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, consumed...)
+			lots = append(lots, consumption.Lots...)
+		}
+		for idx, usage := range lots {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO reservation_lots (token, position, ingredient_id, lot_id, quantity) VALUES (?, ?, ?, ?, ?)`,
+				request.Token, idx, usage.IngredientID, usage.LotID, usage.Quantity,
+			); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE reservations SET status = ? WHERE token = ?`, string(reservationmanager.StatusCommitted), request.Token,
+		); err != nil {
+			return nil, err
+		}
+		return events, nil
+	})
+	if err != nil {
+		return err
+	}
+	r.stopTimer(request.Token)
+	return nil
+}
+
+func (r *reservations) Cancel(ctx context.Context, request reservationmanager.CancelReservationRequest) error {
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	err := r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		res, err := get(ctx, tx, request.Token)
+		if err != nil {
+			return nil, err
+		}
+		switch res.Status {
+		case reservationmanager.StatusCancelled, reservationmanager.StatusExpired:
+			return nil, nil
+		case reservationmanager.StatusCommitted:
+			return nil, entities.ErrReservationClosed{Token: request.Token, Status: string(res.Status)}
+		}
+		return r.settle(ctx, tx, res, reservationmanager.StatusCancelled)
+	})
+	if err != nil {
+		return err
+	}
+	r.stopTimer(request.Token)
+	return nil
+}
+
+func (r *reservations) List(ctx context.Context, request reservationmanager.ListReservationsRequest) ([]*reservationmanager.Reservation, error) {
+	if err := r.expireDue(ctx); err != nil {
+		return nil, err
+	}
+	var listed []*reservationmanager.Reservation
+	err := r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		var err error
+		listed, err = list(ctx, tx, request)
+		return nil, err
+	})
+	return listed, err
+}
+
+// list returns the matching reservations in the order they were created, empty fields of the request match everything
+func list(ctx context.Context, tx *sql.Tx, request reservationmanager.ListReservationsRequest) ([]*reservationmanager.Reservation, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT token FROM reservations WHERE (? = '' OR order_id = ?) AND (? = '' OR status = ?) ORDER BY seq`,
+		request.OrderID, request.OrderID, string(request.Status), string(request.Status),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0)
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	listed := make([]*reservationmanager.Reservation, 0, len(tokens))
+	for _, token := range tokens {
+		res, err := get(ctx, tx, token)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, res)
+	}
+	return listed, nil
+}
+
+// Snapshot reads the pending reservations & the levels of the ledger in a single transaction
+func (r *reservations) Snapshot(ctx context.Context) (*reservationmanager.Snapshot, error) {
+	if err := r.expireDue(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.sweepAll(ctx); err != nil {
+		return nil, err
+	}
+	var snapshot *reservationmanager.Snapshot
+	err := r.inTx(ctx, func(tx *sql.Tx) ([]eventbus.Event, error) {
+		pending, err := list(ctx, tx, reservationmanager.ListReservationsRequest{Status: reservationmanager.StatusPending})
+		if err != nil {
+			return nil, err
+		}
+		levels, err := listLevels(ctx, tx)
+		snapshot = &reservationmanager.Snapshot{TakenAt: r.clock.Now(), Pending: pending, Levels: levels}
+		return nil, err
+	})
+	return snapshot, err
+}
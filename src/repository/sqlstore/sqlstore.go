@@ -0,0 +1,163 @@
+package sqlstore
+
+import (
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"database/sql"
+)
+
+/*
+	sqlstore keeps the inventory ledger [ resourcemanager.Repository ] & the reservations [ reservationmanager.Repository ]
+	in a database, through database/sql - for deployments which already run one. The statements are plain SQLite
+	[ ? placeholders, ON CONFLICT upserts ], any driver speaking that dialect works.
+
+	Quantities are kept non-negative by the database itself - every update is a single statement with a condition
+	like WHERE on_hand - reserved >= ?, and if no row matched, the row is read to tell why. Whatever touches several
+	rows [ lots, multi-ingredient reservations, bulk refills ] runs in one transaction, so it's applied in full or not at all.
+
+	SQLite has a single writer, so open it with db.SetMaxOpenConns(1) - transactions then queue for the connection,
+	instead of failing with SQLITE_BUSY.
+*/
+
+// schema is idempotent, so Migrate can run on every start
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS ingredients (
+		id       TEXT PRIMARY KEY,
+		on_hand  INTEGER NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+		reserved INTEGER NOT NULL DEFAULT 0 CHECK (reserved >= 0 AND reserved <= on_hand),
+		status   INTEGER NOT NULL DEFAULT 0
+	)`,
+	// seq orders the lots of an ingredient FIFO, expires_at is in unix nanos - 0 for lots which never expire
+	`CREATE TABLE IF NOT EXISTS lots (
+		seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+		ingredient_id TEXT NOT NULL,
+		lot_id        TEXT NOT NULL,
+		remaining     INTEGER NOT NULL CHECK (remaining >= 0),
+		expires_at    INTEGER NOT NULL,
+		expired       INTEGER NOT NULL DEFAULT 0,
+		written_off   INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS lots_ingredient ON lots (ingredient_id, seq)`,
+	`CREATE TABLE IF NOT EXISTS adjustments (
+		seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+		ingredient_id TEXT NOT NULL,
+		reason        TEXT NOT NULL,
+		expected      INTEGER NOT NULL,
+		observed      INTEGER NOT NULL,
+		at            INTEGER NOT NULL
+	)`,
+	// expires_at is in unix nanos - 0 for reservations which never expire
+	`CREATE TABLE IF NOT EXISTS reservations (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		token      TEXT NOT NULL UNIQUE,
+		order_id   TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS reservations_order ON reservations (order_id, seq)`,
+	`CREATE TABLE IF NOT EXISTS reservation_ingredients (
+		token         TEXT NOT NULL,
+		position      INTEGER NOT NULL,
+		ingredient_id TEXT NOT NULL,
+		quantity      INTEGER NOT NULL,
+		PRIMARY KEY (token, position)
+	)`,
+	`CREATE TABLE IF NOT EXISTS reservation_lots (
+		token         TEXT NOT NULL,
+		position      INTEGER NOT NULL,
+		ingredient_id TEXT NOT NULL,
+		lot_id        TEXT NOT NULL,
+		quantity      INTEGER NOT NULL,
+		PRIMARY KEY (token, position)
+	)`,
+}
+
+// Migrate creates the tables of the store, if they don't exist yet
+func Migrate(ctx context.Context, db *sql.DB) error {
+	for _, statement := range schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store is shared by the ledger & the reservations, so that reservations work on the ledger in their own transactions
+type store struct {
+	db       *sql.DB
+	clock    clock.Clock
+	eventBus eventbus.Bus
+}
+
+type Option func(s *store)
+
+// WithClock replaces the wall clock, which expires lots & reservations
+func WithClock(clk clock.Clock) Option {
+	return func(s *store) {
+		s.clock = clk
+	}
+}
+
+// WithEventBus publishes what the store does to the bus, as the in-memory repositories do
+func WithEventBus(bus eventbus.Bus) Option {
+	return func(s *store) {
+		s.eventBus = bus
+	}
+}
+
+func newStore(db *sql.DB, opts []Option) *store {
+	s := &store{
+		db:    db,
+		clock: clock.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+/*
+	inTx runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+	fn returns the events to publish - they're only published once the transaction is committed,
+	so nobody hears of changes which were rolled back.
+*/
+func (s *store) inTx(ctx context.Context, fn func(tx *sql.Tx) ([]eventbus.Event, error)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	events, err := fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, event := range events {
+		s.publish(event)
+	}
+	return nil
+}
+
+// publish stamps the event with the store's clock, unless it's stamped already
+func (s *store) publish(event eventbus.Event) {
+	if s.eventBus == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = s.clock.Now()
+	}
+	s.eventBus.Publish(event)
+}
+
+// rowsAffected tells if the conditional update matched its row
+func rowsAffected(result sql.Result) (bool, error) {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/reservationmanager/reservationmanagertest"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/repository/resourcemanager/resourcemanagertest"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens a fresh in-memory sqlite database, on a single connection since every connection gets its own database
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLedger_Conformance(t *testing.T) {
+	resourcemanagertest.Run(t, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return NewLedger(openDB(t), WithClock(clk), WithEventBus(bus))
+	})
+}
+
+func TestReservations_Conformance(t *testing.T) {
+	reservationmanagertest.Run(t, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository) {
+		db := openDB(t)
+		return NewLedger(db, WithClock(clk), WithEventBus(bus)), NewReservations(db, WithClock(clk), WithEventBus(bus))
+	})
+}
+
+func FuzzLedger(f *testing.F) {
+	resourcemanagertest.Fuzz(f, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return NewLedger(openDB(t), WithClock(clk), WithEventBus(bus))
+	})
+}
+
+func FuzzReservations(f *testing.F) {
+	reservationmanagertest.Fuzz(f, func(t *testing.T, clk clock.Clock, bus eventbus.Bus) (resourcemanager.Repository, reservationmanager.Repository) {
+		db := openDB(t)
+		return NewLedger(db, WithClock(clk), WithEventBus(bus)), NewReservations(db, WithClock(clk), WithEventBus(bus))
+	})
+}
+
+// TestLedger_Trace runs the same operations on the in-memory ledger too, they must return the same & publish the same events
+func TestLedger_Trace(t *testing.T) {
+	ctx := context.Background()
+
+	run := func(newLedger func(clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository) []interface{} {
+		clk := clock.NewFake(resourcemanagertest.Start)
+		bus := eventbus.New()
+		trace := make([]interface{}, 0)
+		bus.Subscribe(func(event eventbus.Event) {
+			trace = append(trace, event)
+		})
+		m := newLedger(clk, bus)
+		record := func(result interface{}, err error) {
+			trace = append(trace, result, err)
+		}
+
+		record(m.RefillMany(ctx, []resourcemanager.RefillRequest{
+			{IngredientID: "milk", Quantity: 100, LotID: "L1", ExpiresAt: resourcemanagertest.Start.Add(time.Hour)},
+			{IngredientID: "milk", Quantity: 100, LotID: "L2"},
+			{IngredientID: "water", Quantity: 50},
+			{IngredientID: "water", Quantity: 50},
+		}))
+		record(nil, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150}))
+		clk.Advance(2 * time.Hour)
+		// half of the expired lot is held by the reservation, which can't be committed from the other lot alone
+		record(m.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "milk"}))
+		record(m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150}))
+		record(nil, m.Release(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 150}))
+		record(m.ListLots(ctx, resourcemanager.GetRequest{IngredientID: "milk"}))
+		record(nil, m.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 60}))
+		record(m.Commit(ctx, resourcemanager.ReservationRequest{IngredientID: "milk", Quantity: 60}))
+		record(m.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+			IngredientID: "water", UpdateType: resourcemanager.UpdateTypeAdjust, ResourceQuantity: 80, Reason: entities.AdjustReasonSpillage,
+		}))
+		record(m.ListLots(ctx, resourcemanager.GetRequest{IngredientID: "water"}))
+		record(m.ListAdjustments(ctx))
+		record(m.Snapshot(ctx))
+		record(m.ListIngredients(ctx))
+		return trace
+	}
+
+	want := run(func(clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return resourcemanager.New(resourcemanager.WithClock(clk), resourcemanager.WithEventBus(bus))
+	})
+	assert.Contains(t, want, &resourcemanager.Consumption{
+		IngredientID: "milk",
+		OnHand:       40,
+		Lots:         []entities.LotUsage{{IngredientID: "milk", LotID: "L2", Quantity: 60}},
+	})
+	assert.Equal(t, want, run(func(clk clock.Clock, bus eventbus.Bus) resourcemanager.Repository {
+		return NewLedger(openDB(t), WithClock(clk), WithEventBus(bus))
+	}))
+}
@@ -0,0 +1,114 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for anything that expires or waits, so that tests can control time
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after the duration, unless the timer is stopped before
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	// Stop returns false if the timer already fired or was stopped
+	Stop() bool
+}
+
+type realClock struct{}
+
+// New returns the wall clock
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+/*
+	Fake only moves when it is advanced.
+	Timers which are due are fired by Advance itself, in the order of their deadlines,
+	so when Advance returns every due callback has completed.
+*/
+type Fake struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	fake     *Fake
+	deadline time.Time
+	f        func()
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		mutex:  sync.Mutex{},
+		now:    now,
+		timers: make([]*fakeTimer, 0),
+	}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := &fakeTimer{fake: c, deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward, firing all timers which become due on the way
+func (c *Fake) Advance(d time.Duration) {
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].deadline.Before(c.timers[j].deadline)
+		})
+		if len(c.timers) == 0 || c.timers[0].deadline.After(target) {
+			break
+		}
+
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		if timer.deadline.After(c.now) {
+			c.now = timer.deadline
+		}
+		// the callback may use the clock itself
+		c.mutex.Unlock()
+		timer.f()
+		c.mutex.Lock()
+	}
+	c.now = target
+	c.mutex.Unlock()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.mutex.Lock()
+	defer t.fake.mutex.Unlock()
+
+	for idx, timer := range t.fake.timers {
+		if timer == t {
+			t.fake.timers = append(t.fake.timers[:idx], t.fake.timers[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake_Advance(t *testing.T) {
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		advance []time.Duration
+		stop    bool
+		want    []string
+	}{
+		{
+			name:    "success | timers fire in the order of their deadlines",
+			advance: []time.Duration{10 * time.Minute},
+			want:    []string{"1m", "2m", "5m"},
+		},
+		{
+			name:    "success | only due timers fire",
+			advance: []time.Duration{90 * time.Second},
+			want:    []string{"1m"},
+		},
+		{
+			name:    "success | timers fire over several advances",
+			advance: []time.Duration{90 * time.Second, 90 * time.Second},
+			want:    []string{"1m", "2m"},
+		},
+		{
+			name:    "success | stopped timer never fires",
+			advance: []time.Duration{10 * time.Minute},
+			stop:    true,
+			want:    []string{"1m", "5m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFake(start)
+			fired := make([]string, 0)
+			record := func(name string) func() {
+				return func() {
+					fired = append(fired, name)
+				}
+			}
+			c.AfterFunc(5*time.Minute, record("5m"))
+			c.AfterFunc(time.Minute, record("1m"))
+			timer := c.AfterFunc(2*time.Minute, record("2m"))
+			if tt.stop {
+				assert.True(t, timer.Stop())
+			}
+
+			total := time.Duration(0)
+			for _, d := range tt.advance {
+				c.Advance(d)
+				total += d
+			}
+			assert.Equal(t, tt.want, fired)
+			assert.Equal(t, start.Add(total), c.Now())
+		})
+	}
+}
+
+func TestFake_AfterFuncInCallback(t *testing.T) {
+	c := NewFake(time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC))
+
+	fired := 0
+	c.AfterFunc(time.Minute, func() {
+		// a timer set from a callback starts at the deadline of the callback
+		c.AfterFunc(time.Minute, func() {
+			fired += 1
+		})
+	})
+	c.Advance(2 * time.Minute)
+	assert.Equal(t, 1, fired)
+}
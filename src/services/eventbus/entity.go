@@ -0,0 +1,55 @@
+package eventbus
+
+import (
+	"coffeeMachine/src/entities"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeOrderReceived       Type = "ORDER_RECEIVED"
+	TypeReservationTaken    Type = "RESERVATION_TAKEN"
+	TypeReservationReleased Type = "RESERVATION_RELEASED"
+	TypeIngredientConsumed  Type = "INGREDIENT_CONSUMED"
+	TypeDrinkPrepared       Type = "DRINK_PREPARED"
+	TypeDrinkRejected       Type = "DRINK_REJECTED"
+	TypeRefilled            Type = "REFILLED"
+	TypeMachineStateChanged Type = "MACHINE_STATE_CHANGED"
+	TypeOutletCleaned       Type = "OUTLET_CLEANED"
+	TypeCleaningOverdue     Type = "CLEANING_OVERDUE"
+	TypeLotExpired          Type = "LOT_EXPIRED"
+	TypeWaitingForHeat      Type = "WAITING_FOR_HEAT"
+	TypeInventoryAdjusted   Type = "INVENTORY_ADJUSTED"
+)
+
+// Event is something the machine did, fields which don't apply to the type are left empty
+type Event struct {
+	Type     Type      `json:"type"`
+	At       time.Time `json:"at"`
+	OrderID  string    `json:"order_id,omitempty"`
+	Token    string    `json:"token,omitempty"`
+	OutletID int       `json:"outlet_id,omitempty"`
+	LotID    string    `json:"lot_id,omitempty"`
+	// Ingredients are reserved, released, consumed or refilled - with their quantities, or adjusted - with the variance
+	Ingredients []entities.Ingredient `json:"ingredients,omitempty"`
+	// Remaining quantities on hand of the ingredients, after they were consumed, refilled or adjusted
+	Remaining     []entities.Ingredient `json:"remaining,omitempty"`
+	RejectReasons []string              `json:"reject_reasons,omitempty"`
+	// State is the new state of the machine & the reason it was changed, for state changes
+	State string `json:"state,omitempty"`
+	// Reason of a state change or an adjustment, the cleaning rule of a cleaning, or the ingredient a drink waits to heat up
+	Reason string `json:"reason,omitempty"`
+}
+
+// Policy decides what publishing does when the buffer of an asynchronous subscriber is full
+type Policy string
+
+const (
+	// PolicyBlock makes the publisher wait till the subscriber catches up
+	PolicyBlock Policy = "BLOCK"
+	// PolicyDropNewest drops the event being published
+	PolicyDropNewest Policy = "DROP_NEWEST"
+	// PolicyDropOldest drops the oldest buffered event, to make room for the one being published
+	PolicyDropOldest Policy = "DROP_OLDEST"
+)
@@ -0,0 +1,219 @@
+package eventbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Handler func(event Event)
+
+/*
+	Bus delivers every published event to the subscribers interested in its type.
+
+	Synchronous subscribers are called by the publisher itself, in the order they subscribed -
+	a slow synchronous subscriber slows down the machine, so they should only do cheap work.
+	Asynchronous subscribers get their own goroutine and a buffer of events, what happens when
+	the buffer is full is decided by the subscriber's policy.
+*/
+type Bus interface {
+	Publish(event Event)
+	Subscribe(handler Handler, opts ...SubscribeOption) Subscription
+	// Close unsubscribes everyone, asynchronous subscribers first handle the events already buffered
+	Close()
+}
+
+type Subscription interface {
+	// Unsubscribe stops deliveries, it must not be called from the subscriber's own asynchronous handler
+	Unsubscribe()
+	// Dropped returns the number of events dropped because the buffer was full
+	Dropped() int
+}
+
+type subscribeConfig struct {
+	types      map[Type]bool
+	async      bool
+	bufferSize int
+	policy     Policy
+}
+
+type SubscribeOption func(cfg *subscribeConfig)
+
+// Types restricts the subscription to the given event types, by default all events are delivered
+func Types(types ...Type) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		for _, t := range types {
+			cfg.types[t] = true
+		}
+	}
+}
+
+// Async delivers events from a goroutine of the subscriber, through a buffer of the given size [ at least 1 ]
+func Async(bufferSize int, policy Policy) SubscribeOption {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return func(cfg *subscribeConfig) {
+		cfg.async = true
+		cfg.bufferSize = bufferSize
+		cfg.policy = policy
+	}
+}
+
+type subscription struct {
+	// dropped is first, so that it is 64 bit aligned for atomic operations
+	dropped int64
+	bus     *busImpl
+	cfg     subscribeConfig
+	handler Handler
+	// mutex guards closing the events channel, publishers hold it for reading while sending
+	mutex  sync.RWMutex
+	closed bool
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+type busImpl struct {
+	mutex         sync.RWMutex
+	subscriptions []*subscription
+}
+
+func New() Bus {
+	return &busImpl{
+		mutex:         sync.RWMutex{},
+		subscriptions: make([]*subscription, 0),
+	}
+}
+
+func (b *busImpl) Subscribe(handler Handler, opts ...SubscribeOption) Subscription {
+	cfg := subscribeConfig{types: make(map[Type]bool, 0), policy: PolicyBlock}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	sub := &subscription{
+		bus:     b,
+		cfg:     cfg,
+		handler: handler,
+		mutex:   sync.RWMutex{},
+		done:    make(chan struct{}),
+	}
+	if cfg.async {
+		sub.events = make(chan Event, cfg.bufferSize)
+		go sub.run()
+	} else {
+		close(sub.done)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.subscriptions = append(b.subscriptions, sub)
+	return sub
+}
+
+func (b *busImpl) Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	b.mutex.RLock()
+	subscriptions := append([]*subscription{}, b.subscriptions...)
+	b.mutex.RUnlock()
+
+	for _, sub := range subscriptions {
+		if len(sub.cfg.types) > 0 && !sub.cfg.types[event.Type] {
+			continue
+		}
+		sub.deliver(event)
+	}
+}
+
+func (b *busImpl) Close() {
+	b.mutex.RLock()
+	subscriptions := append([]*subscription{}, b.subscriptions...)
+	b.mutex.RUnlock()
+
+	for _, sub := range subscriptions {
+		sub.Unsubscribe()
+	}
+}
+
+func (b *busImpl) remove(sub *subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for idx, s := range b.subscriptions {
+		if s == sub {
+			b.subscriptions = append(b.subscriptions[:idx:idx], b.subscriptions[idx+1:]...)
+			return
+		}
+	}
+}
+
+func (s *subscription) deliver(event Event) {
+	if !s.cfg.async {
+		s.handler(event)
+		return
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return
+	}
+	switch s.cfg.policy {
+	case PolicyDropNewest:
+		select {
+		case s.events <- event:
+		default:
+			s.drop()
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+			// make room, another publisher or the subscriber itself might take the oldest event first
+			select {
+			case <-s.events:
+				s.drop()
+			default:
+			}
+		}
+	default:
+		s.events <- event
+	}
+}
+
+func (s *subscription) drop() {
+	atomic.AddInt64(&s.dropped, 1)
+}
+
+func (s *subscription) Dropped() int {
+	return int(atomic.LoadInt64(&s.dropped))
+}
+
+func (s *subscription) run() {
+	defer close(s.done)
+	for event := range s.events {
+		s.handler(event)
+	}
+}
+
+func (s *subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.remove(s)
+		if s.cfg.async {
+			s.mutex.Lock()
+			s.closed = true
+			close(s.events)
+			s.mutex.Unlock()
+		}
+	})
+	<-s.done
+}
@@ -0,0 +1,166 @@
+package eventbus
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publishAll(b Bus, types ...Type) {
+	for _, t := range types {
+		b.Publish(Event{Type: t})
+	}
+}
+
+func typesOf(events []Event) []Type {
+	got := make([]Type, 0)
+	for _, event := range events {
+		got = append(got, event.Type)
+	}
+	return got
+}
+
+func TestBus_Subscribe(t *testing.T) {
+	published := []Type{TypeOrderReceived, TypeReservationTaken, TypeIngredientConsumed, TypeDrinkPrepared}
+
+	tests := []struct {
+		name string
+		opts []SubscribeOption
+		want []Type
+	}{
+		{
+			name: "success | synchronous subscriber gets every event",
+			want: published,
+		},
+		{
+			name: "success | synchronous subscriber filtered by type",
+			opts: []SubscribeOption{Types(TypeOrderReceived, TypeDrinkPrepared)},
+			want: []Type{TypeOrderReceived, TypeDrinkPrepared},
+		},
+		{
+			name: "success | asynchronous subscriber gets every event in order",
+			opts: []SubscribeOption{Async(1, PolicyBlock)},
+			want: published,
+		},
+		{
+			name: "success | asynchronous subscriber filtered by type",
+			opts: []SubscribeOption{Async(10, PolicyDropNewest), Types(TypeIngredientConsumed)},
+			want: []Type{TypeIngredientConsumed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			got := make([]Event, 0)
+			sub := b.Subscribe(func(event Event) {
+				got = append(got, event)
+			}, tt.opts...)
+
+			publishAll(b, published...)
+			b.Close()
+
+			assert.Equal(t, tt.want, typesOf(got))
+			assert.Equal(t, 0, sub.Dropped())
+			for _, event := range got {
+				assert.False(t, event.At.IsZero())
+			}
+		})
+	}
+}
+
+func TestBus_BackPressure(t *testing.T) {
+	published := []Type{TypeOrderReceived, TypeReservationTaken, TypeIngredientConsumed, TypeDrinkPrepared}
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		want        []Type
+		wantDropped int
+	}{
+		{
+			name:   "success | block waits for the subscriber",
+			policy: PolicyBlock,
+			want:   published,
+		},
+		{
+			name:        "success | drop newest keeps the buffered events",
+			policy:      PolicyDropNewest,
+			want:        []Type{TypeOrderReceived, TypeReservationTaken},
+			wantDropped: 2,
+		},
+		{
+			name:        "success | drop oldest keeps the latest events",
+			policy:      PolicyDropOldest,
+			want:        []Type{TypeIngredientConsumed, TypeDrinkPrepared},
+			wantDropped: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			// the subscriber is stuck on a first event, till everything else is published
+			started, release := make(chan struct{}), make(chan struct{})
+			got := make([]Event, 0)
+			sub := b.Subscribe(func(event Event) {
+				if event.Type == TypeRefilled {
+					close(started)
+					<-release
+					return
+				}
+				got = append(got, event)
+			}, Async(2, tt.policy))
+
+			b.Publish(Event{Type: TypeRefilled})
+			<-started
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				publishAll(b, published...)
+			}()
+			// dropping never blocks the publisher, so everything is published before the subscriber continues
+			if tt.policy != PolicyBlock {
+				<-done
+			}
+			close(release)
+			<-done
+			b.Close()
+
+			assert.Equal(t, tt.want, typesOf(got))
+			assert.Equal(t, tt.wantDropped, sub.Dropped())
+		})
+	}
+}
+
+func TestBus_ConcurrentPublish(t *testing.T) {
+	b := New()
+
+	mutex := sync.Mutex{}
+	syncCnt, asyncCnt := 0, 0
+	b.Subscribe(func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		syncCnt += 1
+	})
+	// only the subscriber's goroutine runs the asynchronous handler
+	b.Subscribe(func(event Event) {
+		asyncCnt += 1
+	}, Async(4, PolicyBlock))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.Publish(Event{Type: TypeDrinkPrepared})
+			}
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	assert.Equal(t, 800, syncCnt)
+	assert.Equal(t, 800, asyncCnt)
+}
@@ -0,0 +1,46 @@
+package fleet
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/heater"
+	"coffeeMachine/src/services/vendingmachine"
+)
+
+// Machine is a member of the fleet, every machine has its own inventory - orders are routed by its Inventory
+type Machine struct {
+	ID            string
+	CoffeeMachine vendingmachine.CoffeeMachine
+	// Heater is optional, the machine's heater if it has one - machines which are hot already are preferred
+	Heater heater.Heater
+}
+
+type Params struct {
+	// Machines are in the order of preference, when any of them could prepare an order as soon as the others
+	Machines []Machine
+	// Clock is optional, if not set - orders no machine could take are stamped with the wall clock
+	Clock clock.Clock
+}
+
+// Routed is the outcome of an order, and the machine it was prepared at - empty if no machine could prepare it
+type Routed struct {
+	MachineID string
+	Response  *entities.GetItemResponse
+	// Attempts is the number of machines the order was routed to, before it was prepared or rejected for good
+	Attempts int
+}
+
+type MachineHealth struct {
+	MachineID string
+	State     vendingmachine.State
+	// InFlight is the number of orders routed to the machine, which aren't served yet
+	InFlight int
+	// Prepared & Rejected count the orders routed to the machine, since the fleet was created
+	Prepared int
+	Rejected int
+	// OverdueCleanings & ColdBoilers count the cleaning rules & boilers, which would hold drinks up
+	OverdueCleanings int
+	ColdBoilers      int
+	// Healthy is set if the machine is READY, and nothing holds drinks up
+	Healthy bool
+}
@@ -0,0 +1,260 @@
+package fleet
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Fleet manages many coffee machines in-process, as if they were one
+type Fleet interface {
+	// Pour routes the item to the machine which can prepare it soonest, see fleetImpl.Pour
+	Pour(ctx context.Context, item entities.Item) *Routed
+	// Inventory sums the levels of the ingredients over the fleet, for every ingredient any machine holds if none are given
+	Inventory(ctx context.Context, ingredientIDs ...string) ([]resourcemanager.Levels, error)
+	Health(ctx context.Context) []MachineHealth
+}
+
+type member struct {
+	Machine
+	// inFlight, prepared & rejected are only updated atomically
+	inFlight int64
+	prepared int64
+	rejected int64
+}
+
+type fleetImpl struct {
+	members []*member
+	clock   clock.Clock
+}
+
+func New(p Params) Fleet {
+	members := make([]*member, 0, len(p.Machines))
+	for _, machine := range p.Machines {
+		members = append(members, &member{Machine: machine})
+	}
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	return &fleetImpl{
+		members: members,
+		clock:   clk,
+	}
+}
+
+// candidate is a machine which can prepare an item, and how soon
+type candidate struct {
+	member   *member
+	heatWait time.Duration
+	inFlight int64
+	rank     int
+}
+
+/*
+	Pour only considers machines which are READY, and have every ingredient of the item available.
+	Among those the item goes to the machine whose boilers are hot enough soonest, then to the one with the
+	fewest orders in flight, then by the order of the machines.
+
+	The levels may change before the machine gets to the item, so if it's rejected for a reason another
+	machine may not share [ e.g. the ingredient was taken meanwhile ] - the item is routed to the next one.
+*/
+func (f *fleetImpl) Pour(ctx context.Context, item entities.Item) *Routed {
+	candidates := f.candidates(ctx, item)
+	if len(candidates) == 0 {
+		return &Routed{Response: f.noMachineAvailable(item)}
+	}
+
+	routed := &Routed{}
+	for _, cand := range candidates {
+		routed.MachineID = cand.member.ID
+		routed.Response = f.pourAt(ctx, cand.member, item)
+		routed.Attempts += 1
+		if routed.Response.Outcome == entities.GetItemOutcomePrepared || !reroutable(routed.Response) {
+			break
+		}
+	}
+	return routed
+}
+
+func (f *fleetImpl) pourAt(ctx context.Context, m *member, item entities.Item) *entities.GetItemResponse {
+	atomic.AddInt64(&m.inFlight, 1)
+	defer atomic.AddInt64(&m.inFlight, -1)
+
+	var resp *entities.GetItemResponse
+	for resp = range m.CoffeeMachine.PourDrinks(ctx, []entities.Item{item}) {
+	}
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		atomic.AddInt64(&m.prepared, 1)
+	} else {
+		atomic.AddInt64(&m.rejected, 1)
+	}
+	return resp
+}
+
+func (f *fleetImpl) candidates(ctx context.Context, item entities.Item) []candidate {
+	candidates := make([]candidate, 0, len(f.members))
+	for rank, m := range f.members {
+		if m.CoffeeMachine.State(ctx) != vendingmachine.StateReady || !hasIngredients(ctx, m.CoffeeMachine, item) {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			member:   m,
+			heatWait: heatWait(m, item),
+			inFlight: atomic.LoadInt64(&m.inFlight),
+			rank:     rank,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].heatWait != candidates[j].heatWait {
+			return candidates[i].heatWait < candidates[j].heatWait
+		}
+		if candidates[i].inFlight != candidates[j].inFlight {
+			return candidates[i].inFlight < candidates[j].inFlight
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+	return candidates
+}
+
+/*
+	hasIngredients checks the levels the machine reports, so the fleet never reaches around it into its ledger.
+	Only the item's ingredients are read [ Levels, not Inventory ] - routing must not lock the machine's pours out.
+*/
+func hasIngredients(ctx context.Context, coffeeMachine vendingmachine.CoffeeMachine, item entities.Item) bool {
+	ingredientIDs := make([]string, 0, len(item.Ingredients))
+	for _, ingredient := range item.Ingredients {
+		ingredientIDs = append(ingredientIDs, ingredient.ID)
+	}
+	levels, err := coffeeMachine.Levels(ctx, ingredientIDs...)
+	if err != nil {
+		return false
+	}
+	for idx, ingredient := range item.Ingredients {
+		if levels[idx].Deactivated || levels[idx].Available < ingredient.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// heatWait is how long till the boilers of the item's ingredients are hot enough, zero if the machine has no heater
+func heatWait(m *member, item entities.Item) time.Duration {
+	if m.Heater == nil {
+		return 0
+	}
+	ingredientIDs := make([]string, 0, len(item.Ingredients))
+	for _, ingredient := range item.Ingredients {
+		ingredientIDs = append(ingredientIDs, ingredient.ID)
+	}
+	wait := time.Duration(0)
+	for _, status := range m.Heater.Status(ingredientIDs...) {
+		if status.ReadyIn > wait {
+			wait = status.ReadyIn
+		}
+	}
+	return wait
+}
+
+// reroutable tells if another machine might prepare an item the machine rejected
+func reroutable(resp *entities.GetItemResponse) bool {
+	switch resp.RejectReasons[0].Code {
+	case entities.RejectCodeInsufficient, entities.RejectCodeTemporarilyNotAvailable, entities.RejectCodeNotAvailable,
+		entities.RejectCodeMachineNotReady, entities.RejectCodeBelowTemperature, entities.RejectCodeExpired,
+		entities.RejectCodeIngredientDeactivated:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *fleetImpl) noMachineAvailable(item entities.Item) *entities.GetItemResponse {
+	err := entities.ErrNoMachineAvailable{ItemID: item.ID}
+	return &entities.GetItemResponse{
+		Item:     item,
+		Outcome:  entities.GetItemOutcomeNotPrepared,
+		OutletID: -1,
+		ServedAt: f.clock.Now(),
+		RejectReasons: []entities.RejectReason{
+			{
+				Code:            entities.RejectCodeNoMachineAvailable,
+				RejectReasonMsg: err.Error(),
+			},
+		},
+	}
+}
+
+/*
+	Inventory sums the quantities of every machine. An ingredient is only reported deactivated if it is on every
+	machine holding it - the quantities of the machines it's deactivated on are summed all the same.
+*/
+func (f *fleetImpl) Inventory(ctx context.Context, ingredientIDs ...string) ([]resourcemanager.Levels, error) {
+	totals := make(map[string]*resourcemanager.Levels, 0)
+	for _, m := range f.members {
+		inventory, err := m.CoffeeMachine.Inventory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, levels := range inventory.Ingredients {
+			total, ok := totals[levels.IngredientID]
+			if !ok {
+				total = &resourcemanager.Levels{IngredientID: levels.IngredientID, Deactivated: true}
+				totals[levels.IngredientID] = total
+			}
+			total.Deactivated = total.Deactivated && levels.Deactivated
+			total.OnHand += levels.OnHand
+			total.Reserved += levels.Reserved
+			total.Available += levels.Available
+		}
+	}
+
+	if len(ingredientIDs) == 0 {
+		for ingredientID := range totals {
+			ingredientIDs = append(ingredientIDs, ingredientID)
+		}
+		sort.Strings(ingredientIDs)
+	}
+	inventory := make([]resourcemanager.Levels, 0, len(ingredientIDs))
+	for _, ingredientID := range ingredientIDs {
+		if total, ok := totals[ingredientID]; ok {
+			inventory = append(inventory, *total)
+			continue
+		}
+		inventory = append(inventory, resourcemanager.Levels{IngredientID: ingredientID})
+	}
+	return inventory, nil
+}
+
+// Health reports every machine, in the order of the machines
+func (f *fleetImpl) Health(ctx context.Context) []MachineHealth {
+	report := make([]MachineHealth, 0, len(f.members))
+	for _, m := range f.members {
+		health := MachineHealth{
+			MachineID: m.ID,
+			State:     m.CoffeeMachine.State(ctx),
+			InFlight:  int(atomic.LoadInt64(&m.inFlight)),
+			Prepared:  int(atomic.LoadInt64(&m.prepared)),
+			Rejected:  int(atomic.LoadInt64(&m.rejected)),
+		}
+		for _, hygiene := range m.CoffeeMachine.Hygiene(ctx) {
+			if hygiene.Overdue {
+				health.OverdueCleanings += 1
+			}
+		}
+		if m.Heater != nil {
+			for _, status := range m.Heater.Status() {
+				if status.ReadyIn > 0 {
+					health.ColdBoilers += 1
+				}
+			}
+		}
+		health.Healthy = health.State == vendingmachine.StateReady && health.OverdueCleanings == 0 && health.ColdBoilers == 0
+		report = append(report, health)
+	}
+	return report
+}
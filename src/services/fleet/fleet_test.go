@@ -0,0 +1,243 @@
+package fleet
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/heater"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	hotTea = entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 200}}}
+	latte  = entities.Item{ID: "latte", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 50}, {ID: "hot_milk", Quantity: 150}}}
+)
+
+type machineSpec struct {
+	id        string
+	inventory []entities.Ingredient
+	state     vendingmachine.State
+	// deactivated ingredients are refilled, and then deactivated
+	deactivated []string
+	// warmUp & heaterClock are optional, the machine has a cold hot_water boiler if warmUp is set
+	warmUp      time.Duration
+	heaterClock clock.Clock
+	maxHeatWait time.Duration
+}
+
+func newMachine(ctx context.Context, spec machineSpec) Machine {
+	p := vendingmachine.Params{
+		ResourceManager: resourcemanager.New(),
+		NumOfOutlets:    1,
+		Menu:            []entities.Item{hotTea, latte},
+		MaxHeatWait:     spec.maxHeatWait,
+	}
+	var h heater.Heater
+	if spec.warmUp > 0 {
+		h = heater.New(heater.Params{
+			Boilers:            []heater.Boiler{{Ingredient: "hot_water", TargetTemperature: 95, MinTemperature: 85, Capacity: 1000, WarmUp: spec.warmUp}},
+			AmbientTemperature: 20,
+			Clock:              spec.heaterClock,
+		})
+		p.Heater = h
+		p.Clock = spec.heaterClock
+	}
+	c := vendingmachine.New(p)
+	for _, ingredient := range spec.inventory {
+		if err := c.Refill(ctx, ingredient); err != nil {
+			panic(err)
+		}
+	}
+	for _, ingredientID := range spec.deactivated {
+		if err := c.DeactivateIngredient(ctx, vendingmachine.IngredientRequest{IngredientID: ingredientID}); err != nil {
+			panic(err)
+		}
+	}
+	if spec.state != "" {
+		if err := c.SetState(ctx, vendingmachine.SetStateRequest{State: spec.state}); err != nil {
+			panic(err)
+		}
+	}
+	return Machine{ID: spec.id, CoffeeMachine: c, Heater: h}
+}
+
+func newFleet(ctx context.Context, specs []machineSpec) Fleet {
+	machines := make([]Machine, 0, len(specs))
+	for _, spec := range specs {
+		machines = append(machines, newMachine(ctx, spec))
+	}
+	return New(Params{Machines: machines})
+}
+
+func Test_fleetImpl_Pour(t *testing.T) {
+	ctx := context.Background()
+	water := entities.Ingredient{ID: "hot_water", Quantity: 1000}
+	milk := entities.Ingredient{ID: "hot_milk", Quantity: 1000}
+	frozenClock := clock.NewFake(time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name          string
+		machines      []machineSpec
+		item          entities.Item
+		wantMachineID string
+		wantAttempts  int
+		// wantRejectCode is empty if the drink is prepared
+		wantRejectCode entities.RejectCode
+	}{
+		{
+			name: "success | first machine preferred",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water, milk}},
+				{id: "b", inventory: []entities.Ingredient{water, milk}},
+			},
+			item:          latte,
+			wantMachineID: "a",
+			wantAttempts:  1,
+		},
+		{
+			name: "success | routed to the machine with the ingredients",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water}},
+				{id: "b", inventory: []entities.Ingredient{water, milk}},
+			},
+			item:          latte,
+			wantMachineID: "b",
+			wantAttempts:  1,
+		},
+		{
+			name: "success | machine in maintenance skipped",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water}, state: vendingmachine.StateMaintenance},
+				{id: "b", inventory: []entities.Ingredient{water}},
+			},
+			item:          hotTea,
+			wantMachineID: "b",
+			wantAttempts:  1,
+		},
+		{
+			name: "success | machine with the ingredient deactivated skipped",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water, milk}, deactivated: []string{"hot_milk"}},
+				{id: "b", inventory: []entities.Ingredient{water, milk}},
+			},
+			item:          latte,
+			wantMachineID: "b",
+			wantAttempts:  1,
+		},
+		{
+			name: "success | hot machine preferred",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water}, warmUp: time.Minute, heaterClock: frozenClock, maxHeatWait: time.Hour},
+				{id: "b", inventory: []entities.Ingredient{water}},
+			},
+			item:          hotTea,
+			wantMachineID: "b",
+			wantAttempts:  1,
+		},
+		{
+			name: "success | rerouted once rejected",
+			machines: []machineSpec{
+				// a would be hot sooner, but doesn't wait at all
+				{id: "a", inventory: []entities.Ingredient{water}, warmUp: 10 * time.Millisecond, heaterClock: frozenClock},
+				{id: "b", inventory: []entities.Ingredient{water}, warmUp: 200 * time.Millisecond, heaterClock: clock.New(), maxHeatWait: time.Second},
+			},
+			item:          hotTea,
+			wantMachineID: "b",
+			wantAttempts:  2,
+		},
+		{
+			name: "error | no machine has the ingredients",
+			machines: []machineSpec{
+				{id: "a", inventory: []entities.Ingredient{water}},
+				{id: "b", inventory: []entities.Ingredient{{ID: "hot_water", Quantity: 10}, milk}},
+			},
+			item:           latte,
+			wantRejectCode: entities.RejectCodeNoMachineAvailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFleet(ctx, tt.machines)
+			routed := f.Pour(ctx, tt.item)
+
+			assert.Equal(t, tt.wantMachineID, routed.MachineID)
+			assert.Equal(t, tt.wantAttempts, routed.Attempts)
+			if tt.wantRejectCode != "" {
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, routed.Response.Outcome)
+				assert.Equal(t, tt.wantRejectCode, routed.Response.RejectReasons[0].Code)
+				return
+			}
+			assert.Equal(t, entities.GetItemOutcomePrepared, routed.Response.Outcome)
+		})
+	}
+}
+
+func Test_fleetImpl_Inventory(t *testing.T) {
+	ctx := context.Background()
+
+	f := newFleet(ctx, []machineSpec{
+		{id: "a", inventory: []entities.Ingredient{{ID: "hot_water", Quantity: 500}}},
+		{id: "b", inventory: []entities.Ingredient{{ID: "hot_water", Quantity: 300}, {ID: "hot_milk", Quantity: 200}}},
+		{
+			id:          "c",
+			inventory:   []entities.Ingredient{{ID: "hot_water", Quantity: 100}, {ID: "sugar_syrup", Quantity: 50}},
+			deactivated: []string{"hot_water", "sugar_syrup"},
+		},
+	})
+	f.Pour(ctx, hotTea)
+
+	tests := []struct {
+		name          string
+		ingredientIDs []string
+		want          []resourcemanager.Levels
+	}{
+		{
+			name: "success | every ingredient",
+			// hot_water is still active on the other machines, sugar_syrup is deactivated on the only one holding it
+			want: []resourcemanager.Levels{
+				{IngredientID: "hot_milk", OnHand: 200, Available: 200},
+				{IngredientID: "hot_water", OnHand: 700, Available: 700},
+				{IngredientID: "sugar_syrup", OnHand: 50, Available: 50, Deactivated: true},
+			},
+		},
+		{
+			name:          "success | given ingredients",
+			ingredientIDs: []string{"vanilla_syrup", "hot_water"},
+			want: []resourcemanager.Levels{
+				{IngredientID: "vanilla_syrup"},
+				{IngredientID: "hot_water", OnHand: 700, Available: 700},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Inventory(ctx, tt.ingredientIDs...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_fleetImpl_Health(t *testing.T) {
+	ctx := context.Background()
+
+	f := newFleet(ctx, []machineSpec{
+		{id: "a", inventory: []entities.Ingredient{{ID: "hot_water", Quantity: 300}}},
+		{id: "b", state: vendingmachine.StateMaintenance},
+		{id: "c", warmUp: time.Minute, heaterClock: clock.NewFake(time.Now())},
+	})
+	f.Pour(ctx, hotTea)
+	// no machine can prepare another one, so it's rejected without being routed - nor counted
+	f.Pour(ctx, hotTea)
+
+	assert.Equal(t, []MachineHealth{
+		{MachineID: "a", State: vendingmachine.StateReady, Prepared: 1, Healthy: true},
+		{MachineID: "b", State: vendingmachine.StateMaintenance},
+		{MachineID: "c", State: vendingmachine.StateReady, ColdBoilers: 1},
+	}, f.Health(ctx))
+}
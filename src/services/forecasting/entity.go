@@ -0,0 +1,65 @@
+package forecasting
+
+import (
+	"coffeeMachine/src/entities"
+	"time"
+)
+
+type ForecastRequest struct {
+	// Now is the instant the forecast is made for, history is read over [Now-Window, Now)
+	Now    time.Time
+	Window time.Duration
+}
+
+// Validate rejects a window which isn't positive, rates are averaged over it
+func (r ForecastRequest) Validate() error {
+	if r.Window <= 0 {
+		return entities.ErrInvalidDuration{Field: "window", Duration: r.Window}
+	}
+	return nil
+}
+
+type PlanRequest struct {
+	Now    time.Time
+	Window time.Duration
+	// Horizon is how long the machine should keep serving the top beverages without another refill
+	Horizon time.Duration
+	// TopN is the number of best selling beverages which should stay available
+	TopN int
+}
+
+func (r PlanRequest) Validate() error {
+	if r.Window <= 0 {
+		return entities.ErrInvalidDuration{Field: "window", Duration: r.Window}
+	}
+	if r.Horizon < 0 {
+		return entities.ErrInvalidDuration{Field: "horizon", Duration: r.Horizon}
+	}
+	if r.TopN < 0 {
+		return entities.ErrInvalidCount{Field: "top", Count: r.TopN}
+	}
+	return nil
+}
+
+// Depletion is the forecast for a single ingredient
+type Depletion struct {
+	IngredientID string
+	// Available is the quantity on hand, less what reservations hold
+	Available int
+	// RatePerHour is the average consumption observed over the window
+	RatePerHour float64
+	// TimeToDepletion is nil if the ingredient isn't being consumed at all
+	TimeToDepletion *time.Duration
+}
+
+// Refill is a recommendation to refill an ingredient with Quantity units before RefillBy
+type Refill struct {
+	IngredientID string
+	Quantity     int
+	RefillBy     time.Time
+}
+
+type RefillPlan struct {
+	TopBeverages []string
+	Refills      []Refill
+}
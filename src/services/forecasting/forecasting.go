@@ -0,0 +1,198 @@
+package forecasting
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/reporting"
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Forecaster estimates when ingredients run out, and what to refill to keep the best sellers available
+type Forecaster interface {
+	Forecast(ctx context.Context, req ForecastRequest) ([]Depletion, error)
+	PlanRefills(ctx context.Context, req PlanRequest) (*RefillPlan, error)
+}
+
+type forecasterImpl struct {
+	store           reporting.Store
+	resourceManager resourcemanager.Repository
+	recipes         []entities.Item
+}
+
+type Params struct {
+	Store           reporting.Store
+	ResourceManager resourcemanager.Repository
+	// Recipes is optional, recipes of beverages which were never prepared can't be learnt from the history
+	Recipes []entities.Item
+}
+
+func New(p Params) Forecaster {
+	return &forecasterImpl{
+		store:           p.Store,
+		resourceManager: p.ResourceManager,
+		recipes:         p.Recipes,
+	}
+}
+
+/*
+	The consumption rate of an ingredient is the average over the window, and the time to depletion
+	is the currently available quantity [ on hand, less what reservations hold ] divided by that rate.
+*/
+func (f *forecasterImpl) Forecast(ctx context.Context, req ForecastRequest) ([]Depletion, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	records, err := f.store.Records(ctx, req.Now.Add(-req.Window), req.Now)
+	if err != nil {
+		return nil, err
+	}
+	report := reporting.Build(records, req.Now.Add(-req.Window), req.Now)
+
+	ingredientIDs := make(map[string]bool, 0)
+	for ingredientID := range report.Total.Consumed {
+		ingredientIDs[ingredientID] = true
+	}
+	for _, recipe := range f.knownRecipes(records) {
+		for _, ingredient := range recipe.Ingredients {
+			ingredientIDs[ingredient.ID] = true
+		}
+	}
+
+	depletions := make([]Depletion, 0, len(ingredientIDs))
+	for ingredientID := range ingredientIDs {
+		available, err := f.available(ctx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		depletion := Depletion{
+			IngredientID: ingredientID,
+			Available:    available,
+			RatePerHour:  float64(report.Total.Consumed[ingredientID]) / req.Window.Hours(),
+		}
+		if depletion.RatePerHour > 0 {
+			timeToDepletion := time.Duration(float64(available) / depletion.RatePerHour * float64(time.Hour))
+			depletion.TimeToDepletion = &timeToDepletion
+		}
+		depletions = append(depletions, depletion)
+	}
+
+	// soonest to run out first, ingredients which aren't consumed at all last
+	sort.Slice(depletions, func(i, j int) bool {
+		a, b := depletions[i].TimeToDepletion, depletions[j].TimeToDepletion
+		if a != nil && b != nil && *a != *b {
+			return *a < *b
+		}
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		return depletions[i].IngredientID < depletions[j].IngredientID
+	})
+	return depletions, nil
+}
+
+/*
+	PlanRefills picks the TopN beverages by demand (prepared + not prepared) over the window.
+	For every ingredient of these beverages, the machine needs enough to cover the forecast consumption
+	over the horizon, plus one serving of the largest recipe - so that the beverage is still available at the end of it.
+	If less is available, we recommend refilling the difference, before the ingredient falls below one serving.
+*/
+func (f *forecasterImpl) PlanRefills(ctx context.Context, req PlanRequest) (*RefillPlan, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	records, err := f.store.Records(ctx, req.Now.Add(-req.Window), req.Now)
+	if err != nil {
+		return nil, err
+	}
+	report := reporting.Build(records, req.Now.Add(-req.Window), req.Now)
+	recipes := f.knownRecipes(records)
+
+	beverageIDs := make([]string, 0, len(report.Beverages))
+	for beverageID := range report.Beverages {
+		if _, ok := recipes[beverageID]; ok {
+			beverageIDs = append(beverageIDs, beverageID)
+		}
+	}
+	sort.Slice(beverageIDs, func(i, j int) bool {
+		a, b := report.Beverages[beverageIDs[i]], report.Beverages[beverageIDs[j]]
+		if a.Prepared+a.NotPrepared != b.Prepared+b.NotPrepared {
+			return a.Prepared+a.NotPrepared > b.Prepared+b.NotPrepared
+		}
+		return beverageIDs[i] < beverageIDs[j]
+	})
+	if len(beverageIDs) > req.TopN {
+		beverageIDs = beverageIDs[:req.TopN]
+	}
+
+	servings := make(map[string]int, 0)
+	for _, beverageID := range beverageIDs {
+		for _, ingredient := range recipes[beverageID].Ingredients {
+			if ingredient.Quantity > servings[ingredient.ID] {
+				servings[ingredient.ID] = ingredient.Quantity
+			}
+		}
+	}
+
+	plan := &RefillPlan{
+		TopBeverages: beverageIDs,
+		Refills:      make([]Refill, 0),
+	}
+	for ingredientID, serving := range servings {
+		available, err := f.available(ctx, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		ratePerHour := float64(report.Total.Consumed[ingredientID]) / req.Window.Hours()
+		needed := int(math.Ceil(ratePerHour*req.Horizon.Hours())) + serving
+		if available >= needed {
+			continue
+		}
+
+		refillBy := req.Now
+		if ratePerHour > 0 && available > serving {
+			refillBy = req.Now.Add(time.Duration(float64(available-serving) / ratePerHour * float64(time.Hour)))
+		}
+		plan.Refills = append(plan.Refills, Refill{
+			IngredientID: ingredientID,
+			Quantity:     needed - available,
+			RefillBy:     refillBy,
+		})
+	}
+
+	sort.Slice(plan.Refills, func(i, j int) bool {
+		if !plan.Refills[i].RefillBy.Equal(plan.Refills[j].RefillBy) {
+			return plan.Refills[i].RefillBy.Before(plan.Refills[j].RefillBy)
+		}
+		return plan.Refills[i].IngredientID < plan.Refills[j].IngredientID
+	})
+	return plan, nil
+}
+
+// knownRecipes merges the configured recipes with the ones learnt from prepared drinks in the history
+func (f *forecasterImpl) knownRecipes(records []reporting.Record) map[string]entities.Item {
+	recipes := make(map[string]entities.Item, 0)
+	for _, record := range records {
+		if record.Outcome == entities.GetItemOutcomePrepared {
+			recipes[record.ItemID] = entities.Item{ID: record.ItemID, Ingredients: record.Ingredients}
+		}
+	}
+	for _, recipe := range f.recipes {
+		recipes[recipe.ID] = recipe
+	}
+	return recipes
+}
+
+// available is the quantity on hand less what reservations hold, an ingredient unknown to the resource manager is empty
+func (f *forecasterImpl) available(ctx context.Context, ingredientID string) (int, error) {
+	levels, err := f.resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredientID})
+	if _, ok := err.(entities.ErrResourceNotAvailable); ok {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return levels.Available, nil
+}
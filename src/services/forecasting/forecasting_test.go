@@ -0,0 +1,182 @@
+package forecasting
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/reporting"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _Now = time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+
+var (
+	_BlackTea = entities.Item{
+		ID: "black_tea",
+		Ingredients: []entities.Ingredient{
+			{ID: "hot_water", Quantity: 300},
+			{ID: "tea_leaves_syrup", Quantity: 30},
+		},
+	}
+	_HotTea = entities.Item{
+		ID: "hot_tea",
+		Ingredients: []entities.Ingredient{
+			{ID: "hot_milk", Quantity: 100},
+			{ID: "tea_leaves_syrup", Quantity: 10},
+		},
+	}
+)
+
+// getForecaster returns a forecaster over 10 hours of history: 10 black teas prepared, 2 hot teas rejected.
+// The reserved quantities of the inventory are held by reservations
+func getForecaster(ctx context.Context, reserved ...entities.Ingredient) Forecaster {
+	store := reporting.NewMemoryStore()
+	for i := 0; i < 10; i++ {
+		_ = store.Record(ctx, &entities.GetItemResponse{
+			Item:     _BlackTea,
+			Outcome:  entities.GetItemOutcomePrepared,
+			ServedAt: _Now.Add(-time.Duration(i+1) * time.Hour),
+		})
+	}
+	for i := 0; i < 2; i++ {
+		_ = store.Record(ctx, &entities.GetItemResponse{
+			Item:     _HotTea,
+			Outcome:  entities.GetItemOutcomeNotPrepared,
+			ServedAt: _Now.Add(-time.Duration(i+1) * time.Hour),
+		})
+	}
+
+	resourceManager := resourcemanager.New()
+	for _, ingredient := range []entities.Ingredient{{ID: "hot_water", Quantity: 3000}, {ID: "tea_leaves_syrup", Quantity: 90}} {
+		_, _ = resourceManager.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+			IngredientID:     ingredient.ID,
+			UpdateType:       resourcemanager.UpdateTypeRefill,
+			ResourceQuantity: ingredient.Quantity,
+		})
+	}
+	for _, ingredient := range reserved {
+		_ = resourceManager.Reserve(ctx, resourcemanager.ReservationRequest{IngredientID: ingredient.ID, Quantity: ingredient.Quantity})
+	}
+
+	return New(Params{
+		Store:           store,
+		ResourceManager: resourceManager,
+		Recipes:         []entities.Item{_HotTea},
+	})
+}
+
+func Test_forecasterImpl_Forecast(t *testing.T) {
+	ctx := context.Background()
+
+	got, err := getForecaster(ctx).Forecast(ctx, ForecastRequest{Now: _Now, Window: 10 * time.Hour})
+	assert.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	assert.Equal(t, "tea_leaves_syrup", got[0].IngredientID)
+	assert.Equal(t, 90, got[0].Available)
+	assert.InDelta(t, 30, got[0].RatePerHour, 0.001)
+	assert.Equal(t, 3*time.Hour, *got[0].TimeToDepletion)
+
+	assert.Equal(t, "hot_water", got[1].IngredientID)
+	assert.Equal(t, 10*time.Hour, *got[1].TimeToDepletion)
+
+	// hot milk was never consumed, and isn't present in the machine
+	assert.Equal(t, "hot_milk", got[2].IngredientID)
+	assert.Equal(t, 0, got[2].Available)
+	assert.Nil(t, got[2].TimeToDepletion)
+
+	// two thirds of the tea leaves are held by reservations, so they can't be served
+	got, err = getForecaster(ctx, entities.Ingredient{ID: "tea_leaves_syrup", Quantity: 60}).Forecast(ctx, ForecastRequest{Now: _Now, Window: 10 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, "tea_leaves_syrup", got[0].IngredientID)
+	assert.Equal(t, 30, got[0].Available)
+	assert.Equal(t, time.Hour, *got[0].TimeToDepletion)
+
+	_, err = getForecaster(ctx).Forecast(ctx, ForecastRequest{Now: _Now})
+	assert.Equal(t, entities.ErrInvalidDuration{Field: "window"}, err)
+}
+
+func Test_forecasterImpl_PlanRefills(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  PlanRequest
+		// reserved quantities of the inventory are held by reservations
+		reserved []entities.Ingredient
+		assert   func(plan *RefillPlan, err error)
+	}{
+		{
+			name: "success | top beverage needs a refill before the horizon",
+			req:  PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: 4 * time.Hour, TopN: 1},
+			assert: func(plan *RefillPlan, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"black_tea"}, plan.TopBeverages)
+				assert.Equal(t, []Refill{
+					{IngredientID: "tea_leaves_syrup", Quantity: 60, RefillBy: _Now.Add(2 * time.Hour)},
+				}, plan.Refills)
+			},
+		},
+		{
+			name: "success | unavailable beverage in the top-n needs an immediate refill",
+			req:  PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: 4 * time.Hour, TopN: 2},
+			assert: func(plan *RefillPlan, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"black_tea", "hot_tea"}, plan.TopBeverages)
+				assert.Equal(t, []Refill{
+					{IngredientID: "hot_milk", Quantity: 100, RefillBy: _Now},
+					{IngredientID: "tea_leaves_syrup", Quantity: 60, RefillBy: _Now.Add(2 * time.Hour)},
+				}, plan.Refills)
+			},
+		},
+		{
+			name:     "success | reserved stock needs a refill too",
+			req:      PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: time.Hour, TopN: 1},
+			reserved: []entities.Ingredient{{ID: "tea_leaves_syrup", Quantity: 60}},
+			assert: func(plan *RefillPlan, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []Refill{
+					{IngredientID: "tea_leaves_syrup", Quantity: 30, RefillBy: _Now},
+				}, plan.Refills)
+			},
+		},
+		{
+			name: "success | short horizon, nothing to refill",
+			req:  PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: time.Hour, TopN: 1},
+			assert: func(plan *RefillPlan, err error) {
+				assert.NoError(t, err)
+				assert.Empty(t, plan.Refills)
+			},
+		},
+		{
+			name: "error | no window",
+			req:  PlanRequest{Now: _Now, Horizon: time.Hour, TopN: 1},
+			assert: func(plan *RefillPlan, err error) {
+				assert.Equal(t, entities.ErrInvalidDuration{Field: "window"}, err)
+			},
+		},
+		{
+			name: "error | negative horizon",
+			req:  PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: -time.Hour, TopN: 1},
+			assert: func(plan *RefillPlan, err error) {
+				assert.Equal(t, entities.ErrInvalidDuration{Field: "horizon", Duration: -time.Hour}, err)
+			},
+		},
+		{
+			name: "error | negative top-n",
+			req:  PlanRequest{Now: _Now, Window: 10 * time.Hour, Horizon: time.Hour, TopN: -1},
+			assert: func(plan *RefillPlan, err error) {
+				assert.Equal(t, entities.ErrInvalidCount{Field: "top", Count: -1}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getForecaster(ctx, tt.reserved...).PlanRefills(ctx, tt.req)
+			tt.assert(got, err)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package grpcapi
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/grpcapi/pb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toIngredient(ingredient *pb.Ingredient) entities.Ingredient {
+	return entities.Ingredient{ID: ingredient.Id, Quantity: int(ingredient.Quantity)}
+}
+
+func fromIngredients(ingredients []entities.Ingredient) []*pb.Ingredient {
+	converted := make([]*pb.Ingredient, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		converted = append(converted, &pb.Ingredient{Id: ingredient.ID, Quantity: int64(ingredient.Quantity)})
+	}
+	return converted
+}
+
+func toItems(items []*pb.Item) []entities.Item {
+	converted := make([]entities.Item, 0, len(items))
+	for _, item := range items {
+		ingredients := make([]entities.Ingredient, 0, len(item.Ingredients))
+		for _, ingredient := range item.Ingredients {
+			ingredients = append(ingredients, toIngredient(ingredient))
+		}
+		converted = append(converted, entities.Item{ID: item.Id, Ingredients: ingredients})
+	}
+	return converted
+}
+
+func fromItem(item entities.Item) *pb.Item {
+	return &pb.Item{Id: item.ID, Ingredients: fromIngredients(item.Ingredients)}
+}
+
+func fromItems(items []entities.Item) []*pb.Item {
+	converted := make([]*pb.Item, 0, len(items))
+	for _, item := range items {
+		converted = append(converted, fromItem(item))
+	}
+	return converted
+}
+
+func fromResponse(resp *entities.GetItemResponse) *pb.DrinkResponse {
+	converted := &pb.DrinkResponse{
+		Item:     fromItem(resp.Item),
+		Outcome:  pb.Outcome_OUTCOME_NOT_PREPARED,
+		OutletId: int32(resp.OutletID),
+		ServedAt: timestamppb.New(resp.ServedAt),
+	}
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		converted.Outcome = pb.Outcome_OUTCOME_PREPARED
+	}
+	for _, reason := range resp.RejectReasons {
+		converted.RejectReasons = append(converted.RejectReasons, &pb.RejectReason{Code: string(reason.Code), Message: reason.RejectReasonMsg})
+	}
+	for _, lot := range resp.Lots {
+		converted.Lots = append(converted.Lots, &pb.LotUsage{IngredientId: lot.IngredientID, LotId: lot.LotID, Quantity: int64(lot.Quantity)})
+	}
+	return converted
+}
+
+func fromEvent(event eventbus.Event) *pb.Event {
+	return &pb.Event{
+		Type:          string(event.Type),
+		At:            timestamppb.New(event.At),
+		OrderId:       event.OrderID,
+		Token:         event.Token,
+		OutletId:      int32(event.OutletID),
+		LotId:         event.LotID,
+		Ingredients:   fromIngredients(event.Ingredients),
+		Remaining:     fromIngredients(event.Remaining),
+		RejectReasons: event.RejectReasons,
+		State:         event.State,
+		Reason:        event.Reason,
+	}
+}
@@ -0,0 +1,14 @@
+package grpcapi
+
+import (
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/vendingmachine"
+)
+
+type Params struct {
+	Machine vendingmachine.CoffeeMachine
+	// EventBus is optional, the bus the machine publishes to - WatchEvents is unavailable if not set
+	EventBus eventbus.Bus
+	// EventBuffer is optional, the events buffered per watcher before the oldest are dropped - defaults to 256
+	EventBuffer int
+}
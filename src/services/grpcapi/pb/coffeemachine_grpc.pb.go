@@ -0,0 +1,306 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CoffeeMachineClient is the client API for CoffeeMachine service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CoffeeMachineClient interface {
+	// PourDrinks streams the response of every item, as soon as it's served - unless the machine plans
+	// its batches, then the responses are streamed in the order of the batch, after all of it is served
+	PourDrinks(ctx context.Context, in *PourDrinksRequest, opts ...grpc.CallOption) (CoffeeMachine_PourDrinksClient, error)
+	Refill(ctx context.Context, in *RefillRequest, opts ...grpc.CallOption) (*RefillResponse, error)
+	GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*GetInventoryResponse, error)
+	ListMenu(ctx context.Context, in *ListMenuRequest, opts ...grpc.CallOption) (*ListMenuResponse, error)
+	// WatchEvents streams the events of the machine, till the client cancels
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (CoffeeMachine_WatchEventsClient, error)
+}
+
+type coffeeMachineClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCoffeeMachineClient(cc grpc.ClientConnInterface) CoffeeMachineClient {
+	return &coffeeMachineClient{cc}
+}
+
+func (c *coffeeMachineClient) PourDrinks(ctx context.Context, in *PourDrinksRequest, opts ...grpc.CallOption) (CoffeeMachine_PourDrinksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CoffeeMachine_ServiceDesc.Streams[0], "/coffeemachine.v1.CoffeeMachine/PourDrinks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &coffeeMachinePourDrinksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CoffeeMachine_PourDrinksClient interface {
+	Recv() (*DrinkResponse, error)
+	grpc.ClientStream
+}
+
+type coffeeMachinePourDrinksClient struct {
+	grpc.ClientStream
+}
+
+func (x *coffeeMachinePourDrinksClient) Recv() (*DrinkResponse, error) {
+	m := new(DrinkResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *coffeeMachineClient) Refill(ctx context.Context, in *RefillRequest, opts ...grpc.CallOption) (*RefillResponse, error) {
+	out := new(RefillResponse)
+	err := c.cc.Invoke(ctx, "/coffeemachine.v1.CoffeeMachine/Refill", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coffeeMachineClient) GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*GetInventoryResponse, error) {
+	out := new(GetInventoryResponse)
+	err := c.cc.Invoke(ctx, "/coffeemachine.v1.CoffeeMachine/GetInventory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coffeeMachineClient) ListMenu(ctx context.Context, in *ListMenuRequest, opts ...grpc.CallOption) (*ListMenuResponse, error) {
+	out := new(ListMenuResponse)
+	err := c.cc.Invoke(ctx, "/coffeemachine.v1.CoffeeMachine/ListMenu", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coffeeMachineClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (CoffeeMachine_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CoffeeMachine_ServiceDesc.Streams[1], "/coffeemachine.v1.CoffeeMachine/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &coffeeMachineWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CoffeeMachine_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type coffeeMachineWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *coffeeMachineWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CoffeeMachineServer is the server API for CoffeeMachine service.
+// All implementations must embed UnimplementedCoffeeMachineServer
+// for forward compatibility
+type CoffeeMachineServer interface {
+	// PourDrinks streams the response of every item, as soon as it's served - unless the machine plans
+	// its batches, then the responses are streamed in the order of the batch, after all of it is served
+	PourDrinks(*PourDrinksRequest, CoffeeMachine_PourDrinksServer) error
+	Refill(context.Context, *RefillRequest) (*RefillResponse, error)
+	GetInventory(context.Context, *GetInventoryRequest) (*GetInventoryResponse, error)
+	ListMenu(context.Context, *ListMenuRequest) (*ListMenuResponse, error)
+	// WatchEvents streams the events of the machine, till the client cancels
+	WatchEvents(*WatchEventsRequest, CoffeeMachine_WatchEventsServer) error
+	mustEmbedUnimplementedCoffeeMachineServer()
+}
+
+// UnimplementedCoffeeMachineServer must be embedded to have forward compatible implementations.
+type UnimplementedCoffeeMachineServer struct {
+}
+
+func (UnimplementedCoffeeMachineServer) PourDrinks(*PourDrinksRequest, CoffeeMachine_PourDrinksServer) error {
+	return status.Errorf(codes.Unimplemented, "method PourDrinks not implemented")
+}
+func (UnimplementedCoffeeMachineServer) Refill(context.Context, *RefillRequest) (*RefillResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refill not implemented")
+}
+func (UnimplementedCoffeeMachineServer) GetInventory(context.Context, *GetInventoryRequest) (*GetInventoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInventory not implemented")
+}
+func (UnimplementedCoffeeMachineServer) ListMenu(context.Context, *ListMenuRequest) (*ListMenuResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMenu not implemented")
+}
+func (UnimplementedCoffeeMachineServer) WatchEvents(*WatchEventsRequest, CoffeeMachine_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedCoffeeMachineServer) mustEmbedUnimplementedCoffeeMachineServer() {}
+
+// UnsafeCoffeeMachineServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CoffeeMachineServer will
+// result in compilation errors.
+type UnsafeCoffeeMachineServer interface {
+	mustEmbedUnimplementedCoffeeMachineServer()
+}
+
+func RegisterCoffeeMachineServer(s grpc.ServiceRegistrar, srv CoffeeMachineServer) {
+	s.RegisterService(&CoffeeMachine_ServiceDesc, srv)
+}
+
+func _CoffeeMachine_PourDrinks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PourDrinksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CoffeeMachineServer).PourDrinks(m, &coffeeMachinePourDrinksServer{stream})
+}
+
+type CoffeeMachine_PourDrinksServer interface {
+	Send(*DrinkResponse) error
+	grpc.ServerStream
+}
+
+type coffeeMachinePourDrinksServer struct {
+	grpc.ServerStream
+}
+
+func (x *coffeeMachinePourDrinksServer) Send(m *DrinkResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CoffeeMachine_Refill_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefillRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoffeeMachineServer).Refill(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/coffeemachine.v1.CoffeeMachine/Refill",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoffeeMachineServer).Refill(ctx, req.(*RefillRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoffeeMachine_GetInventory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInventoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoffeeMachineServer).GetInventory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/coffeemachine.v1.CoffeeMachine/GetInventory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoffeeMachineServer).GetInventory(ctx, req.(*GetInventoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoffeeMachine_ListMenu_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMenuRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoffeeMachineServer).ListMenu(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/coffeemachine.v1.CoffeeMachine/ListMenu",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoffeeMachineServer).ListMenu(ctx, req.(*ListMenuRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CoffeeMachine_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CoffeeMachineServer).WatchEvents(m, &coffeeMachineWatchEventsServer{stream})
+}
+
+type CoffeeMachine_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type coffeeMachineWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *coffeeMachineWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// CoffeeMachine_ServiceDesc is the grpc.ServiceDesc for CoffeeMachine service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CoffeeMachine_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "coffeemachine.v1.CoffeeMachine",
+	HandlerType: (*CoffeeMachineServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Refill",
+			Handler:    _CoffeeMachine_Refill_Handler,
+		},
+		{
+			MethodName: "GetInventory",
+			Handler:    _CoffeeMachine_GetInventory_Handler,
+		},
+		{
+			MethodName: "ListMenu",
+			Handler:    _CoffeeMachine_ListMenu_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PourDrinks",
+			Handler:       _CoffeeMachine_PourDrinks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _CoffeeMachine_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "coffeemachine.proto",
+}
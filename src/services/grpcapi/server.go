@@ -0,0 +1,158 @@
+package grpcapi
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/grpcapi/pb"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultEventBuffer = 256
+
+// server adapts a coffee machine to the CoffeeMachine gRPC service, see pb/coffeemachine.proto
+type server struct {
+	pb.UnimplementedCoffeeMachineServer
+	machine     vendingmachine.CoffeeMachine
+	eventBus    eventbus.Bus
+	eventBuffer int
+}
+
+func New(p Params) pb.CoffeeMachineServer {
+	eventBuffer := p.EventBuffer
+	if eventBuffer <= 0 {
+		eventBuffer = defaultEventBuffer
+	}
+	return &server{
+		machine:     p.Machine,
+		eventBus:    p.EventBus,
+		eventBuffer: eventBuffer,
+	}
+}
+
+func (s *server) PourDrinks(req *pb.PourDrinksRequest, stream pb.CoffeeMachine_PourDrinksServer) error {
+	for resp := range s.machine.PourDrinks(stream.Context(), toItems(req.Items)) {
+		if err := stream.Send(fromResponse(resp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) Refill(ctx context.Context, req *pb.RefillRequest) (*pb.RefillResponse, error) {
+	if req.Ingredient == nil || req.Ingredient.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "ingredient is required")
+	}
+	refillReq := vendingmachine.RefillLotRequest{
+		Ingredient: toIngredient(req.Ingredient),
+		LotID:      req.LotId,
+	}
+	if req.ExpiresAt != nil {
+		refillReq.ExpiresAt = req.ExpiresAt.AsTime()
+	}
+	if err := s.machine.RefillLot(ctx, refillReq); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.RefillResponse{}, nil
+}
+
+func (s *server) GetInventory(ctx context.Context, req *pb.GetInventoryRequest) (*pb.GetInventoryResponse, error) {
+	inventory, err := s.machine.Inventory(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	levels := inventory.Ingredients
+	if len(req.IngredientIds) > 0 {
+		byID := make(map[string]resourcemanager.Levels, len(levels))
+		for _, ingredient := range levels {
+			byID[ingredient.IngredientID] = ingredient
+		}
+		levels = make([]resourcemanager.Levels, 0, len(req.IngredientIds))
+		for _, ingredientID := range req.IngredientIds {
+			// ingredients the machine never held have no levels at all
+			ingredient := byID[ingredientID]
+			ingredient.IngredientID = ingredientID
+			levels = append(levels, ingredient)
+		}
+	}
+
+	resp := &pb.GetInventoryResponse{
+		TakenAt:     timestamppb.New(inventory.TakenAt),
+		Ingredients: make([]*pb.IngredientLevels, 0, len(levels)),
+	}
+	for _, ingredient := range levels {
+		resp.Ingredients = append(resp.Ingredients, &pb.IngredientLevels{
+			IngredientId: ingredient.IngredientID,
+			OnHand:       int64(ingredient.OnHand),
+			Reserved:     int64(ingredient.Reserved),
+			Available:    int64(ingredient.Available),
+		})
+	}
+	return resp, nil
+}
+
+func (s *server) ListMenu(ctx context.Context, req *pb.ListMenuRequest) (*pb.ListMenuResponse, error) {
+	return &pb.ListMenuResponse{Items: fromItems(s.machine.Menu(ctx))}, nil
+}
+
+/*
+	WatchEvents subscribes the stream to the bus, till the client cancels or the server stops.
+	Events are buffered per watcher, so a slow watcher never slows the machine down - it loses the oldest events instead.
+*/
+func (s *server) WatchEvents(req *pb.WatchEventsRequest, stream pb.CoffeeMachine_WatchEventsServer) error {
+	if s.eventBus == nil {
+		return status.Error(codes.Unavailable, "events are not published by this machine")
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+
+	opts := []eventbus.SubscribeOption{eventbus.Async(s.eventBuffer, eventbus.PolicyDropOldest)}
+	if len(req.Types) > 0 {
+		types := make([]eventbus.Type, 0, len(req.Types))
+		for _, t := range req.Types {
+			types = append(types, eventbus.Type(t))
+		}
+		opts = append(opts, eventbus.Types(types...))
+	}
+	events := make(chan eventbus.Event)
+	subscription := s.eventBus.Subscribe(func(event eventbus.Event) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}, opts...)
+	defer subscription.Unsubscribe()
+	// the handler may be blocked on the stream, unblock it before unsubscribing
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			if err := stream.Send(fromEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toStatus maps the errors of the machine to gRPC status codes
+func toStatus(err error) error {
+	switch err.(type) {
+	case entities.ErrNotAllowedInState, entities.ErrIngredientDeactivated:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case entities.ErrLotExpired, entities.ErrQuantityOverflow, entities.ErrInvalidQuantity, entities.ErrMissingID,
+		entities.ErrInvalidUpdateType, entities.ErrInvalidAdjustReason, entities.ErrNoIngredients:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case entities.ErrResourceNotAvailable:
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
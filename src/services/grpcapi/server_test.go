@@ -0,0 +1,296 @@
+package grpcapi
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/grpcapi/pb"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	hotTea = entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 200}}}
+	latte  = entities.Item{ID: "latte", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 50}, {ID: "hot_milk", Quantity: 150}}}
+)
+
+// newClient serves a new machine over an in-memory listener, and returns a client connected to it
+func newClient(t *testing.T, p vendingmachine.Params, withBus bool) (pb.CoffeeMachineClient, vendingmachine.CoffeeMachine) {
+	var bus eventbus.Bus
+	if withBus {
+		bus = eventbus.New()
+		p.EventBus = bus
+	}
+	p.ResourceManager = resourcemanager.New(resourcemanager.WithEventBus(bus))
+	p.NumOfOutlets = 1
+	p.Menu = []entities.Item{hotTea, latte}
+	machine := vendingmachine.New(p)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.RegisterCoffeeMachineServer(grpcServer, New(Params{Machine: machine, EventBus: bus}))
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return pb.NewCoffeeMachineClient(conn), machine
+}
+
+func Test_server_Refill(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		shutdown bool
+		// deactivated is refilled, and then deactivated before the request
+		deactivated string
+		req         *pb.RefillRequest
+		wantCode    codes.Code
+		want        *pb.GetInventoryResponse
+	}{
+		{
+			name: "success | refilled",
+			req:  &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_milk", Quantity: 500}, LotId: "M-1"},
+			want: &pb.GetInventoryResponse{Ingredients: []*pb.IngredientLevels{
+				{IngredientId: "hot_milk", OnHand: 500, Available: 500},
+			}},
+		},
+		{
+			name:     "error | no ingredient",
+			req:      &pb.RefillRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "error | negative quantity",
+			req:      &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_milk", Quantity: -500}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "error | machine shut down",
+			shutdown: true,
+			req:      &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_milk", Quantity: 500}},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:        "error | ingredient deactivated",
+			deactivated: "hot_milk",
+			req:         &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_milk", Quantity: 500}},
+			wantCode:    codes.FailedPrecondition,
+		},
+		{
+			name:     "error | lot already expired",
+			req:      &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_milk", Quantity: 500}, ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour))},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, machine := newClient(t, vendingmachine.Params{}, false)
+			if tt.deactivated != "" {
+				if err := machine.Refill(ctx, entities.Ingredient{ID: tt.deactivated, Quantity: 100}); err != nil {
+					t.Fatal(err)
+				}
+				if err := machine.DeactivateIngredient(ctx, vendingmachine.IngredientRequest{IngredientID: tt.deactivated}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.shutdown {
+				if _, err := machine.Shutdown(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := client.Refill(ctx, tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want == nil {
+				return
+			}
+
+			got, err := client.GetInventory(ctx, &pb.GetInventoryRequest{})
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.want.Ingredients), len(got.Ingredients))
+			for idx, want := range tt.want.Ingredients {
+				assert.Equal(t, want.String(), got.Ingredients[idx].String())
+			}
+		})
+	}
+}
+
+func Test_server_GetInventory(t *testing.T) {
+	ctx := context.Background()
+	client, machine := newClient(t, vendingmachine.Params{}, false)
+	for _, ingredient := range []entities.Ingredient{{ID: "hot_water", Quantity: 300}, {ID: "hot_milk", Quantity: 100}} {
+		if err := machine.Refill(ctx, ingredient); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := machine.PreOrder(ctx, vendingmachine.PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ingredientIDs []string
+		want          []*pb.IngredientLevels
+	}{
+		{
+			name: "success | every ingredient",
+			want: []*pb.IngredientLevels{
+				{IngredientId: "hot_milk", OnHand: 100, Available: 100},
+				{IngredientId: "hot_water", OnHand: 300, Reserved: 200, Available: 100},
+			},
+		},
+		{
+			name:          "success | given ingredients",
+			ingredientIDs: []string{"sugar_syrup", "hot_water"},
+			want: []*pb.IngredientLevels{
+				{IngredientId: "sugar_syrup"},
+				{IngredientId: "hot_water", OnHand: 300, Reserved: 200, Available: 100},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.GetInventory(ctx, &pb.GetInventoryRequest{IngredientIds: tt.ingredientIDs})
+			assert.NoError(t, err)
+			assert.NotNil(t, got.TakenAt)
+			assert.Equal(t, len(tt.want), len(got.Ingredients))
+			for idx, want := range tt.want {
+				assert.Equal(t, want.String(), got.Ingredients[idx].String())
+			}
+		})
+	}
+}
+
+func Test_server_PourDrinks(t *testing.T) {
+	ctx := context.Background()
+	client, machine := newClient(t, vendingmachine.Params{}, false)
+	if err := machine.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 300}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ordered by id only, they are poured by the recipes on the menu
+	stream, err := client.PourDrinks(ctx, &pb.PourDrinksRequest{Items: []*pb.Item{{Id: "hot_tea"}, {Id: "latte"}}})
+	assert.NoError(t, err)
+	responses := make([]*pb.DrinkResponse, 0)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		responses = append(responses, resp)
+	}
+
+	assert.Len(t, responses, 2)
+	assert.Equal(t, pb.Outcome_OUTCOME_PREPARED, responses[0].Outcome)
+	assert.Equal(t, int64(200), responses[0].Item.Ingredients[0].Quantity)
+	assert.Equal(t, pb.Outcome_OUTCOME_NOT_PREPARED, responses[1].Outcome)
+	assert.Contains(t, responses[1].RejectReasons[0].Message, "hot_milk")
+}
+
+func Test_server_ListMenu(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newClient(t, vendingmachine.Params{}, false)
+
+	got, err := client.ListMenu(ctx, &pb.ListMenuRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, got.Items, 2)
+	assert.Equal(t, "hot_tea", got.Items[0].Id)
+	assert.Equal(t, "latte", got.Items[1].Id)
+	assert.Len(t, got.Items[1].Ingredients, 2)
+}
+
+func Test_server_WatchEvents(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		withBus  bool
+		types    []string
+		want     []string
+		wantCode codes.Code
+	}{
+		{
+			name:    "success | filtered by type",
+			withBus: true,
+			types:   []string{string(eventbus.TypeRefilled), string(eventbus.TypeDrinkPrepared)},
+			want:    []string{"REFILLED", "DRINK_PREPARED"},
+		},
+		{
+			name:     "error | no bus",
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, machine := newClient(t, vendingmachine.Params{}, tt.withBus)
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			stream, err := client.WatchEvents(watchCtx, &pb.WatchEventsRequest{Types: tt.types})
+			assert.NoError(t, err)
+			if tt.wantCode != codes.OK {
+				_, err = stream.Recv()
+				assert.Equal(t, tt.wantCode, status.Code(err))
+				return
+			}
+
+			// the subscription is only taken once the server got the call, so events are published till one arrives
+			received := make(chan *pb.Event)
+			go func() {
+				for {
+					event, err := stream.Recv()
+					if err != nil {
+						close(received)
+						return
+					}
+					received <- event
+				}
+			}()
+			first := waitForEvent(t, received, func() {
+				_, _ = client.Refill(ctx, &pb.RefillRequest{Ingredient: &pb.Ingredient{Id: "hot_water", Quantity: 200}})
+			})
+			for range machine.PourDrinks(ctx, []entities.Item{hotTea}) {
+			}
+			second := <-received
+
+			assert.Equal(t, tt.want, []string{first.Type, second.Type})
+		})
+	}
+}
+
+func waitForEvent(t *testing.T, received <-chan *pb.Event, publish func()) *pb.Event {
+	for attempt := 0; attempt < 100; attempt += 1 {
+		publish()
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("no event received")
+	return nil
+}
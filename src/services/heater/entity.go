@@ -0,0 +1,37 @@
+package heater
+
+import (
+	"coffeeMachine/src/services/clock"
+	"time"
+)
+
+// Boiler heats a hot ingredient, e.g. hot_water - temperatures are in °C
+type Boiler struct {
+	Ingredient string
+	// TargetTemperature is what the boiler heats up to, and MinTemperature the lowest drinks are poured at
+	TargetTemperature float64
+	MinTemperature    float64
+	// Capacity is the quantity the boiler holds, whatever is drawn is replaced by cold ingredient
+	Capacity int
+	// WarmUp is how long heating a boiler full of cold ingredient up to TargetTemperature takes
+	WarmUp time.Duration
+}
+
+type Params struct {
+	Boilers []Boiler
+	// AmbientTemperature is the temperature of cold ingredients, boilers start at it
+	AmbientTemperature float64
+	// Preheated is optional, if set - boilers start at their target temperature instead
+	Preheated bool
+	// Clock is optional, if not set - the wall clock is used. Pass the machine's clock, so waits & heating agree
+	Clock clock.Clock
+}
+
+type BoilerStatus struct {
+	Ingredient        string
+	Temperature       float64
+	MinTemperature    float64
+	TargetTemperature float64
+	// ReadyIn is how long till the boiler is at MinTemperature again, zero if it already is
+	ReadyIn time.Duration
+}
@@ -0,0 +1,153 @@
+package heater
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Heater keeps the boilers of hot ingredients at temperature.
+	Drawing an ingredient replaces what was drawn by cold ingredient, so the boiler cools down in proportion
+	to the quantity drawn - a heavy draw may take it below the temperature drinks are poured at.
+	Meanwhile the boiler keeps heating at a constant rate, reaching its target after its warm-up time if it was cold.
+*/
+type Heater interface {
+	// Status reports the boilers heating any of the ingredients, ordered by ingredient - every boiler if none are given
+	Status(ingredientIDs ...string) []BoilerStatus
+	// Draw cools the boilers of the ingredients down, by the quantities drawn
+	Draw(ingredients []entities.Ingredient)
+}
+
+// never is the ReadyIn of a boiler which can't reach its MinTemperature
+const never = time.Duration(math.MaxInt64)
+
+/*
+	Temperatures are only computed when they're looked at - from the temperature at the last draw,
+	and the time heating since then. So the heater needs no goroutine, and follows a fake clock exactly.
+*/
+type heaterImpl struct {
+	mutex   sync.Mutex
+	clock   clock.Clock
+	ambient float64
+	boilers map[string]*boilerState
+}
+
+type boilerState struct {
+	Boiler
+	temperature float64
+	updatedAt   time.Time
+}
+
+func New(p Params) Heater {
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	now := clk.Now()
+	boilers := make(map[string]*boilerState, len(p.Boilers))
+	for _, boiler := range p.Boilers {
+		temperature := p.AmbientTemperature
+		if p.Preheated {
+			temperature = boiler.TargetTemperature
+		}
+		boilers[boiler.Ingredient] = &boilerState{Boiler: boiler, temperature: temperature, updatedAt: now}
+	}
+	return &heaterImpl{
+		mutex:   sync.Mutex{},
+		clock:   clk,
+		ambient: p.AmbientTemperature,
+		boilers: boilers,
+	}
+}
+
+// ratePerNano is the heating rate of the boiler, in °C per nanosecond
+func (h *heaterImpl) ratePerNano(b *boilerState) float64 {
+	if b.WarmUp <= 0 {
+		return 0
+	}
+	return (b.TargetTemperature - h.ambient) / float64(b.WarmUp)
+}
+
+// heat brings the boiler's temperature up to now, it must be called with mutex locked
+func (h *heaterImpl) heat(b *boilerState, now time.Time) {
+	elapsed := now.Sub(b.updatedAt)
+	b.updatedAt = now
+	if b.WarmUp <= 0 {
+		// heats instantly
+		b.temperature = b.TargetTemperature
+		return
+	}
+	if elapsed <= 0 {
+		return
+	}
+	b.temperature += h.ratePerNano(b) * float64(elapsed)
+	if b.temperature > b.TargetTemperature {
+		b.temperature = b.TargetTemperature
+	}
+}
+
+func (h *heaterImpl) Status(ingredientIDs ...string) []BoilerStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(ingredientIDs) == 0 {
+		for id := range h.boilers {
+			ingredientIDs = append(ingredientIDs, id)
+		}
+	}
+
+	now := h.clock.Now()
+	seen := make(map[string]bool, len(ingredientIDs))
+	statuses := make([]BoilerStatus, 0, len(ingredientIDs))
+	for _, id := range ingredientIDs {
+		b, ok := h.boilers[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		h.heat(b, now)
+
+		status := BoilerStatus{
+			Ingredient:        id,
+			Temperature:       b.temperature,
+			MinTemperature:    b.MinTemperature,
+			TargetTemperature: b.TargetTemperature,
+		}
+		if rate := h.ratePerNano(b); b.temperature < b.MinTemperature && rate > 0 {
+			// rounded up, so that waiting ReadyIn is always enough
+			status.ReadyIn = time.Duration((b.MinTemperature-b.temperature)/rate) + 1
+		} else if b.temperature < b.MinTemperature {
+			// MinTemperature is above what the boiler heats up to
+			status.ReadyIn = never
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Ingredient < statuses[j].Ingredient
+	})
+	return statuses
+}
+
+func (h *heaterImpl) Draw(ingredients []entities.Ingredient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.clock.Now()
+	for _, ingredient := range ingredients {
+		b, ok := h.boilers[ingredient.ID]
+		if !ok || b.Capacity <= 0 {
+			continue
+		}
+		h.heat(b, now)
+
+		drawn := float64(ingredient.Quantity) / float64(b.Capacity)
+		if drawn > 1 {
+			drawn = 1
+		}
+		b.temperature -= (b.temperature - h.ambient) * drawn
+	}
+}
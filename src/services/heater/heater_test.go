@@ -0,0 +1,110 @@
+package heater
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeater(t *testing.T) {
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+	// heats by 1°C a second
+	hotWater := Boiler{Ingredient: "hot_water", TargetTemperature: 95, MinTemperature: 85, Capacity: 1000, WarmUp: 75 * time.Second}
+	hotMilk := Boiler{Ingredient: "hot_milk", TargetTemperature: 65, MinTemperature: 60, Capacity: 500, WarmUp: 45 * time.Second}
+
+	tests := []struct {
+		name      string
+		boilers   []Boiler
+		preheated bool
+		action    func(h Heater, fakeClock *clock.Fake)
+		ids       []string
+		// want only compares the temperatures & ReadyIn approximately
+		want []BoilerStatus
+	}{
+		{
+			name:    "success | cold start warms up",
+			boilers: []Boiler{hotWater},
+			action: func(h Heater, fakeClock *clock.Fake) {
+				assert.InDelta(t, float64(65*time.Second), float64(h.Status()[0].ReadyIn), float64(time.Millisecond))
+				fakeClock.Advance(65 * time.Second)
+			},
+			want: []BoilerStatus{{Ingredient: "hot_water", Temperature: 85, MinTemperature: 85, TargetTemperature: 95}},
+		},
+		{
+			name:      "success | heavy draw reheats",
+			boilers:   []Boiler{hotWater},
+			preheated: true,
+			action: func(h Heater, fakeClock *clock.Fake) {
+				h.Draw([]entities.Ingredient{{ID: "hot_water", Quantity: 200}})
+				fakeClock.Advance(2 * time.Second)
+			},
+			// 95 - 75 * 0.2 = 80, then heated for 2 seconds
+			want: []BoilerStatus{{Ingredient: "hot_water", Temperature: 82, MinTemperature: 85, TargetTemperature: 95, ReadyIn: 3 * time.Second}},
+		},
+		{
+			name:      "success | heats up to the target only",
+			boilers:   []Boiler{hotWater},
+			preheated: true,
+			action: func(h Heater, fakeClock *clock.Fake) {
+				h.Draw([]entities.Ingredient{{ID: "hot_water", Quantity: 100}})
+				fakeClock.Advance(time.Hour)
+			},
+			want: []BoilerStatus{{Ingredient: "hot_water", Temperature: 95, MinTemperature: 85, TargetTemperature: 95}},
+		},
+		{
+			name:      "success | draw beyond the capacity",
+			boilers:   []Boiler{hotWater},
+			preheated: true,
+			action: func(h Heater, fakeClock *clock.Fake) {
+				h.Draw([]entities.Ingredient{{ID: "hot_water", Quantity: 5000}})
+			},
+			want: []BoilerStatus{{Ingredient: "hot_water", Temperature: 20, MinTemperature: 85, TargetTemperature: 95, ReadyIn: 65 * time.Second}},
+		},
+		{
+			name:      "success | only boilers of the ingredients",
+			boilers:   []Boiler{hotWater, hotMilk},
+			preheated: true,
+			action: func(h Heater, fakeClock *clock.Fake) {
+				h.Draw([]entities.Ingredient{{ID: "hot_milk", Quantity: 250}, {ID: "sugar_syrup", Quantity: 50}})
+			},
+			ids: []string{"sugar_syrup", "hot_milk", "hot_milk"},
+			// 65 - 45 * 0.5
+			want: []BoilerStatus{{Ingredient: "hot_milk", Temperature: 42.5, MinTemperature: 60, TargetTemperature: 65, ReadyIn: 17500 * time.Millisecond}},
+		},
+		{
+			name:    "success | every boiler by ingredient",
+			boilers: []Boiler{hotWater, hotMilk},
+			action:  func(h Heater, fakeClock *clock.Fake) {},
+			want: []BoilerStatus{
+				{Ingredient: "hot_milk", Temperature: 20, MinTemperature: 60, TargetTemperature: 65, ReadyIn: 40 * time.Second},
+				{Ingredient: "hot_water", Temperature: 20, MinTemperature: 85, TargetTemperature: 95, ReadyIn: 65 * time.Second},
+			},
+		},
+		{
+			name:    "error | minimum above the target",
+			boilers: []Boiler{{Ingredient: "hot_water", TargetTemperature: 80, MinTemperature: 85, Capacity: 1000}},
+			action:  func(h Heater, fakeClock *clock.Fake) {},
+			want:    []BoilerStatus{{Ingredient: "hot_water", Temperature: 80, MinTemperature: 85, TargetTemperature: 80, ReadyIn: never}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(start)
+			h := New(Params{Boilers: tt.boilers, AmbientTemperature: 20, Preheated: tt.preheated, Clock: fakeClock})
+			tt.action(h, fakeClock)
+
+			got := h.Status(tt.ids...)
+			assert.Len(t, got, len(tt.want))
+			for idx, want := range tt.want {
+				assert.Equal(t, want.Ingredient, got[idx].Ingredient)
+				assert.Equal(t, want.MinTemperature, got[idx].MinTemperature)
+				assert.Equal(t, want.TargetTemperature, got[idx].TargetTemperature)
+				assert.InDelta(t, want.Temperature, got[idx].Temperature, 0.001)
+				assert.InDelta(t, float64(want.ReadyIn), float64(got[idx].ReadyIn), float64(time.Millisecond))
+			}
+		})
+	}
+}
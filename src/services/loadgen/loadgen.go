@@ -0,0 +1,203 @@
+package loadgen
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/machinefile"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Beverage is a recipe of the mix, beverages are drawn with a probability proportional to their weight
+type Beverage struct {
+	Recipe entities.Item
+	Weight int
+}
+
+type Config struct {
+	Seed      int64
+	BatchSize int
+	Outlets   int
+	Mix       []Beverage
+	// Contention is the ratio of demand to supply for every ingredient -
+	// at 1 there is exactly enough for the whole batch, at 2 only about half the batch can be served
+	Contention float64
+}
+
+// DefaultMix is the menu of src/services/testdata, with tea being the most popular
+func DefaultMix() []Beverage {
+	return []Beverage{
+		{Weight: 4, Recipe: entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{
+			{ID: "hot_water", Quantity: 200}, {ID: "hot_milk", Quantity: 100}, {ID: "ginger_syrup", Quantity: 10},
+			{ID: "sugar_syrup", Quantity: 10}, {ID: "tea_leaves_syrup", Quantity: 30},
+		}}},
+		{Weight: 3, Recipe: entities.Item{ID: "hot_coffee", Ingredients: []entities.Ingredient{
+			{ID: "hot_water", Quantity: 100}, {ID: "ginger_syrup", Quantity: 30}, {ID: "hot_milk", Quantity: 400},
+			{ID: "sugar_syrup", Quantity: 50}, {ID: "tea_leaves_syrup", Quantity: 30},
+		}}},
+		{Weight: 2, Recipe: entities.Item{ID: "black_tea", Ingredients: []entities.Ingredient{
+			{ID: "hot_water", Quantity: 300}, {ID: "ginger_syrup", Quantity: 30},
+			{ID: "sugar_syrup", Quantity: 50}, {ID: "tea_leaves_syrup", Quantity: 30},
+		}}},
+		{Weight: 1, Recipe: entities.Item{ID: "green_tea", Ingredients: []entities.Ingredient{
+			{ID: "hot_water", Quantity: 100}, {ID: "ginger_syrup", Quantity: 30},
+			{ID: "sugar_syrup", Quantity: 50}, {ID: "green_mixture", Quantity: 30},
+		}}},
+	}
+}
+
+/*
+	Generate synthesizes a machine with a batch of BatchSize beverages drawn from the mix.
+	Beverage ids are suffixed with their position in the batch, since a machine file keys beverages by id.
+	The same config always generates the same machine.
+*/
+func Generate(cfg Config) *machinefile.Machine {
+	random := rand.New(rand.NewSource(cfg.Seed))
+
+	totalWeight := 0
+	for _, beverage := range cfg.Mix {
+		totalWeight += beverage.Weight
+	}
+
+	demand := make(map[string]int, 0)
+	beverages := make([]entities.Item, 0, cfg.BatchSize)
+	for idx := 0; idx < cfg.BatchSize && totalWeight > 0; idx++ {
+		pick := random.Intn(totalWeight)
+		for _, beverage := range cfg.Mix {
+			if pick >= beverage.Weight {
+				pick -= beverage.Weight
+				continue
+			}
+			beverages = append(beverages, entities.Item{
+				ID:          fmt.Sprintf("%s_%05d", beverage.Recipe.ID, idx),
+				Ingredients: beverage.Recipe.Ingredients,
+			})
+			for _, ingredient := range beverage.Recipe.Ingredients {
+				demand[ingredient.ID] += ingredient.Quantity
+			}
+			break
+		}
+	}
+
+	contention := cfg.Contention
+	if contention <= 0 {
+		contention = 1
+	}
+	inventory := make([]entities.Ingredient, 0, len(demand))
+	for ingredientID, quantity := range demand {
+		inventory = append(inventory, entities.Ingredient{
+			ID:       ingredientID,
+			Quantity: int(math.Ceil(float64(quantity) / contention)),
+		})
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		return inventory[i].ID < inventory[j].ID
+	})
+
+	return &machinefile.Machine{
+		Outlets:   cfg.Outlets,
+		Inventory: inventory,
+		Beverages: beverages,
+	}
+}
+
+// Result of pouring one batch. Latency of a drink is the time from submitting the batch, till the drink is served
+type Result struct {
+	Served        int
+	Prepared      int
+	Rejected      int
+	Duration      time.Duration
+	Throughput    float64
+	RejectionRate float64
+	LatencyP50    time.Duration
+	LatencyP90    time.Duration
+	LatencyP99    time.Duration
+	LatencyMax    time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("served=%d prepared=%d rejected=%d (%.1f%%) duration=%v throughput=%.0f/s latency p50=%v p90=%v p99=%v max=%v",
+		r.Served, r.Prepared, r.Rejected, r.RejectionRate*100, r.Duration, r.Throughput,
+		r.LatencyP50, r.LatencyP90, r.LatencyP99, r.LatencyMax)
+}
+
+// Run refills a new coffee-machine with the machine's inventory, pours its whole batch, and measures it
+func Run(ctx context.Context, machine *machinefile.Machine, newCoffeeMachine func(numOfOutlets int) vendingmachine.CoffeeMachine) (*Result, error) {
+	coffeeMachine := newCoffeeMachine(machine.Outlets)
+	for _, ingredient := range machine.Inventory {
+		if err := coffeeMachine.Refill(ctx, ingredient); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{}
+	latencies := make([]time.Duration, 0, len(machine.Beverages))
+
+	start := time.Now()
+	for resp := range coffeeMachine.PourDrinks(ctx, machine.Beverages) {
+		result.Served += 1
+		if resp.Outcome == entities.GetItemOutcomePrepared {
+			result.Prepared += 1
+		} else {
+			result.Rejected += 1
+		}
+		latencies = append(latencies, resp.ServedAt.Sub(start))
+	}
+	result.Duration = time.Since(start)
+
+	if result.Served == 0 {
+		return result, nil
+	}
+	result.Throughput = float64(result.Served) / result.Duration.Seconds()
+	result.RejectionRate = float64(result.Rejected) / float64(result.Served)
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	result.LatencyP50 = percentile(latencies, 0.50)
+	result.LatencyP90 = percentile(latencies, 0.90)
+	result.LatencyP99 = percentile(latencies, 0.99)
+	result.LatencyMax = latencies[len(latencies)-1]
+	return result, nil
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// ParseMix parses a mix like "hot_tea=4,black_tea=1", picking the recipes from the default mix
+func ParseMix(spec string) ([]Beverage, error) {
+	recipes := make(map[string]entities.Item, 0)
+	for _, beverage := range DefaultMix() {
+		recipes[beverage.Recipe.ID] = beverage.Recipe
+	}
+
+	mix := make([]Beverage, 0)
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected beverage=weight", part)
+		}
+		recipe, ok := recipes[kv[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown beverage %q", kv[0])
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for beverage %q", kv[1], kv[0])
+		}
+		mix = append(mix, Beverage{Recipe: recipe, Weight: weight})
+	}
+	return mix, nil
+}
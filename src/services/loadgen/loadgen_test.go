@@ -0,0 +1,89 @@
+package loadgen
+
+import (
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/vendingmachine"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCoffeeMachine(numOfOutlets int) vendingmachine.CoffeeMachine {
+	return vendingmachine.New(vendingmachine.Params{
+		ResourceManager: resourcemanager.New(),
+		NumOfOutlets:    numOfOutlets,
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	cfg := Config{Seed: 1, BatchSize: 100, Outlets: 4, Mix: DefaultMix(), Contention: 2}
+
+	got := Generate(cfg)
+	assert.Equal(t, 4, got.Outlets)
+	assert.Len(t, got.Beverages, 100)
+	assert.Equal(t, got, Generate(cfg))
+
+	demand := make(map[string]int, 0)
+	for _, beverage := range got.Beverages {
+		for _, ingredient := range beverage.Ingredients {
+			demand[ingredient.ID] += ingredient.Quantity
+		}
+	}
+	for _, ingredient := range got.Inventory {
+		assert.Equal(t, (demand[ingredient.ID]+1)/2, ingredient.Quantity)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		contention float64
+		assert     func(result *Result, err error)
+	}{
+		{
+			name:       "success | twice the supply, everything is prepared",
+			contention: 0.5,
+			assert: func(result *Result, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 200, result.Served)
+				assert.Equal(t, 200, result.Prepared)
+				assert.Zero(t, result.RejectionRate)
+				assert.True(t, result.LatencyP50 <= result.LatencyP99 && result.LatencyP99 <= result.LatencyMax)
+				assert.True(t, result.Throughput > 0)
+			},
+		},
+		{
+			name:       "success | half the supply, drinks are rejected",
+			contention: 2,
+			assert: func(result *Result, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 200, result.Served)
+				assert.NotZero(t, result.Rejected)
+				assert.True(t, result.Prepared <= 100)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := Generate(Config{Seed: 1, BatchSize: 200, Outlets: 4, Mix: DefaultMix(), Contention: tt.contention})
+			got, err := Run(ctx, machine, newCoffeeMachine)
+			tt.assert(got, err)
+		})
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("hot_tea=3, black_tea=1")
+	assert.NoError(t, err)
+	assert.Len(t, mix, 2)
+	assert.Equal(t, "hot_tea", mix[0].Recipe.ID)
+	assert.Equal(t, 1, mix[1].Weight)
+
+	_, err = ParseMix("irish_coffee=1")
+	assert.Error(t, err)
+	_, err = ParseMix("hot_tea")
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+package machinefile
+
+import (
+	"coffeeMachine/src/entities"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// inventoryStructure is the json shape of an inventory file - a machine file with just the quantities,
+// so that the quantities of a machine file can be imported as well
+type inventoryStructure struct {
+	Machine struct {
+		Quantities map[string]int `json:"total_items_quantity"`
+	} `json:"machine"`
+}
+
+// csvHeader is the first row of an inventory csv, it's optional when importing
+var csvHeader = []string{"ingredient", "quantity"}
+
+// Format of an inventory file
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+)
+
+// FormatOf tells the format of an inventory file by its extension, anything but .csv is json
+func FormatOf(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSON
+}
+
+// LoadInventory reads the inventory file at the given path, in the format of its extension
+func LoadInventory(path string) ([]entities.Ingredient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadInventory(file, FormatOf(path))
+}
+
+// SaveInventory writes the inventory file at the given path, in the format of its extension
+func SaveInventory(path string, ingredients []entities.Ingredient) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteInventory(file, FormatOf(path), ingredients); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+	ReadInventory parses an inventory, sorted by ingredient-id.
+	Quantities must be non-negative, and in a csv every ingredient must be listed once - json objects can't repeat keys anyway.
+*/
+func ReadInventory(r io.Reader, format Format) ([]entities.Ingredient, error) {
+	if format == FormatCSV {
+		return readInventoryCSV(r)
+	}
+
+	var input inventoryStructure
+	if err := json.NewDecoder(r).Decode(&input); err != nil {
+		return nil, err
+	}
+	for ingredientID, quantity := range input.Machine.Quantities {
+		if quantity < 0 {
+			return nil, fmt.Errorf("invalid quantity %d for ingredient %q", quantity, ingredientID)
+		}
+	}
+	return ToIngredients(input.Machine.Quantities), nil
+}
+
+func readInventoryCSV(r io.Reader) ([]entities.Ingredient, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 && rows[0][0] == csvHeader[0] && rows[0][1] == csvHeader[1] {
+		rows = rows[1:]
+	}
+
+	quantities := make(map[string]int, len(rows))
+	for _, row := range rows {
+		ingredientID := strings.TrimSpace(row[0])
+		if ingredientID == "" {
+			return nil, fmt.Errorf("invalid row %q, expected ingredient,quantity", strings.Join(row, ","))
+		}
+		if _, ok := quantities[ingredientID]; ok {
+			return nil, fmt.Errorf("ingredient %q is listed more than once", ingredientID)
+		}
+		quantity, err := strconv.Atoi(strings.TrimSpace(row[1]))
+		if err != nil || quantity < 0 {
+			return nil, fmt.Errorf("invalid quantity %q for ingredient %q", row[1], ingredientID)
+		}
+		quantities[ingredientID] = quantity
+	}
+	return ToIngredients(quantities), nil
+}
+
+// WriteInventory writes the inventory sorted by ingredient-id, json in the total_items_quantity shape of machine files
+func WriteInventory(w io.Writer, format Format, ingredients []entities.Ingredient) error {
+	if format == FormatCSV {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, ingredient := range ToIngredients(ToMap(ingredients)) {
+			if err := writer.Write([]string{ingredient.ID, strconv.Itoa(ingredient.Quantity)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	var output inventoryStructure
+	output.Machine.Quantities = ToMap(ingredients)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
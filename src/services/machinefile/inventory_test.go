@@ -0,0 +1,97 @@
+package machinefile
+
+import (
+	"bytes"
+	"coffeeMachine/src/entities"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadInventory(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		contents string
+		want     []entities.Ingredient
+		wantErr  string
+	}{
+		{
+			name:     "success | json",
+			format:   FormatJSON,
+			contents: `{"machine": {"total_items_quantity": {"hot_water": 500, "ginger_syrup": 100}}}`,
+			want:     []entities.Ingredient{{ID: "ginger_syrup", Quantity: 100}, {ID: "hot_water", Quantity: 500}},
+		},
+		{
+			name:     "success | csv with header",
+			format:   FormatCSV,
+			contents: "ingredient,quantity\nhot_water,500\nginger_syrup, 100\n",
+			want:     []entities.Ingredient{{ID: "ginger_syrup", Quantity: 100}, {ID: "hot_water", Quantity: 500}},
+		},
+		{
+			name:     "success | csv without header",
+			format:   FormatCSV,
+			contents: "hot_water,500\n",
+			want:     []entities.Ingredient{{ID: "hot_water", Quantity: 500}},
+		},
+		{
+			name:     "error | json negative quantity",
+			format:   FormatJSON,
+			contents: `{"machine": {"total_items_quantity": {"hot_water": -1}}}`,
+			wantErr:  `invalid quantity -1 for ingredient "hot_water"`,
+		},
+		{
+			name:     "error | csv quantity isn't a number",
+			format:   FormatCSV,
+			contents: "hot_water,lots\n",
+			wantErr:  `invalid quantity "lots" for ingredient "hot_water"`,
+		},
+		{
+			name:     "error | csv ingredient listed twice",
+			format:   FormatCSV,
+			contents: "hot_water,500\nhot_water,100\n",
+			wantErr:  `ingredient "hot_water" is listed more than once`,
+		},
+		{
+			name:     "error | csv missing column",
+			format:   FormatCSV,
+			contents: "hot_water\n",
+			wantErr:  "wrong number of fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadInventory(strings.NewReader(tt.contents), tt.format)
+			if tt.wantErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWriteInventory(t *testing.T) {
+	machine, err := Load("../testdata/testdata1.json")
+	assert.NoError(t, err)
+
+	for _, format := range []Format{FormatJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := bytes.Buffer{}
+			assert.NoError(t, WriteInventory(&buf, format, machine.Inventory))
+
+			got, err := ReadInventory(&buf, format)
+			assert.NoError(t, err)
+			assert.Equal(t, machine.Inventory, got)
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, FormatCSV, FormatOf("inventory.CSV"))
+	assert.Equal(t, FormatJSON, FormatOf("inventory.json"))
+	assert.Equal(t, FormatJSON, FormatOf("machine"))
+}
@@ -0,0 +1,104 @@
+package machinefile
+
+import (
+	"coffeeMachine/src/entities"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// fileStructure is the json shape of a machine file, as found in src/services/testdata
+type fileStructure struct {
+	Machine struct {
+		Outlets struct {
+			NumOutlets int `json:"count_n"`
+		} `json:"outlets"`
+		Quantities map[string]int            `json:"total_items_quantity"`
+		Beverages  map[string]map[string]int `json:"beverages"`
+	} `json:"machine"`
+}
+
+// Machine is the parsed content of a machine file.
+// Ingredients and beverages are sorted by id, so that parsing the same file always yields the same order
+type Machine struct {
+	Outlets   int
+	Inventory []entities.Ingredient
+	Beverages []entities.Item
+}
+
+// Load reads and parses the machine file at the given path
+func Load(path string) (*Machine, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(contents)
+}
+
+// Parse parses the contents of a machine file
+func Parse(contents []byte) (*Machine, error) {
+	var input fileStructure
+	if err := json.Unmarshal(contents, &input); err != nil {
+		return nil, err
+	}
+
+	beverageIDs := make([]string, 0, len(input.Machine.Beverages))
+	for beverageID := range input.Machine.Beverages {
+		beverageIDs = append(beverageIDs, beverageID)
+	}
+	sort.Strings(beverageIDs)
+
+	beverages := make([]entities.Item, 0, len(beverageIDs))
+	for _, beverageID := range beverageIDs {
+		beverages = append(beverages, entities.Item{
+			ID:          beverageID,
+			Ingredients: ToIngredients(input.Machine.Beverages[beverageID]),
+		})
+	}
+
+	return &Machine{
+		Outlets:   input.Machine.Outlets.NumOutlets,
+		Inventory: ToIngredients(input.Machine.Quantities),
+		Beverages: beverages,
+	}, nil
+}
+
+// ToIngredients converts a map[ingredient-id]quantity to a list of ingredients sorted by id
+func ToIngredients(ingredientsMap map[string]int) []entities.Ingredient {
+	ingredients := make([]entities.Ingredient, 0, len(ingredientsMap))
+	for ingredientID, quantity := range ingredientsMap {
+		ingredients = append(ingredients, entities.Ingredient{
+			ID:       ingredientID,
+			Quantity: quantity,
+		})
+	}
+	sort.Slice(ingredients, func(i, j int) bool {
+		return ingredients[i].ID < ingredients[j].ID
+	})
+	return ingredients
+}
+
+// Write writes the machine in the machine file shape, indented - so that generated files stay readable
+func Write(w io.Writer, machine *Machine) error {
+	var output fileStructure
+	output.Machine.Outlets.NumOutlets = machine.Outlets
+	output.Machine.Quantities = ToMap(machine.Inventory)
+	output.Machine.Beverages = make(map[string]map[string]int, len(machine.Beverages))
+	for _, beverage := range machine.Beverages {
+		output.Machine.Beverages[beverage.ID] = ToMap(beverage.Ingredients)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// ToMap converts a list of ingredients to a map[ingredient-id]quantity, adding up duplicate ingredients
+func ToMap(ingredients []entities.Ingredient) map[string]int {
+	ingredientsMap := make(map[string]int, len(ingredients))
+	for _, ingredient := range ingredients {
+		ingredientsMap[ingredient.ID] += ingredient.Quantity
+	}
+	return ingredientsMap
+}
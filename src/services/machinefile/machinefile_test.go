@@ -0,0 +1,57 @@
+package machinefile
+
+import (
+	"bytes"
+	"coffeeMachine/src/entities"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		assert   func(machine *Machine, err error)
+	}{
+		{
+			name:     "success | machine with beverages",
+			fileName: "../testdata/testdata1.json",
+			assert: func(machine *Machine, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 3, machine.Outlets)
+				assert.Len(t, machine.Inventory, 5)
+				assert.Equal(t, entities.Ingredient{ID: "ginger_syrup", Quantity: 100}, machine.Inventory[0])
+				assert.Len(t, machine.Beverages, 4)
+				assert.Equal(t, "black_tea", machine.Beverages[0].ID)
+				assert.Len(t, machine.Beverages[0].Ingredients, 4)
+			},
+		},
+		{
+			name:     "error | file does not exist",
+			fileName: "../testdata/does_not_exist.json",
+			assert: func(machine *Machine, err error) {
+				assert.Error(t, err)
+				assert.Nil(t, machine)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.fileName)
+			tt.assert(got, err)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	machine, err := Load("../testdata/testdata1.json")
+	assert.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, Write(&buf, machine))
+
+	got, err := Parse(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, machine, got)
+}
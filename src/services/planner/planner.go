@@ -0,0 +1,204 @@
+package planner
+
+import (
+	"coffeeMachine/src/entities"
+	"sort"
+)
+
+// Objective decides what a plan optimizes for
+type Objective string
+
+const (
+	ObjectiveNone       Objective = ""
+	ObjectiveMaxDrinks  Objective = "MAX_DRINKS"
+	ObjectiveMaxRevenue Objective = "MAX_REVENUE"
+	// ObjectivePriority serves items in decreasing priority, an item is only skipped
+	// if it doesn't fit after all items of higher priority are served
+	ObjectivePriority Objective = "PRIORITY"
+)
+
+// ParseObjective returns the objective named s, an empty s is ObjectiveNone
+func ParseObjective(s string) (Objective, error) {
+	switch objective := Objective(s); objective {
+	case ObjectiveNone, ObjectiveMaxDrinks, ObjectiveMaxRevenue, ObjectivePriority:
+		return objective, nil
+	default:
+		return "", entities.ErrInvalidObjective{Objective: s}
+	}
+}
+
+// exactSearchLimit is the largest batch for which we search for the optimal subset,
+// beyond it the search space is too large and we fall back to a greedy selection
+const exactSearchLimit = 20
+
+// Plan holds indices into the planned batch
+type Plan struct {
+	// Selected items fit in the inventory together, in the order they should be dispatched
+	Selected []int
+	Excluded []int
+}
+
+/*
+	Build plans a batch of items against the given inventory [ map[ingredient-id]available-quantity ].
+	Selecting the subset of items is a multi-dimensional knapsack problem:
+	For small batches we do a branch & bound search, which is exact.
+	For larger batches we greedily pick items by value per unit of scarce ingredients.
+
+	Ties are always broken by the position of the item in the batch, so planning is deterministic.
+*/
+func Build(inventory map[string]int, items []entities.Item, objective Objective) Plan {
+	remaining := make(map[string]int, len(inventory))
+	for ingredientID, quantity := range inventory {
+		remaining[ingredientID] = quantity
+	}
+
+	var selected []int
+	switch {
+	case objective == ObjectivePriority:
+		selected = selectGreedily(remaining, items, byPriority(items))
+	case len(items) <= exactSearchLimit:
+		selected = selectExactly(remaining, items, objective)
+	default:
+		selected = selectGreedily(remaining, items, byDensity(inventory, items, objective))
+	}
+
+	isSelected := make(map[int]bool, len(selected))
+	for _, idx := range selected {
+		isSelected[idx] = true
+	}
+	plan := Plan{
+		Selected: make([]int, 0, len(selected)),
+		Excluded: make([]int, 0, len(items)-len(selected)),
+	}
+	for idx := range items {
+		if !isSelected[idx] {
+			plan.Excluded = append(plan.Excluded, idx)
+		}
+	}
+
+	// most valuable items are dispatched first
+	plan.Selected = append(plan.Selected, selected...)
+	sort.SliceStable(plan.Selected, func(i, j int) bool {
+		a, b := items[plan.Selected[i]], items[plan.Selected[j]]
+		if objective == ObjectivePriority && a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if value(a, objective) != value(b, objective) {
+			return value(a, objective) > value(b, objective)
+		}
+		return plan.Selected[i] < plan.Selected[j]
+	})
+	return plan
+}
+
+func value(item entities.Item, objective Objective) int {
+	if objective == ObjectiveMaxRevenue {
+		return item.Price
+	}
+	return 1
+}
+
+func fits(remaining map[string]int, item entities.Item) bool {
+	needed := make(map[string]int, len(item.Ingredients))
+	for _, ingredient := range item.Ingredients {
+		needed[ingredient.ID] += ingredient.Quantity
+		if remaining[ingredient.ID] < needed[ingredient.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+func take(remaining map[string]int, item entities.Item, sign int) {
+	for _, ingredient := range item.Ingredients {
+		remaining[ingredient.ID] -= sign * ingredient.Quantity
+	}
+}
+
+func selectGreedily(remaining map[string]int, items []entities.Item, order []int) []int {
+	selected := make([]int, 0)
+	for _, idx := range order {
+		if fits(remaining, items[idx]) {
+			take(remaining, items[idx], 1)
+			selected = append(selected, idx)
+		}
+	}
+	sort.Ints(selected)
+	return selected
+}
+
+func byPriority(items []entities.Item) []int {
+	order := identity(len(items))
+	sort.SliceStable(order, func(i, j int) bool {
+		return items[order[i]].Priority > items[order[j]].Priority
+	})
+	return order
+}
+
+// byDensity orders items by value over size, where the size of an item is the fraction of the inventory it uses
+func byDensity(inventory map[string]int, items []entities.Item, objective Objective) []int {
+	density := make([]float64, len(items))
+	for idx, item := range items {
+		size := 0.0
+		for _, ingredient := range item.Ingredients {
+			if inventory[ingredient.ID] > 0 {
+				size += float64(ingredient.Quantity) / float64(inventory[ingredient.ID])
+			}
+		}
+		if size == 0 {
+			size = 1
+		}
+		density[idx] = float64(value(item, objective)) / size
+	}
+
+	order := identity(len(items))
+	sort.SliceStable(order, func(i, j int) bool {
+		return density[order[i]] > density[order[j]]
+	})
+	return order
+}
+
+func identity(n int) []int {
+	order := make([]int, n)
+	for idx := range order {
+		order[idx] = idx
+	}
+	return order
+}
+
+/*
+	selectExactly explores include/exclude decisions for every item in batch order.
+	Including is explored first, and the best plan is only replaced on a strictly better value,
+	so among optimal plans the one serving the earliest items wins.
+	A branch is pruned when even serving every remaining item can't beat the best plan.
+*/
+func selectExactly(remaining map[string]int, items []entities.Item, objective Objective) []int {
+	suffixValue := make([]int, len(items)+1)
+	for idx := len(items) - 1; idx >= 0; idx-- {
+		suffixValue[idx] = suffixValue[idx+1] + value(items[idx], objective)
+	}
+
+	best, bestValue := make([]int, 0), -1
+	current := make([]int, 0, len(items))
+
+	var search func(idx, currentValue int)
+	search = func(idx, currentValue int) {
+		if currentValue+suffixValue[idx] <= bestValue {
+			return
+		}
+		if idx == len(items) {
+			best, bestValue = append([]int{}, current...), currentValue
+			return
+		}
+		if fits(remaining, items[idx]) {
+			take(remaining, items[idx], 1)
+			current = append(current, idx)
+			search(idx+1, currentValue+value(items[idx], objective))
+			current = current[:len(current)-1]
+			take(remaining, items[idx], -1)
+		}
+		search(idx+1, currentValue)
+	}
+	search(0, 0)
+	return best
+}
@@ -0,0 +1,145 @@
+package planner
+
+import (
+	"coffeeMachine/src/entities"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inventory and beverages of testdata1.json, only 2 out of 4 beverages can be served
+var (
+	_Inventory = map[string]int{
+		"hot_water":        500,
+		"hot_milk":         500,
+		"ginger_syrup":     100,
+		"sugar_syrup":      100,
+		"tea_leaves_syrup": 100,
+	}
+	_Items = []entities.Item{
+		{
+			ID:    "black_tea",
+			Price: 10,
+			Ingredients: []entities.Ingredient{
+				{ID: "hot_water", Quantity: 300}, {ID: "ginger_syrup", Quantity: 30},
+				{ID: "sugar_syrup", Quantity: 50}, {ID: "tea_leaves_syrup", Quantity: 30},
+			},
+		},
+		{
+			ID:    "green_tea",
+			Price: 40,
+			Ingredients: []entities.Ingredient{
+				{ID: "hot_water", Quantity: 100}, {ID: "ginger_syrup", Quantity: 30},
+				{ID: "sugar_syrup", Quantity: 50}, {ID: "green_mixture", Quantity: 30},
+			},
+		},
+		{
+			ID:    "hot_coffee",
+			Price: 30,
+			Ingredients: []entities.Ingredient{
+				{ID: "hot_water", Quantity: 100}, {ID: "ginger_syrup", Quantity: 30}, {ID: "hot_milk", Quantity: 400},
+				{ID: "sugar_syrup", Quantity: 50}, {ID: "tea_leaves_syrup", Quantity: 30},
+			},
+		},
+		{
+			ID:       "hot_tea",
+			Price:    25,
+			Priority: 5,
+			Ingredients: []entities.Ingredient{
+				{ID: "hot_water", Quantity: 200}, {ID: "hot_milk", Quantity: 100}, {ID: "ginger_syrup", Quantity: 10},
+				{ID: "sugar_syrup", Quantity: 10}, {ID: "tea_leaves_syrup", Quantity: 30},
+			},
+		},
+	}
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		inventory map[string]int
+		items     []entities.Item
+		objective Objective
+		want      Plan
+	}{
+		{
+			name:      "success | max drinks, earliest items win ties",
+			inventory: _Inventory,
+			items:     _Items,
+			objective: ObjectiveMaxDrinks,
+			want:      Plan{Selected: []int{0, 2}, Excluded: []int{1, 3}},
+		},
+		{
+			name:      "success | max revenue, most expensive dispatched first",
+			inventory: _Inventory,
+			items:     _Items,
+			objective: ObjectiveMaxRevenue,
+			want:      Plan{Selected: []int{2, 3}, Excluded: []int{0, 1}},
+		},
+		{
+			name:      "success | priority, higher priority served first",
+			inventory: _Inventory,
+			items:     _Items,
+			objective: ObjectivePriority,
+			want:      Plan{Selected: []int{3, 0}, Excluded: []int{1, 2}},
+		},
+		{
+			name:      "success | empty inventory",
+			inventory: map[string]int{},
+			items:     _Items,
+			objective: ObjectiveMaxDrinks,
+			want:      Plan{Selected: []int{}, Excluded: []int{0, 1, 2, 3}},
+		},
+		{
+			name:      "success | empty batch",
+			inventory: _Inventory,
+			items:     []entities.Item{},
+			objective: ObjectiveMaxDrinks,
+			want:      Plan{Selected: []int{}, Excluded: []int{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Build(tt.inventory, tt.items, tt.objective)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuild_LargeBatch(t *testing.T) {
+	// a large batch of one small and one large drink, the greedy selection should prefer the small ones
+	items := make([]entities.Item, 0)
+	for i := 0; i < 50; i++ {
+		items = append(items,
+			entities.Item{ID: "large", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 300}}},
+			entities.Item{ID: "small", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 100}}},
+		)
+	}
+
+	got := Build(map[string]int{"hot_water": 1000}, items, ObjectiveMaxDrinks)
+	assert.Len(t, got.Selected, 10)
+	for _, idx := range got.Selected {
+		assert.Equal(t, "small", items[idx].ID)
+	}
+	assert.Equal(t, got, Build(map[string]int{"hot_water": 1000}, items, ObjectiveMaxDrinks))
+}
+
+func TestParseObjective(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Objective
+		wantErr error
+	}{
+		{name: "success | none", s: "", want: ObjectiveNone},
+		{name: "success | max revenue", s: "MAX_REVENUE", want: ObjectiveMaxRevenue},
+		{name: "success | priority", s: "PRIORITY", want: ObjectivePriority},
+		{name: "error | unknown objective", s: "max_drinks", wantErr: entities.ErrInvalidObjective{Objective: "max_drinks"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseObjective(tt.s)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package reporting
+
+import (
+	"coffeeMachine/src/entities"
+	"time"
+)
+
+// Record is a single served (or rejected) drink, as persisted by a Store
+type Record struct {
+	ItemID        string                  `json:"item_id"`
+	Outcome       entities.GetItemOutcome `json:"outcome"`
+	OutletID      int                     `json:"outlet_id"`
+	ServedAt      time.Time               `json:"served_at"`
+	Ingredients   []entities.Ingredient   `json:"ingredients,omitempty"`
+	RejectReasons []string                `json:"reject_reasons,omitempty"`
+	// Lots the ingredients were taken from, to trace the drinks of a recalled lot
+	Lots []entities.LotUsage `json:"lots,omitempty"`
+}
+
+// Aggregate holds the outcome counts and the ingredient consumption for one slice of the records
+type Aggregate struct {
+	Prepared    int            `json:"prepared"`
+	NotPrepared int            `json:"not_prepared"`
+	Consumed    map[string]int `json:"consumed"`
+}
+
+// Report aggregates all the records served within [From, To)
+type Report struct {
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+	Total     *Aggregate            `json:"total"`
+	Beverages map[string]*Aggregate `json:"beverages"`
+	Hours     map[string]*Aggregate `json:"hours"`
+	Outlets   map[int]*Aggregate    `json:"outlets"`
+}
+
+// IngredientReconciliation compares what the drinks served should have consumed of an ingredient, with the variance observed by adjustments
+type IngredientReconciliation struct {
+	// Consumed is the expected consumption, by the drinks prepared
+	Consumed int `json:"consumed"`
+	// Variance adds up the adjustments, negative when more went missing than the drinks account for
+	Variance int `json:"variance"`
+	// Reasons splits the variance by the reason of the adjustments
+	Reasons map[entities.AdjustReason]int `json:"reasons"`
+	// VarianceRatio is Variance / Consumed, 0 if nothing was consumed
+	VarianceRatio float64 `json:"variance_ratio"`
+}
+
+// Reconciliation compares the records served with the adjustments made within [From, To), by ingredient
+type Reconciliation struct {
+	From        time.Time                            `json:"from"`
+	To          time.Time                            `json:"to"`
+	Ingredients map[string]*IngredientReconciliation `json:"ingredients"`
+}
@@ -0,0 +1,97 @@
+package reporting
+
+import (
+	"coffeeMachine/src/entities"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Reconcile compares the consumption expected from the records served within [from, to), with the adjustments made meanwhile
+func Reconcile(records []Record, adjustments []entities.Adjustment, from, to time.Time) *Reconciliation {
+	reconciliation := &Reconciliation{
+		From:        from,
+		To:          to,
+		Ingredients: make(map[string]*IngredientReconciliation, 0),
+	}
+	ingredient := func(ingredientID string) *IngredientReconciliation {
+		if _, ok := reconciliation.Ingredients[ingredientID]; !ok {
+			reconciliation.Ingredients[ingredientID] = &IngredientReconciliation{
+				Reasons: make(map[entities.AdjustReason]int, 0),
+			}
+		}
+		return reconciliation.Ingredients[ingredientID]
+	}
+
+	for _, record := range records {
+		if !inRange(record.ServedAt, from, to) || record.Outcome != entities.GetItemOutcomePrepared {
+			continue
+		}
+		for _, consumed := range record.Ingredients {
+			ingredient(consumed.ID).Consumed += consumed.Quantity
+		}
+	}
+	for _, adjustment := range adjustments {
+		if !inRange(adjustment.At, from, to) {
+			continue
+		}
+		adjusted := ingredient(adjustment.IngredientID)
+		adjusted.Variance += adjustment.Variance
+		adjusted.Reasons[adjustment.Reason] += adjustment.Variance
+	}
+
+	for _, reconciled := range reconciliation.Ingredients {
+		if reconciled.Consumed > 0 {
+			reconciled.VarianceRatio = float64(reconciled.Variance) / float64(reconciled.Consumed)
+		}
+	}
+	return reconciliation
+}
+
+/*
+	WriteReconciliationCSV writes the reconciliation in a long format, one metric per row:
+		ingredient,metric,value
+		hot_milk,consumed,1200
+		hot_milk,variance,-60
+		hot_milk,variance:SPILLAGE,-60
+		hot_milk,variance_ratio,-0.0500
+	Rows are sorted, so that two reconciliations of the same records are byte-identical.
+*/
+func WriteReconciliationCSV(w io.Writer, reconciliation *Reconciliation) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"ingredient", "metric", "value"}); err != nil {
+		return err
+	}
+
+	ingredientIDs := make([]string, 0, len(reconciliation.Ingredients))
+	for ingredientID := range reconciliation.Ingredients {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	sort.Strings(ingredientIDs)
+
+	rows := make([][]string, 0)
+	for _, ingredientID := range ingredientIDs {
+		reconciled := reconciliation.Ingredients[ingredientID]
+		rows = append(rows,
+			[]string{ingredientID, "consumed", strconv.Itoa(reconciled.Consumed)},
+			[]string{ingredientID, "variance", strconv.Itoa(reconciled.Variance)},
+		)
+		reasons := make([]string, 0, len(reconciled.Reasons))
+		for reason := range reconciled.Reasons {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			variance := reconciled.Reasons[entities.AdjustReason(reason)]
+			rows = append(rows, []string{ingredientID, "variance:" + reason, strconv.Itoa(variance)})
+		}
+		rows = append(rows, []string{ingredientID, "variance_ratio", strconv.FormatFloat(reconciled.VarianceRatio, 'f', 4, 64)})
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
@@ -0,0 +1,87 @@
+package reporting
+
+import (
+	"bytes"
+	"coffeeMachine/src/entities"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestAdjustments() []entities.Adjustment {
+	return []entities.Adjustment{
+		{IngredientID: "hot_water", Reason: entities.AdjustReasonSpillage, Expected: 1000, Observed: 970, Variance: -30, At: _Morning},
+		{IngredientID: "hot_water", Reason: entities.AdjustReasonStockTake, Expected: 670, Observed: 640, Variance: -30, At: _Noon},
+		{IngredientID: "tea_leaves_syrup", Reason: entities.AdjustReasonStockTake, Expected: 30, Observed: 37, Variance: 7, At: _Noon},
+		{IngredientID: "hot_milk", Reason: entities.AdjustReasonWaste, Expected: 100, Observed: 0, Variance: -100, At: _Noon.Add(24 * time.Hour)},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	day := _Morning.Truncate(24 * time.Hour)
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want map[string]*IngredientReconciliation
+	}{
+		{
+			name: "success | whole day",
+			from: day,
+			to:   day.Add(24 * time.Hour),
+			want: map[string]*IngredientReconciliation{
+				"hot_water": {
+					Consumed:      600,
+					Variance:      -60,
+					Reasons:       map[entities.AdjustReason]int{entities.AdjustReasonSpillage: -30, entities.AdjustReasonStockTake: -30},
+					VarianceRatio: -0.1,
+				},
+				"tea_leaves_syrup": {
+					Consumed:      70,
+					Variance:      7,
+					Reasons:       map[entities.AdjustReason]int{entities.AdjustReasonStockTake: 7},
+					VarianceRatio: 0.1,
+				},
+			},
+		},
+		{
+			name: "success | adjusted without drinks",
+			from: day.Add(24 * time.Hour),
+			to:   day.Add(48 * time.Hour),
+			want: map[string]*IngredientReconciliation{
+				"hot_milk": {
+					Variance: -100,
+					Reasons:  map[entities.AdjustReason]int{entities.AdjustReasonWaste: -100},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Reconcile(getTestRecords(), getTestAdjustments(), tt.from, tt.to)
+			assert.Equal(t, tt.from, got.From)
+			assert.Equal(t, tt.want, got.Ingredients)
+		})
+	}
+}
+
+func TestWriteReconciliationCSV(t *testing.T) {
+	day := _Morning.Truncate(24 * time.Hour)
+	reconciliation := Reconcile(getTestRecords(), getTestAdjustments(), day, day.Add(24*time.Hour))
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, WriteReconciliationCSV(&buf, reconciliation))
+	assert.Equal(t, `ingredient,metric,value
+hot_water,consumed,600
+hot_water,variance,-60
+hot_water,variance:SPILLAGE,-30
+hot_water,variance:STOCK_TAKE,-30
+hot_water,variance_ratio,-0.1000
+tea_leaves_syrup,consumed,70
+tea_leaves_syrup,variance,7
+tea_leaves_syrup,variance:STOCK_TAKE,7
+tea_leaves_syrup,variance_ratio,0.1000
+`, buf.String())
+}
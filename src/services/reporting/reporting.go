@@ -0,0 +1,147 @@
+package reporting
+
+import (
+	"coffeeMachine/src/entities"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const hourKeyLayout = "2006-01-02T15:00Z07:00"
+
+// Build aggregates the records served within [from, to) by beverage, hour and outlet
+func Build(records []Record, from, to time.Time) *Report {
+	report := &Report{
+		From:      from,
+		To:        to,
+		Total:     newAggregate(),
+		Beverages: make(map[string]*Aggregate, 0),
+		Hours:     make(map[string]*Aggregate, 0),
+		Outlets:   make(map[int]*Aggregate, 0),
+	}
+
+	for _, record := range records {
+		if !inRange(record.ServedAt, from, to) {
+			continue
+		}
+		hourKey := startOfHour(record.ServedAt).Format(hourKeyLayout)
+
+		if _, ok := report.Beverages[record.ItemID]; !ok {
+			report.Beverages[record.ItemID] = newAggregate()
+		}
+		if _, ok := report.Hours[hourKey]; !ok {
+			report.Hours[hourKey] = newAggregate()
+		}
+		if _, ok := report.Outlets[record.OutletID]; !ok {
+			report.Outlets[record.OutletID] = newAggregate()
+		}
+
+		for _, aggregate := range []*Aggregate{
+			report.Total,
+			report.Beverages[record.ItemID],
+			report.Hours[hourKey],
+			report.Outlets[record.OutletID],
+		} {
+			aggregate.add(record)
+		}
+	}
+	return report
+}
+
+// startOfHour is the start of the wall-clock hour in the time's own zone - Truncate works on UTC,
+// which splits the hours of zones with a non-whole-hour offset, like +05:30
+func startOfHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+func newAggregate() *Aggregate {
+	return &Aggregate{
+		Consumed: make(map[string]int, 0),
+	}
+}
+
+func (a *Aggregate) add(record Record) {
+	if record.Outcome != entities.GetItemOutcomePrepared {
+		a.NotPrepared += 1
+		return
+	}
+	a.Prepared += 1
+	for _, ingredient := range record.Ingredients {
+		a.Consumed[ingredient.ID] += ingredient.Quantity
+	}
+}
+
+// WriteJSON writes the report [ or a reconciliation ] as an indented json document
+func WriteJSON(w io.Writer, report interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+/*
+	WriteCSV writes the report in a long format, one metric per row:
+		dimension,key,metric,value
+		beverage,black_tea,prepared,3
+		beverage,black_tea,consumed:tea_leaves_syrup,90
+	Rows are sorted, so that two reports of the same records are byte-identical.
+*/
+func WriteCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"dimension", "key", "metric", "value"}); err != nil {
+		return err
+	}
+
+	rows := aggregateRows("total", "all", report.Total)
+	for _, key := range sortedKeys(report.Beverages) {
+		rows = append(rows, aggregateRows("beverage", key, report.Beverages[key])...)
+	}
+	for _, key := range sortedKeys(report.Hours) {
+		rows = append(rows, aggregateRows("hour", key, report.Hours[key])...)
+	}
+	outletIDs := make([]int, 0, len(report.Outlets))
+	for outletID := range report.Outlets {
+		outletIDs = append(outletIDs, outletID)
+	}
+	sort.Ints(outletIDs)
+	for _, outletID := range outletIDs {
+		rows = append(rows, aggregateRows("outlet", strconv.Itoa(outletID), report.Outlets[outletID])...)
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func aggregateRows(dimension, key string, aggregate *Aggregate) [][]string {
+	rows := [][]string{
+		{dimension, key, "prepared", strconv.Itoa(aggregate.Prepared)},
+		{dimension, key, "not_prepared", strconv.Itoa(aggregate.NotPrepared)},
+	}
+	for _, ingredientID := range sortedIngredientIDs(aggregate.Consumed) {
+		rows = append(rows, []string{dimension, key, "consumed:" + ingredientID, strconv.Itoa(aggregate.Consumed[ingredientID])})
+	}
+	return rows
+}
+
+func sortedKeys(m map[string]*Aggregate) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedIngredientIDs returns the ingredients of consumed quantities, by id
+func sortedIngredientIDs(consumed map[string]int) []string {
+	ingredientIDs := make([]string, 0, len(consumed))
+	for ingredientID := range consumed {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	sort.Strings(ingredientIDs)
+	return ingredientIDs
+}
@@ -0,0 +1,202 @@
+package reporting
+
+import (
+	"bytes"
+	"coffeeMachine/src/entities"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_Morning = time.Date(2020, 7, 1, 9, 15, 0, 0, time.UTC)
+	_Noon    = time.Date(2020, 7, 1, 12, 5, 0, 0, time.UTC)
+)
+
+func getTestRecords() []Record {
+	blackTea := []entities.Ingredient{
+		{ID: "hot_water", Quantity: 300},
+		{ID: "tea_leaves_syrup", Quantity: 30},
+	}
+	return []Record{
+		{ItemID: "black_tea", Outcome: entities.GetItemOutcomePrepared, OutletID: 0, ServedAt: _Morning, Ingredients: blackTea},
+		{ItemID: "black_tea", Outcome: entities.GetItemOutcomePrepared, OutletID: 1, ServedAt: _Morning.Add(time.Minute), Ingredients: blackTea},
+		{ItemID: "black_tea", Outcome: entities.GetItemOutcomeNotPrepared, OutletID: 1, ServedAt: _Noon, RejectReasons: []string{"insufficient"}},
+		{ItemID: "hot_tea", Outcome: entities.GetItemOutcomePrepared, OutletID: 0, ServedAt: _Noon, Ingredients: []entities.Ingredient{{ID: "tea_leaves_syrup", Quantity: 10}}},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		assert func(report *Report)
+	}{
+		{
+			name: "success | all records in range",
+			from: _Morning.Add(-time.Hour),
+			to:   _Noon.Add(time.Hour),
+			assert: func(report *Report) {
+				assert.Equal(t, 3, report.Total.Prepared)
+				assert.Equal(t, 1, report.Total.NotPrepared)
+				assert.Equal(t, 70, report.Total.Consumed["tea_leaves_syrup"])
+
+				assert.Equal(t, 2, report.Beverages["black_tea"].Prepared)
+				assert.Equal(t, 1, report.Beverages["black_tea"].NotPrepared)
+				assert.Equal(t, 60, report.Beverages["black_tea"].Consumed["tea_leaves_syrup"])
+
+				assert.Len(t, report.Hours, 2)
+				assert.Equal(t, 2, report.Hours["2020-07-01T09:00Z"].Prepared)
+				assert.Equal(t, 1, report.Hours["2020-07-01T12:00Z"].Prepared)
+
+				assert.Equal(t, 2, report.Outlets[0].Prepared)
+				assert.Equal(t, 1, report.Outlets[1].NotPrepared)
+			},
+		},
+		{
+			name: "success | only morning records in range",
+			from: _Morning,
+			to:   _Noon,
+			assert: func(report *Report) {
+				assert.Equal(t, 2, report.Total.Prepared)
+				assert.Equal(t, 0, report.Total.NotPrepared)
+				assert.NotContains(t, report.Beverages, "hot_tea")
+			},
+		},
+		{
+			name: "success | no records in range",
+			from: _Noon.Add(time.Hour),
+			to:   _Noon.Add(2 * time.Hour),
+			assert: func(report *Report) {
+				assert.Equal(t, 0, report.Total.Prepared)
+				assert.Empty(t, report.Beverages)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Build(getTestRecords(), tt.from, tt.to)
+			tt.assert(got)
+		})
+	}
+}
+
+func TestBuild_HoursOfHalfHourZone(t *testing.T) {
+	// 09:15 & 09:45 at +05:30 are 03:45 & 04:15 UTC, the same wall-clock hour but not the same UTC hour
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	morning := time.Date(2020, 7, 1, 9, 15, 0, 0, ist)
+	records := []Record{
+		{ItemID: "hot_tea", Outcome: entities.GetItemOutcomePrepared, ServedAt: morning},
+		{ItemID: "hot_tea", Outcome: entities.GetItemOutcomePrepared, ServedAt: morning.Add(30 * time.Minute)},
+		{ItemID: "hot_tea", Outcome: entities.GetItemOutcomePrepared, ServedAt: morning.Add(time.Hour)},
+	}
+
+	report := Build(records, morning, morning.Add(2*time.Hour))
+	assert.Len(t, report.Hours, 2)
+	assert.Equal(t, 2, report.Hours["2020-07-01T09:00+05:30"].Prepared)
+	assert.Equal(t, 1, report.Hours["2020-07-01T10:00+05:30"].Prepared)
+}
+
+func TestWriteCSV(t *testing.T) {
+	report := Build(getTestRecords(), _Morning, _Noon)
+
+	buf := bytes.Buffer{}
+	err := WriteCSV(&buf, report)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "dimension,key,metric,value", lines[0])
+	assert.Contains(t, lines, "total,all,prepared,2")
+	assert.Contains(t, lines, "beverage,black_tea,consumed:tea_leaves_syrup,60")
+	assert.Contains(t, lines, "hour,2020-07-01T09:00Z,prepared,2")
+	assert.Contains(t, lines, "outlet,1,consumed:hot_water,300")
+}
+
+func TestWriteJSON(t *testing.T) {
+	report := Build(getTestRecords(), _Morning, _Noon)
+
+	buf := bytes.Buffer{}
+	err := WriteJSON(&buf, report)
+	assert.NoError(t, err)
+
+	var got Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, report.Total, got.Total)
+	assert.Equal(t, report.Beverages, got.Beverages)
+	assert.Equal(t, report.Outlets, got.Outlets)
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store Store
+	}{
+		{
+			name:  "memory store",
+			store: NewMemoryStore(),
+		},
+		{
+			name:  "file store",
+			store: NewFileStore(filepath.Join(dir, "history.jsonl")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := tt.store.Records(ctx, _Morning, _Noon)
+			assert.NoError(t, err)
+			assert.Empty(t, records)
+
+			responses := []*entities.GetItemResponse{
+				{
+					Item:     entities.Item{ID: "black_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 300}}},
+					Outcome:  entities.GetItemOutcomePrepared,
+					OutletID: 2,
+					ServedAt: _Morning,
+				},
+				{
+					Item:          entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 200}}},
+					Outcome:       entities.GetItemOutcomeNotPrepared,
+					RejectReasons: []entities.RejectReason{{RejectReasonMsg: "insufficient"}},
+					ServedAt:      _Noon,
+				},
+			}
+			for _, resp := range responses {
+				assert.NoError(t, tt.store.Record(ctx, resp))
+			}
+
+			records, err = tt.store.Records(ctx, _Morning, _Noon.Add(time.Second))
+			assert.NoError(t, err)
+			assert.Len(t, records, 2)
+			assert.Equal(t, 2, records[0].OutletID)
+			assert.True(t, _Morning.Equal(records[0].ServedAt))
+			assert.Len(t, records[0].Ingredients, 1)
+			// ingredients of a rejected drink were never consumed
+			assert.Empty(t, records[1].Ingredients)
+			assert.Equal(t, []string{"insufficient"}, records[1].RejectReasons)
+
+			records, err = tt.store.Records(ctx, _Noon, _Noon.Add(time.Second))
+			assert.NoError(t, err)
+			assert.Len(t, records, 1)
+
+			if flusher, ok := tt.store.(Flusher); ok {
+				assert.NoError(t, flusher.Flush(ctx))
+			}
+		})
+	}
+}
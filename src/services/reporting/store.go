@@ -0,0 +1,164 @@
+package reporting
+
+import (
+	"bufio"
+	"coffeeMachine/src/entities"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recorder receives the outcome of every drink poured by the coffee-machine
+type Recorder interface {
+	Record(ctx context.Context, resp *entities.GetItemResponse) error
+}
+
+// Flusher is implemented by recorders which buffer, Flush makes sure everything recorded so far is persisted
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Store persists records, and allows reading them back for a time range
+type Store interface {
+	Recorder
+	Records(ctx context.Context, from, to time.Time) ([]Record, error)
+}
+
+// ToRecord converts the response returned by the coffee-machine to a record.
+// Ingredients are only counted as consumed if the drink was actually prepared.
+func ToRecord(resp *entities.GetItemResponse) Record {
+	record := Record{
+		ItemID:   resp.Item.ID,
+		Outcome:  resp.Outcome,
+		OutletID: resp.OutletID,
+		ServedAt: resp.ServedAt,
+	}
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		record.Ingredients = resp.Item.Ingredients
+		record.Lots = resp.Lots
+	}
+	for _, reason := range resp.RejectReasons {
+		record.RejectReasons = append(record.RejectReasons, reason.String())
+	}
+	return record
+}
+
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+/*
+	memoryStore keeps all records in a slice, guarded by a read-write mutex
+*/
+type memoryStore struct {
+	mutex   sync.RWMutex
+	records []Record
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		mutex:   sync.RWMutex{},
+		records: make([]Record, 0),
+	}
+}
+
+func (m *memoryStore) Record(ctx context.Context, resp *entities.GetItemResponse) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.records = append(m.records, ToRecord(resp))
+	return nil
+}
+
+func (m *memoryStore) Records(ctx context.Context, from, to time.Time) ([]Record, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	records := make([]Record, 0)
+	for _, record := range m.records {
+		if inRange(record.ServedAt, from, to) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+/*
+	fileStore appends every record as a json line to a file,
+	so that the history survives across runs of the coffee-machine
+*/
+type fileStore struct {
+	mutex sync.Mutex
+	path  string
+}
+
+func NewFileStore(path string) Store {
+	return &fileStore{
+		mutex: sync.Mutex{},
+		path:  path,
+	}
+}
+
+func (f *fileStore) Record(ctx context.Context, resp *entities.GetItemResponse) error {
+	line, err := json.Marshal(ToRecord(resp))
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Flush syncs the history file to disk, records are written as they come but may still sit in the OS's buffers
+func (f *fileStore) Flush(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+func (f *fileStore) Records(ctx context.Context, from, to time.Time) ([]Record, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	records := make([]Record, 0)
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		if inRange(record.ServedAt, from, to) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
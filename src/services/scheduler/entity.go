@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+type Action string
+
+const (
+	// ActionTake is an outlet picking the next item of the batch
+	ActionTake    Action = "TAKE"
+	ActionReserve Action = "RESERVE"
+	ActionConsume Action = "CONSUME"
+	ActionRelease Action = "RELEASE"
+	// ActionRetry is an outlet retrying an item, after some ingredient was temporarily unavailable
+	ActionRetry Action = "RETRY"
+	// ActionClean is an outlet running the cleaning cycle of a rule, which draws hot_water
+	ActionClean Action = "CLEAN"
+)
+
+// Step is a single operation of an outlet, outlets can only interleave between steps
+type Step struct {
+	OutletID int    `json:"outlet_id"`
+	Action   Action `json:"action"`
+	ItemID   string `json:"item_id,omitempty"`
+	// Rule is the cleaning rule of an ActionClean step
+	Rule string `json:"rule,omitempty"`
+}
+
+/*
+	Trace is the sequence of steps, in the order they were taken. It covers whatever an outlet does to the inventory -
+	taking an item, reserving all its ingredients at once [ a single step, since the ledger reserves an order all
+	or nothing ], consuming or releasing the reservation, retrying, and cleaning cycles. Refills, pre-orders and
+	other callers of the machine aren't outlets, so a replay is only deterministic if they don't run meanwhile.
+*/
+type Trace []Step
+
+// WriteTrace writes the trace as json, so that it can be attached to a bug report and replayed in a test
+func WriteTrace(w io.Writer, trace Trace) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(trace)
+}
+
+func ReadTrace(r io.Reader) (Trace, error) {
+	var trace Trace
+	if err := json.NewDecoder(r).Decode(&trace); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+type ErrReplayDiverged struct {
+	Position int
+	Expected *Step
+	Actual   Step
+}
+
+func (e ErrReplayDiverged) Error() string {
+	expected := "end of trace"
+	if e.Expected != nil {
+		expected = string(e.Expected.Action) + " " + e.Expected.ItemID + " " + e.Expected.Rule
+	}
+	return "replay diverged from trace at step " + strconv.Itoa(e.Position) + ", expected : " + expected + ", actual : " +
+		string(e.Actual.Action) + " " + e.Actual.ItemID + " " + e.Actual.Rule
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+/*
+	Scheduler serializes the outlets of a coffee-machine, so that a batch is poured the same way every time.
+	Every outlet goroutine announces each step it is about to take, and blocks until it is granted.
+	A step is only granted once all active outlets are blocked, so exactly one outlet runs at any time,
+	and the only source of non-determinism left is the choice of which outlet goes next.
+
+	A scheduler drives one batch at a time, outlet ids must be unique among the started outlets.
+*/
+type Scheduler interface {
+	// Start registers the outlets of a batch, before any of them takes a step
+	Start(numOfOutlets int)
+	// Step blocks the outlet until it is its turn to take the step
+	Step(step Step)
+	// Done unregisters an outlet which will take no more steps
+	Done(outletID int)
+	// Trace returns all the steps granted so far
+	Trace() Trace
+	// Err returns ErrReplayDiverged if the outlets didn't follow the replayed trace
+	Err() error
+}
+
+type waiter struct {
+	step  Step
+	grant chan struct{}
+}
+
+type schedulerImpl struct {
+	mutex   sync.Mutex
+	rand    *rand.Rand
+	replay  Trace
+	active  int
+	waiting map[int]waiter
+	trace   Trace
+	err     error
+}
+
+// NewSeeded returns a scheduler which picks the next outlet pseudo-randomly,
+// the same seed always leads to the same interleaving
+func NewSeeded(seed int64) Scheduler {
+	return &schedulerImpl{
+		mutex:   sync.Mutex{},
+		rand:    rand.New(rand.NewSource(seed)),
+		waiting: make(map[int]waiter, 0),
+		trace:   make(Trace, 0),
+	}
+}
+
+// NewReplay returns a scheduler which picks the outlets in the order of a recorded trace
+func NewReplay(trace Trace) Scheduler {
+	return &schedulerImpl{
+		mutex:   sync.Mutex{},
+		replay:  trace,
+		waiting: make(map[int]waiter, 0),
+		trace:   make(Trace, 0),
+	}
+}
+
+func (s *schedulerImpl) Start(numOfOutlets int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.active += numOfOutlets
+}
+
+func (s *schedulerImpl) Step(step Step) {
+	grant := make(chan struct{})
+
+	s.mutex.Lock()
+	s.waiting[step.OutletID] = waiter{step: step, grant: grant}
+	s.grantIfIdle()
+	s.mutex.Unlock()
+
+	<-grant
+}
+
+func (s *schedulerImpl) Done(outletID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.active -= 1
+	s.grantIfIdle()
+}
+
+func (s *schedulerImpl) Trace() Trace {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append(Trace{}, s.trace...)
+}
+
+func (s *schedulerImpl) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+// grantIfIdle must be called with the mutex held
+func (s *schedulerImpl) grantIfIdle() {
+	if len(s.waiting) == 0 || len(s.waiting) < s.active {
+		return
+	}
+
+	outletID := s.next()
+	w := s.waiting[outletID]
+	delete(s.waiting, outletID)
+	s.trace = append(s.trace, w.step)
+	close(w.grant)
+}
+
+func (s *schedulerImpl) next() int {
+	outletIDs := make([]int, 0, len(s.waiting))
+	for outletID := range s.waiting {
+		outletIDs = append(outletIDs, outletID)
+	}
+	sort.Ints(outletIDs)
+
+	if s.rand != nil {
+		return outletIDs[s.rand.Intn(len(outletIDs))]
+	}
+
+	position := len(s.trace)
+	if s.err == nil && position < len(s.replay) {
+		expected := s.replay[position]
+		if w, ok := s.waiting[expected.OutletID]; ok && w.step == expected {
+			return expected.OutletID
+		}
+	}
+
+	// once diverged, the rest of the trace is meaningless - so we fall back to the lowest outlet
+	if s.err == nil {
+		diverged := ErrReplayDiverged{Position: position, Actual: s.waiting[outletIDs[0]].step}
+		if position < len(s.replay) {
+			diverged.Expected = &s.replay[position]
+		}
+		s.err = diverged
+	}
+	return outletIDs[0]
+}
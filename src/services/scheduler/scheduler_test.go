@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runOutlets runs outlets which each take the given number of steps, and returns the resulting trace
+func runOutlets(s Scheduler, stepsPerOutlet []int) Trace {
+	s.Start(len(stepsPerOutlet))
+
+	wg := sync.WaitGroup{}
+	for outletID, steps := range stepsPerOutlet {
+		wg.Add(1)
+		go func(outletID, steps int) {
+			defer wg.Done()
+			defer s.Done(outletID)
+			for i := 0; i < steps; i++ {
+				s.Step(Step{OutletID: outletID, Action: ActionTake})
+			}
+		}(outletID, steps)
+	}
+	wg.Wait()
+	return s.Trace()
+}
+
+func TestNewSeeded(t *testing.T) {
+	tests := []struct {
+		name   string
+		assert func()
+	}{
+		{
+			name: "success | same seed, same trace",
+			assert: func() {
+				first := runOutlets(NewSeeded(42), []int{5, 3, 4})
+				second := runOutlets(NewSeeded(42), []int{5, 3, 4})
+				assert.Len(t, first, 12)
+				assert.Equal(t, first, second)
+			},
+		},
+		{
+			name: "success | no outlets",
+			assert: func() {
+				assert.Empty(t, runOutlets(NewSeeded(42), []int{}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assert()
+		})
+	}
+}
+
+func TestNewReplay(t *testing.T) {
+	recorded := runOutlets(NewSeeded(7), []int{3, 3, 3})
+
+	tests := []struct {
+		name           string
+		trace          Trace
+		stepsPerOutlet []int
+		assert         func(trace Trace, err error)
+	}{
+		{
+			name:           "success | replay follows the trace",
+			trace:          recorded,
+			stepsPerOutlet: []int{3, 3, 3},
+			assert: func(trace Trace, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, recorded, trace)
+			},
+		},
+		{
+			name:           "error | outlets take more steps than recorded",
+			trace:          recorded,
+			stepsPerOutlet: []int{4, 3, 3},
+			assert: func(trace Trace, err error) {
+				assert.IsType(t, ErrReplayDiverged{}, err)
+				assert.Len(t, trace, 10)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewReplay(tt.trace)
+			got := runOutlets(s, tt.stepsPerOutlet)
+			tt.assert(got, s.Err())
+		})
+	}
+}
+
+func TestWriteTrace(t *testing.T) {
+	trace := Trace{
+		{OutletID: 1, Action: ActionReserve, ItemID: "hot_tea"},
+		{OutletID: 1, Action: ActionClean, Rule: "rinse"},
+		{OutletID: 0, Action: ActionRetry, ItemID: "black_tea"},
+	}
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, WriteTrace(&buf, trace))
+	got, err := ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, trace, got)
+}
@@ -0,0 +1,214 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/scheduler"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// cleaningIngredient is what every cleaning cycle rinses an outlet with
+const cleaningIngredient = "hot_water"
+
+// ruleHygiene tracks a cleaning rule on an outlet, since the rule's last cleaning cycle
+type ruleHygiene struct {
+	drinks    int
+	cleanedAt time.Time
+	// warned is set once the overdue cleaning was warned about, so it's warned about only once
+	warned bool
+}
+
+/*
+	hygiene tracks every cleaning rule on every outlet it applies to.
+	Outlets outlive batches, so it's kept on the machine instead of the workers.
+*/
+type hygiene struct {
+	mutex sync.Mutex
+	rules []CleaningRule
+	// outlets maps outlet-ids to the tracking of each rule, by the index of the rule - nil if it doesn't apply
+	outlets map[int][]*ruleHygiene
+}
+
+func newHygiene(rules []CleaningRule, numOfOutlets int, now time.Time) *hygiene {
+	h := &hygiene{
+		mutex:   sync.Mutex{},
+		rules:   rules,
+		outlets: make(map[int][]*ruleHygiene, numOfOutlets),
+	}
+	for outletID := 0; outletID < numOfOutlets; outletID += 1 {
+		tracking := make([]*ruleHygiene, len(rules))
+		for idx, rule := range rules {
+			if rule.appliesTo(outletID) {
+				tracking[idx] = &ruleHygiene{cleanedAt: now}
+			}
+		}
+		h.outlets[outletID] = tracking
+	}
+	return h
+}
+
+func (r CleaningRule) appliesTo(outletID int) bool {
+	if len(r.OutletIDs) == 0 {
+		return true
+	}
+	for _, id := range r.OutletIDs {
+		if id == outletID {
+			return true
+		}
+	}
+	return false
+}
+
+// counts tells if the rule counts the item, because it contains one of the rule's ingredients
+func (r CleaningRule) counts(item entities.Item) bool {
+	if len(r.Ingredients) == 0 {
+		return true
+	}
+	for _, ingredient := range item.Ingredients {
+		for _, id := range r.Ingredients {
+			if ingredient.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r CleaningRule) isDue(tracking *ruleHygiene, now time.Time) bool {
+	return r.AfterDrinks > 0 && tracking.drinks >= r.AfterDrinks ||
+		r.Every > 0 && !now.Before(tracking.cleanedAt.Add(r.Every))
+}
+
+// countDrink counts a drink prepared at the outlet, against every rule counting it
+func (c *coffeeMachineImpl) countDrink(outletID int, item entities.Item) {
+	c.hygiene.mutex.Lock()
+	defer c.hygiene.mutex.Unlock()
+
+	for idx, tracking := range c.hygiene.outlets[outletID] {
+		if tracking != nil && c.hygiene.rules[idx].counts(item) {
+			tracking.drinks += 1
+		}
+	}
+}
+
+// dueRules returns the indexes of the rules due on the outlet
+func (c *coffeeMachineImpl) dueRules(outletID int) []int {
+	c.hygiene.mutex.Lock()
+	defer c.hygiene.mutex.Unlock()
+
+	now := c.clock.Now()
+	due := make([]int, 0)
+	for idx, tracking := range c.hygiene.outlets[outletID] {
+		if tracking != nil && c.hygiene.rules[idx].isDue(tracking, now) {
+			due = append(due, idx)
+		}
+	}
+	return due
+}
+
+/*
+	cleanIfDue runs the cleaning cycle of every rule due on the outlet, before the drink the outlet has just taken -
+	the other outlets of the batch keep taking drinks meanwhile. A cycle consumes hot_water, and takes the rule's duration.
+
+	If a cycle can't run, since there isn't enough hot_water, the outlet keeps pouring and the overdue cleaning
+	is warned about - by a log line and an event, once till the outlet is finally cleaned. A cycle interrupted
+	by cancelling the context has drawn its hot_water, but leaves the outlet due.
+	Every cycle is a step of the scheduler, so that it draws hot_water at the same point of a replay.
+*/
+func (c *coffeeMachineImpl) cleanIfDue(ctx context.Context, outletID int) {
+	for _, idx := range c.dueRules(outletID) {
+		rule := c.hygiene.rules[idx]
+		c.step(scheduler.Step{OutletID: outletID, Action: scheduler.ActionClean, Rule: rule.Name})
+		if rule.Water > 0 {
+			_, err := c.resourceManager.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+				IngredientID:     cleaningIngredient,
+				UpdateType:       resourcemanager.UpdateTypeConsume,
+				ResourceQuantity: rule.Water,
+			})
+			if err != nil {
+				c.warnOverdue(outletID, idx, err)
+				continue
+			}
+			c.draw([]entities.Ingredient{{ID: cleaningIngredient, Quantity: rule.Water}})
+		}
+		if err := c.wait(ctx, rule.Duration); err != nil {
+			return
+		}
+
+		c.hygiene.mutex.Lock()
+		tracking := c.hygiene.outlets[outletID][idx]
+		tracking.drinks = 0
+		tracking.cleanedAt = c.clock.Now()
+		tracking.warned = false
+		c.hygiene.mutex.Unlock()
+
+		c.publish(eventbus.Event{
+			Type:        eventbus.TypeOutletCleaned,
+			OutletID:    outletID,
+			Ingredients: []entities.Ingredient{{ID: cleaningIngredient, Quantity: rule.Water}},
+			Reason:      rule.Name,
+		})
+	}
+}
+
+func (c *coffeeMachineImpl) warnOverdue(outletID int, ruleIdx int, err error) {
+	c.hygiene.mutex.Lock()
+	tracking := c.hygiene.outlets[outletID][ruleIdx]
+	warned := tracking.warned
+	tracking.warned = true
+	c.hygiene.mutex.Unlock()
+	if warned {
+		return
+	}
+
+	rule := c.hygiene.rules[ruleIdx]
+	log.Printf("cleaning %s of outlet %d is overdue: %v", rule.Name, outletID, err)
+	c.publish(eventbus.Event{Type: eventbus.TypeCleaningOverdue, OutletID: outletID, Reason: rule.Name})
+}
+
+// wait blocks for the duration on the machine's clock, or till the context is cancelled
+func (c *coffeeMachineImpl) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	done := make(chan struct{})
+	timer := c.clock.AfterFunc(d, func() {
+		close(done)
+	})
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	}
+}
+
+// Hygiene reports every cleaning rule on every outlet it applies to, ordered by outlet & rule
+func (c *coffeeMachineImpl) Hygiene(ctx context.Context) []OutletHygiene {
+	c.hygiene.mutex.Lock()
+	defer c.hygiene.mutex.Unlock()
+
+	now := c.clock.Now()
+	report := make([]OutletHygiene, 0)
+	for outletID := 0; outletID < c.numOfOutlets; outletID += 1 {
+		for idx, tracking := range c.hygiene.outlets[outletID] {
+			if tracking == nil {
+				continue
+			}
+			rule := c.hygiene.rules[idx]
+			report = append(report, OutletHygiene{
+				OutletID:            outletID,
+				Rule:                rule.Name,
+				DrinksSinceCleaning: tracking.drinks,
+				LastCleanedAt:       tracking.cleanedAt,
+				Overdue:             rule.isDue(tracking, now),
+			})
+		}
+	}
+	return report
+}
@@ -0,0 +1,159 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coffeeMachineImpl_Cleaning(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	latte := entities.Item{ID: "latte", Ingredients: []entities.Ingredient{{ID: "hot_milk", Quantity: 100}}}
+	milkRinse := CleaningRule{Name: "milk_rinse", Ingredients: []string{"hot_milk"}, AfterDrinks: 2, Water: 50}
+	hourly := CleaningRule{Name: "hourly", Every: time.Hour, Water: 30}
+
+	tests := []struct {
+		name          string
+		rules         []CleaningRule
+		numOfOutlets  int
+		hotWater      int
+		action        func(c CoffeeMachine, fakeClock *clock.Fake)
+		wantHotWater  int
+		wantHygiene   []OutletHygiene
+		wantCleanings int
+		wantOverdue   int
+	}{
+		{
+			name:         "success | rinsed after milk drinks",
+			rules:        []CleaningRule{milkRinse},
+			numOfOutlets: 1,
+			hotWater:     1000,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) {
+				for range c.PourDrinks(ctx, []entities.Item{latte, hotTea, latte, latte}) {
+				}
+			},
+			// 200 for the tea, 50 for the rinse after the second latte
+			wantHotWater: 750,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 0, Rule: "milk_rinse", DrinksSinceCleaning: 1, LastCleanedAt: start},
+			},
+			wantCleanings: 1,
+		},
+		{
+			name:         "success | overdue time rule cleaned by the next batch",
+			rules:        []CleaningRule{hourly},
+			numOfOutlets: 1,
+			hotWater:     1000,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) {
+				fakeClock.Advance(time.Hour)
+				assert.True(t, c.Hygiene(ctx)[0].Overdue)
+				for range c.PourDrinks(ctx, []entities.Item{hotTea}) {
+				}
+			},
+			wantHotWater: 770,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 0, Rule: "hourly", DrinksSinceCleaning: 1, LastCleanedAt: start.Add(time.Hour)},
+			},
+			wantCleanings: 1,
+		},
+		{
+			name:         "success | rule of a single outlet",
+			rules:        []CleaningRule{{Name: "outlet_1", OutletIDs: []int{1}, AfterDrinks: 10}},
+			numOfOutlets: 2,
+			hotWater:     1000,
+			action:       func(c CoffeeMachine, fakeClock *clock.Fake) {},
+			wantHotWater: 1000,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 1, Rule: "outlet_1", LastCleanedAt: start},
+			},
+		},
+		{
+			name:         "success | cycle due after the last drink doesn't hold the batch",
+			rules:        []CleaningRule{{Name: "flush", AfterDrinks: 1, Water: 30, Duration: time.Hour}},
+			numOfOutlets: 1,
+			hotWater:     1000,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) {
+				// the fake clock is never advanced, a cycle started here would never finish
+				for range c.PourDrinks(ctx, []entities.Item{hotTea}) {
+				}
+			},
+			wantHotWater: 800,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 0, Rule: "flush", DrinksSinceCleaning: 1, LastCleanedAt: start, Overdue: true},
+			},
+		},
+		{
+			name:         "error | cycle interrupted by a cancelled context",
+			rules:        []CleaningRule{{Name: "flush", AfterDrinks: 1, Water: 30, Duration: time.Hour}},
+			numOfOutlets: 1,
+			hotWater:     1000,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) {
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+				for range c.PourDrinks(cancelled, []entities.Item{hotTea, hotTea}) {
+				}
+			},
+			// the interrupted cycle has drawn its water, the outlet is still due
+			wantHotWater: 570,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 0, Rule: "flush", DrinksSinceCleaning: 2, LastCleanedAt: start, Overdue: true},
+			},
+		},
+		{
+			name:         "error | overdue without enough hot water, warned once",
+			rules:        []CleaningRule{{Name: "descale", AfterDrinks: 1, Water: 500}},
+			numOfOutlets: 1,
+			hotWater:     600,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) {
+				for range c.PourDrinks(ctx, []entities.Item{hotTea, hotTea}) {
+				}
+			},
+			// drinks are still poured
+			wantHotWater: 200,
+			wantHygiene: []OutletHygiene{
+				{OutletID: 0, Rule: "descale", DrinksSinceCleaning: 2, LastCleanedAt: start, Overdue: true},
+			},
+			wantOverdue: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(start)
+			bus := eventbus.New()
+			counts := make(map[eventbus.Type]int, 0)
+			bus.Subscribe(func(event eventbus.Event) {
+				counts[event.Type] += 1
+			}, eventbus.Types(eventbus.TypeOutletCleaned, eventbus.TypeCleaningOverdue))
+
+			resourceManager := resourcemanager.New()
+			c := New(Params{
+				ResourceManager: resourceManager,
+				NumOfOutlets:    tt.numOfOutlets,
+				Clock:           fakeClock,
+				EventBus:        bus,
+				CleaningRules:   tt.rules,
+			})
+			for _, ingredient := range []entities.Ingredient{{ID: "hot_water", Quantity: tt.hotWater}, {ID: "hot_milk", Quantity: 1000}} {
+				if err := c.Refill(ctx, ingredient); err != nil {
+					panic(err)
+				}
+			}
+
+			tt.action(c, fakeClock)
+
+			hotWater, _ := resourceManager.GetIngredient(ctx, resourcemanager.GetRequest{IngredientID: "hot_water"})
+			assert.Equal(t, tt.wantHotWater, hotWater.Quantity)
+			assert.Equal(t, tt.wantHygiene, c.Hygiene(ctx))
+			assert.Equal(t, tt.wantCleanings, counts[eventbus.TypeOutletCleaned])
+			assert.Equal(t, tt.wantOverdue, counts[eventbus.TypeCleaningOverdue])
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"time"
+)
+
+/*
+	State of the machine - orders are only poured while it's READY.
+
+	A machine starts in STARTING, where it can be primed with refills & recipes.
+	MAINTENANCE allows refills & recipe changes, while CLEANING allows neither.
+	Both are entered through DRAINING, which rejects new orders while the ones in flight are served.
+	A FAULTED machine has to go through MAINTENANCE, before it's READY again.
+	A machine which was shut down is STOPPED for good.
+*/
+type State string
+
+const (
+	StateStarting    State = "STARTING"
+	StateReady       State = "READY"
+	StateDraining    State = "DRAINING"
+	StateMaintenance State = "MAINTENANCE"
+	StateCleaning    State = "CLEANING"
+	StateFaulted     State = "FAULTED"
+	StateStopped     State = "STOPPED"
+)
+
+type SetStateRequest struct {
+	State State
+	// Reason is optional, it's published with the state change
+	Reason string
+}
+
+type RefillLotRequest struct {
+	Ingredient entities.Ingredient
+	// LotID & ExpiresAt are optional, a lot without an expiry never expires
+	LotID     string
+	ExpiresAt time.Time
+}
+
+type IngredientRequest struct {
+	IngredientID string
+}
+
+// AdjustRequest sets the quantity on hand of the ingredient to its quantity
+type AdjustRequest struct {
+	Ingredient entities.Ingredient
+	Reason     entities.AdjustReason
+}
+
+type PreOrderRequest struct {
+	OrderID string
+	Item    entities.Item
+	// Window is how long the ingredients are held for, before they are released to other orders
+	Window time.Duration
+}
+
+type CollectRequest struct {
+	Token string
+	// OutletID is the outlet the pre-order is poured at
+	OutletID int
+}
+
+type AbandonReason string
+
+const (
+	// AbandonReasonNotPoured - the item of a batch didn't reach an outlet before the deadline of the shutdown
+	AbandonReasonNotPoured AbandonReason = "NOT_POURED"
+	// AbandonReasonNotCollected - the pre-order wasn't collected, its reservation was cancelled
+	AbandonReasonNotCollected AbandonReason = "NOT_COLLECTED"
+)
+
+type AbandonedOrder struct {
+	OrderID string
+	// Token is only set for pre-orders
+	Token  string
+	Reason AbandonReason
+}
+
+type ShutdownSummary struct {
+	Abandoned []AbandonedOrder
+	// ReleasedReservations is the number of pending reservations cancelled, including the ones of pre-orders
+	ReleasedReservations int
+}
+
+/*
+	CleaningRule decides when an outlet has to be rinsed - after a number of drinks containing any of the
+	rule's ingredients, or once some time passed since the outlet was last cleaned by the rule, whichever is first.
+*/
+type CleaningRule struct {
+	Name string
+	// OutletIDs the rule applies to, every outlet if empty
+	OutletIDs []int
+	// Ingredients counted drinks contain one of, e.g. hot_milk - every drink is counted if empty
+	Ingredients []string
+	// AfterDrinks & Every are optional, zero disables them
+	AfterDrinks int
+	Every       time.Duration
+	// Water is the hot_water consumed by a cleaning cycle, and Duration how long it takes the outlet out of rotation
+	Water    int
+	Duration time.Duration
+}
+
+type OutletHygiene struct {
+	OutletID int
+	Rule     string
+	// DrinksSinceCleaning only counts the drinks the rule counts
+	DrinksSinceCleaning int
+	LastCleanedAt       time.Time
+	// Overdue is set once the rule is due, till the outlet is cleaned - by the next batch, if there's enough hot_water
+	Overdue bool
+}
+
+// Inventory is what the machine holds at a single instant
+type Inventory struct {
+	TakenAt time.Time
+	// Ingredients are sorted by id
+	Ingredients []resourcemanager.Levels
+	// PendingReservations is the number of orders holding ingredients, e.g. pre-orders which aren't collected yet
+	PendingReservations int
+}
+
+// RecipeAvailability tells if a recipe of the menu can be ordered, and why not
+type RecipeAvailability struct {
+	Recipe    entities.Item
+	Available bool
+	// RejectReasons has a reason for every ingredient of the recipe which was removed or deactivated
+	RejectReasons []entities.RejectReason
+}
@@ -0,0 +1,63 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/heater"
+	"context"
+	"time"
+)
+
+/*
+	heat makes the outlet wait for the boilers of the item's hot ingredients to be hot enough to pour from,
+	the other outlets keep pouring meanwhile. Since they may draw from the same boilers, the boilers are
+	checked again after every wait. If they wouldn't be hot enough within MaxHeatWait the item is rejected,
+	as it is if the context is cancelled while waiting.
+*/
+func (c *coffeeMachineImpl) heat(ctx context.Context, outletID int, item entities.Item) error {
+	if c.heater == nil {
+		return nil
+	}
+	ingredientIDs := make([]string, 0, len(item.Ingredients))
+	for _, ingredient := range item.Ingredients {
+		ingredientIDs = append(ingredientIDs, ingredient.ID)
+	}
+
+	waited := time.Duration(0)
+	for {
+		coldest, ok := coldestBoiler(c.heater.Status(ingredientIDs...))
+		if !ok {
+			return nil
+		}
+		if coldest.ReadyIn > c.maxHeatWait-waited {
+			return entities.ErrBelowTemperature{
+				ResourceID:     coldest.Ingredient,
+				Temperature:    coldest.Temperature,
+				MinTemperature: coldest.MinTemperature,
+			}
+		}
+		c.publish(eventbus.Event{Type: eventbus.TypeWaitingForHeat, OrderID: item.ID, OutletID: outletID, Reason: coldest.Ingredient})
+		if err := c.wait(ctx, coldest.ReadyIn); err != nil {
+			return err
+		}
+		waited += coldest.ReadyIn
+	}
+}
+
+// coldestBoiler returns the boiler which takes longest to be hot enough, if any isn't
+func coldestBoiler(statuses []heater.BoilerStatus) (heater.BoilerStatus, bool) {
+	coldest := heater.BoilerStatus{}
+	for _, status := range statuses {
+		if status.ReadyIn > coldest.ReadyIn {
+			coldest = status
+		}
+	}
+	return coldest, coldest.ReadyIn > 0
+}
+
+// draw cools down the boilers of the ingredients poured, if there is a heater
+func (c *coffeeMachineImpl) draw(ingredients []entities.Ingredient) {
+	if c.heater != nil {
+		c.heater.Draw(ingredients)
+	}
+}
@@ -0,0 +1,119 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/heater"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coffeeMachineImpl_Heating(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+	// heats by 1°C a second, a tea cools it down by 15°C
+	boiler := heater.Boiler{Ingredient: "hot_water", TargetTemperature: 95, MinTemperature: 85, Capacity: 1000, WarmUp: 75 * time.Second}
+
+	// pourAdvancing keeps advancing the clock while the batch is poured, so that outlets waiting for heat get to pour
+	pourAdvancing := func(c CoffeeMachine, fakeClock *clock.Fake, items []entities.Item) []*entities.GetItemResponse {
+		done := make(chan []*entities.GetItemResponse)
+		go func() {
+			responses := make([]*entities.GetItemResponse, 0)
+			for resp := range c.PourDrinks(ctx, items) {
+				responses = append(responses, resp)
+			}
+			done <- responses
+		}()
+		for {
+			select {
+			case responses := <-done:
+				return responses
+			case <-time.After(time.Millisecond):
+				fakeClock.Advance(time.Second)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		preheated   bool
+		maxHeatWait time.Duration
+		action      func(c CoffeeMachine, fakeClock *clock.Fake) []*entities.GetItemResponse
+		// wantCodes has an empty code for every prepared drink
+		wantCodes []entities.RejectCode
+		wantWaits int
+	}{
+		{
+			name:        "success | reheated after a draw",
+			preheated:   true,
+			maxHeatWait: 10 * time.Second,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) []*entities.GetItemResponse {
+				return pourAdvancing(c, fakeClock, []entities.Item{hotTea, hotTea})
+			},
+			wantCodes: []entities.RejectCode{"", ""},
+			wantWaits: 1,
+		},
+		{
+			name:        "error | reheating takes too long",
+			preheated:   true,
+			maxHeatWait: 2 * time.Second,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) []*entities.GetItemResponse {
+				return pourAdvancing(c, fakeClock, []entities.Item{hotTea, hotTea})
+			},
+			wantCodes: []entities.RejectCode{"", entities.RejectCodeBelowTemperature},
+		},
+		{
+			name:        "success | pre-order kept till the boiler warmed up",
+			maxHeatWait: 0,
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) []*entities.GetItemResponse {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour})
+				if err != nil {
+					panic(err)
+				}
+				cold := c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+				fakeClock.Advance(65 * time.Second)
+				return []*entities.GetItemResponse{cold, c.Collect(ctx, CollectRequest{Token: preOrder.Token})}
+			},
+			wantCodes: []entities.RejectCode{entities.RejectCodeBelowTemperature, ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(start)
+			bus := eventbus.New()
+			waits := 0
+			bus.Subscribe(func(event eventbus.Event) {
+				waits += 1
+			}, eventbus.Types(eventbus.TypeWaitingForHeat))
+
+			c := New(Params{
+				ResourceManager: resourcemanager.New(),
+				NumOfOutlets:    1,
+				Clock:           fakeClock,
+				EventBus:        bus,
+				Heater:          heater.New(heater.Params{Boilers: []heater.Boiler{boiler}, AmbientTemperature: 20, Preheated: tt.preheated, Clock: fakeClock}),
+				MaxHeatWait:     tt.maxHeatWait,
+			})
+			if err := c.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 1000}); err != nil {
+				panic(err)
+			}
+
+			responses := tt.action(c, fakeClock)
+			codes := make([]entities.RejectCode, 0, len(responses))
+			for _, resp := range responses {
+				if resp.Outcome == entities.GetItemOutcomePrepared {
+					codes = append(codes, "")
+					continue
+				}
+				codes = append(codes, resp.RejectReasons[0].Code)
+			}
+			assert.Equal(t, tt.wantCodes, codes)
+			assert.Equal(t, tt.wantWaits, waits)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"context"
+)
+
+/*
+	Ingredients can be added, deactivated & removed while the machine takes orders - unlike refills, the lifecycle
+	doesn't lock pours out. Drinks which already reserved a deactivated ingredient are still poured, the ones
+	reserving it later are rejected with RejectCodeIngredientDeactivated.
+*/
+func (c *coffeeMachineImpl) AddIngredient(ctx context.Context, req IngredientRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "adding ingredients", State: string(state)}
+	}
+	return c.resourceManager.AddIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: req.IngredientID})
+}
+
+func (c *coffeeMachineImpl) DeactivateIngredient(ctx context.Context, req IngredientRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "deactivating ingredients", State: string(state)}
+	}
+	return c.resourceManager.DeactivateIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: req.IngredientID})
+}
+
+// RemoveIngredient only removes a deactivated ingredient once it's empty, see resourcemanager.Repository
+func (c *coffeeMachineImpl) RemoveIngredient(ctx context.Context, req IngredientRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "removing ingredients", State: string(state)}
+	}
+	return c.resourceManager.RemoveIngredient(ctx, resourcemanager.IngredientRequest{IngredientID: req.IngredientID})
+}
+
+/*
+	Availability marks the recipes of the menu using an ingredient which was removed [ or never added ],
+	or deactivated - they can't be poured until it's added again. It doesn't look at the quantities though,
+	since those change with every drink.
+*/
+func (c *coffeeMachineImpl) Availability(ctx context.Context) ([]RecipeAvailability, error) {
+	menu := c.Menu(ctx)
+	availability := make([]RecipeAvailability, 0, len(menu))
+	for _, recipe := range menu {
+		reasons := make([]entities.RejectReason, 0)
+		for _, ingredient := range recipe.Ingredients {
+			levels, err := c.resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredient.ID})
+			if _, ok := err.(entities.ErrResourceNotAvailable); ok {
+				reasons = append(reasons, entities.RejectReason{Code: rejectCode(err), RejectReasonMsg: err.Error()})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if levels.Deactivated {
+				err = entities.ErrIngredientDeactivated{ResourceID: ingredient.ID}
+				reasons = append(reasons, entities.RejectReason{Code: rejectCode(err), RejectReasonMsg: err.Error()})
+			}
+		}
+		availability = append(availability, RecipeAvailability{
+			Recipe:        recipe,
+			Available:     len(reasons) == 0,
+			RejectReasons: reasons,
+		})
+	}
+	return availability, nil
+}
@@ -0,0 +1,106 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coffeeMachineImpl_DeactivateIngredient(t *testing.T) {
+	ctx := context.Background()
+	hotWater := IngredientRequest{IngredientID: "hot_water"}
+
+	tests := []struct {
+		name string
+		// action deactivates hot_water, and returns the response of the next drink
+		action func(c CoffeeMachine) *entities.GetItemResponse
+		// wantRejectCode is empty if the drink is prepared
+		wantRejectCode entities.RejectCode
+	}{
+		{
+			name: "success | pre-order reserved before deactivating is collected",
+			action: func(c CoffeeMachine) *entities.GetItemResponse {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour})
+				if err != nil {
+					panic(err)
+				}
+				assert.NoError(t, c.DeactivateIngredient(ctx, hotWater))
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+			},
+		},
+		{
+			name: "success | poured once activated again",
+			action: func(c CoffeeMachine) *entities.GetItemResponse {
+				assert.NoError(t, c.DeactivateIngredient(ctx, hotWater))
+				assert.NoError(t, c.AddIngredient(ctx, hotWater))
+				return pourOne(ctx, c, hotTea)
+			},
+		},
+		{
+			name: "error | drink rejected with the reason",
+			action: func(c CoffeeMachine) *entities.GetItemResponse {
+				assert.NoError(t, c.DeactivateIngredient(ctx, hotWater))
+				return pourOne(ctx, c, hotTea)
+			},
+			wantRejectCode: entities.RejectCodeIngredientDeactivated,
+		},
+		{
+			name: "error | removed once empty",
+			action: func(c CoffeeMachine) *entities.GetItemResponse {
+				assert.NoError(t, c.DeactivateIngredient(ctx, hotWater))
+				assert.Equal(t, entities.ErrIngredientNotEmpty{ResourceID: "hot_water", OnHand: 1000}, c.RemoveIngredient(ctx, hotWater))
+				assert.NoError(t, c.Adjust(ctx, AdjustRequest{Ingredient: entities.Ingredient{ID: "hot_water"}, Reason: entities.AdjustReasonWaste}))
+				assert.NoError(t, c.RemoveIngredient(ctx, hotWater))
+				return pourOne(ctx, c, hotTea)
+			},
+			wantRejectCode: entities.RejectCodeNotAvailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			resp := tt.action(c)
+			if tt.wantRejectCode != "" {
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+				assert.Equal(t, tt.wantRejectCode, resp.RejectReasons[0].Code)
+				return
+			}
+			assert.Equal(t, entities.GetItemOutcomePrepared, resp.Outcome)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Availability(t *testing.T) {
+	ctx := context.Background()
+
+	latte := entities.Item{ID: "latte", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 50}, {ID: "hot_milk", Quantity: 150}}}
+	c := newStateTestMachine(ctx, Params{Menu: []entities.Item{hotTea, latte}})
+	assert.NoError(t, c.DeactivateIngredient(ctx, IngredientRequest{IngredientID: "hot_water"}))
+
+	got, err := c.Availability(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []RecipeAvailability{
+		{
+			Recipe: hotTea,
+			RejectReasons: []entities.RejectReason{
+				{Code: entities.RejectCodeIngredientDeactivated, RejectReasonMsg: "ingredient deactivated, resource-id : hot_water"},
+			},
+		},
+		{
+			Recipe: latte,
+			RejectReasons: []entities.RejectReason{
+				{Code: entities.RejectCodeIngredientDeactivated, RejectReasonMsg: "ingredient deactivated, resource-id : hot_water"},
+				{Code: entities.RejectCodeNotAvailable, RejectReasonMsg: entities.ErrResourceNotAvailable{ResourceID: "hot_milk"}.Error()},
+			},
+		},
+	}, got)
+
+	assert.NoError(t, c.AddIngredient(ctx, IngredientRequest{IngredientID: "hot_water"}))
+	got, err = c.Availability(ctx)
+	assert.NoError(t, err)
+	assert.True(t, got[0].Available)
+	assert.False(t, got[1].Available)
+}
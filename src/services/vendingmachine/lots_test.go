@@ -0,0 +1,199 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coffeeMachineImpl_RefillLot(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		action func(c CoffeeMachine, fakeClock *clock.Fake) *entities.GetItemResponse
+		want   []entities.LotUsage
+		// wantRejectCode is empty if the drink is prepared
+		wantRejectCode entities.RejectCode
+	}{
+		{
+			name: "success | poured from the oldest lot",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) *entities.GetItemResponse {
+				return pourOne(ctx, c, hotTea)
+			},
+			want: []entities.LotUsage{{IngredientID: "hot_water", LotID: "W-1", Quantity: 200}},
+		},
+		{
+			name: "success | pre-order collected from its lot",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) *entities.GetItemResponse {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: 2 * time.Hour})
+				if err != nil {
+					panic(err)
+				}
+				fakeClock.Advance(30 * time.Minute)
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+			},
+			want: []entities.LotUsage{{IngredientID: "hot_water", LotID: "W-1", Quantity: 200}},
+		},
+		{
+			name: "error | lot expired before the pre-order was collected",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) *entities.GetItemResponse {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: 2 * time.Hour})
+				if err != nil {
+					panic(err)
+				}
+				fakeClock.Advance(time.Hour)
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+			},
+			wantRejectCode: entities.RejectCodeExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(start)
+			c := New(Params{
+				ResourceManager: resourcemanager.New(resourcemanager.WithClock(fakeClock)),
+				NumOfOutlets:    1,
+				Clock:           fakeClock,
+			})
+			for _, req := range []RefillLotRequest{
+				{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 300}, LotID: "W-1", ExpiresAt: start.Add(time.Hour)},
+				// not enough for a drink on its own, once W-1 expired
+				{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 100}, LotID: "W-2"},
+			} {
+				if err := c.RefillLot(ctx, req); err != nil {
+					panic(err)
+				}
+			}
+
+			resp := tt.action(c, fakeClock)
+			if tt.wantRejectCode != "" {
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+				assert.Equal(t, tt.wantRejectCode, resp.RejectReasons[0].Code)
+				return
+			}
+			assert.Equal(t, entities.GetItemOutcomePrepared, resp.Outcome)
+			assert.Equal(t, tt.want, resp.Lots)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_RefillMany(t *testing.T) {
+	ctx := context.Background()
+
+	syrups := []RefillLotRequest{
+		{Ingredient: entities.Ingredient{ID: "ginger_syrup", Quantity: 100}},
+		{Ingredient: entities.Ingredient{ID: "sugar_syrup", Quantity: 100}, LotID: "S-1"},
+	}
+
+	tests := []struct {
+		name       string
+		shutdown   bool
+		reqs       []RefillLotRequest
+		wantErr    error
+		wantLevels []resourcemanager.Levels
+	}{
+		{
+			name: "success | every syrup refilled",
+			reqs: syrups,
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "ginger_syrup", OnHand: 100, Available: 100},
+				{IngredientID: "hot_water", OnHand: 1000, Available: 1000},
+				{IngredientID: "sugar_syrup", OnHand: 100, Available: 100},
+			},
+		},
+		{
+			name: "error | one refill is invalid, none is refilled",
+			reqs: append([]RefillLotRequest{
+				{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 100}, LotID: "W-1", ExpiresAt: time.Unix(1, 0)},
+			}, syrups...),
+			wantErr: entities.ErrLotExpired{ResourceID: "hot_water", LotID: "W-1"},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 1000, Available: 1000},
+			},
+		},
+		{
+			name:     "error | not allowed once shut down",
+			shutdown: true,
+			reqs:     syrups,
+			wantErr:  entities.ErrNotAllowedInState{Operation: "refilling", State: "STOPPED"},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 1000, Available: 1000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			if tt.shutdown {
+				if _, err := c.Shutdown(ctx); err != nil {
+					panic(err)
+				}
+			}
+
+			assert.Equal(t, tt.wantErr, c.RefillMany(ctx, tt.reqs))
+			inventory, _ := c.Inventory(ctx)
+			assert.Equal(t, tt.wantLevels, inventory.Ingredients)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Adjust(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		shutdown   bool
+		req        AdjustRequest
+		wantErr    error
+		wantLevels []resourcemanager.Levels
+	}{
+		{
+			name: "success | spillage, the pre-order keeps its reservation",
+			req:  AdjustRequest{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 500}, Reason: entities.AdjustReasonSpillage},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 500, Reserved: 200, Available: 300},
+			},
+		},
+		{
+			name:    "error | below what the pre-order holds",
+			req:     AdjustRequest{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 100}, Reason: entities.AdjustReasonStockTake},
+			wantErr: entities.ErrBelowReserved{ResourceID: "hot_water", Quantity: 100, Reserved: 200},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 1000, Reserved: 200, Available: 800},
+			},
+		},
+		{
+			name:     "error | not allowed once shut down",
+			shutdown: true,
+			req:      AdjustRequest{Ingredient: entities.Ingredient{ID: "hot_water", Quantity: 500}, Reason: entities.AdjustReasonWaste},
+			wantErr:  entities.ErrNotAllowedInState{Operation: "adjusting", State: "STOPPED"},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 1000, Available: 1000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour}); err != nil {
+				panic(err)
+			}
+			if tt.shutdown {
+				if _, err := c.Shutdown(ctx); err != nil {
+					panic(err)
+				}
+			}
+
+			assert.Equal(t, tt.wantErr, c.Adjust(ctx, tt.req))
+			inventory, _ := c.Inventory(ctx)
+			assert.Equal(t, tt.wantLevels, inventory.Ingredients)
+		})
+	}
+}
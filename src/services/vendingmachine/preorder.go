@@ -0,0 +1,125 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"time"
+
+	"github.com/avast/retry-go"
+)
+
+/*
+	PreOrder reserves the ingredients of the item for the pickup window, so the drink is guaranteed when it's collected.
+	If it isn't collected within the window, the reservation expires and the ingredients are released to other orders.
+	Like pouring a drink, reserving is retried if the ingredients are only temporarily unavailable.
+*/
+func (c *coffeeMachineImpl) PreOrder(ctx context.Context, req PreOrderRequest) (*entities.PreOrder, error) {
+	if req.Window <= 0 {
+		return nil, entities.ErrInvalidPreOrderWindow{OrderID: req.OrderID}
+	}
+	c.publish(eventbus.Event{Type: eventbus.TypeOrderReceived, OrderID: req.OrderID, Ingredients: req.Item.Ingredients})
+	if err := c.admit(); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	var reservation *reservationmanager.Reservation
+	err := retry.Do(
+		func() error {
+			var err error
+			reservation, err = c.reservationManager.Create(ctx, reservationmanager.CreateReservationRequest{
+				OrderID:     req.OrderID,
+				Ingredients: req.Item.Ingredients,
+				TTL:         req.Window,
+			})
+			return err
+		},
+		retry.RetryIf(isTemporarilyNotAvailable),
+		retry.Attempts(3),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	preOrder := entities.PreOrder{
+		Token:     reservation.Token,
+		OrderID:   req.OrderID,
+		Item:      req.Item,
+		ExpiresAt: reservation.ExpiresAt,
+	}
+
+	c.preOrdersMutex.Lock()
+	defer c.preOrdersMutex.Unlock()
+
+	c.prunePreOrders(c.clock.Now())
+	c.preOrders[preOrder.Token] = preOrder
+	return &preOrder, nil
+}
+
+// prunePreOrders forgets pre-orders which can no longer be collected, it must be called with preOrdersMutex locked
+func (c *coffeeMachineImpl) prunePreOrders(now time.Time) {
+	for token, preOrder := range c.preOrders {
+		if !now.Before(preOrder.ExpiresAt) {
+			delete(c.preOrders, token)
+		}
+	}
+}
+
+/*
+	Collect pours a pre-order against its held reservation.
+	A pre-order can only be collected once - it's forgotten before pouring, so a concurrent collect of the same token
+	finds nothing. If the window has passed, the drink is not prepared since its ingredients were already released.
+	Unless the machine is READY the drink is rejected, but the pre-order is kept - it may still be collected in its window.
+	Same if a boiler wouldn't be hot enough in time, see Params.MaxHeatWait.
+*/
+func (c *coffeeMachineImpl) Collect(ctx context.Context, req CollectRequest) *entities.GetItemResponse {
+	if err := c.admit(); err != nil {
+		return c.rejectCollect(req, err)
+	}
+	defer c.release()
+	c.pouring.RLock()
+	defer c.pouring.RUnlock()
+
+	c.preOrdersMutex.Lock()
+	preOrder, ok := c.preOrders[req.Token]
+	delete(c.preOrders, req.Token)
+	c.preOrdersMutex.Unlock()
+
+	if !ok {
+		return c.rejectCollect(req, entities.ErrReservationNotFound{Token: req.Token})
+	}
+	if err := c.heat(ctx, req.OutletID, preOrder.Item); err != nil {
+		// nothing was poured, so it may still be collected in its window
+		c.preOrdersMutex.Lock()
+		c.preOrders[req.Token] = preOrder
+		c.preOrdersMutex.Unlock()
+		return c.rejectCollect(req, err)
+	}
+
+	err := c.reservationManager.Commit(ctx, reservationmanager.CommitReservationRequest{Token: req.Token})
+	resp := c.toPourDrinkResponse(preOrder.Item, err)
+	if err == nil {
+		resp.Lots = c.committedLots(ctx, req.Token)
+		c.draw(preOrder.Item.Ingredients)
+	}
+	resp.OutletID = req.OutletID
+	resp.ServedAt = c.clock.Now()
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		c.countDrink(req.OutletID, preOrder.Item)
+	}
+	c.record(ctx, preOrder.OrderID, resp)
+	return resp
+}
+
+// rejectCollect rejects a collect which never got to the pre-order, there is no order to record it against
+func (c *coffeeMachineImpl) rejectCollect(req CollectRequest, err error) *entities.GetItemResponse {
+	resp := c.toPourDrinkResponse(entities.Item{}, err)
+	resp.OutletID = req.OutletID
+	resp.ServedAt = c.clock.Now()
+	c.publish(eventbus.Event{Type: eventbus.TypeDrinkRejected, At: resp.ServedAt, Token: req.Token, OutletID: req.OutletID,
+		RejectReasons: []string{resp.RejectReasons[0].String()}})
+	return resp
+}
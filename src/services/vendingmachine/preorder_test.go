@@ -0,0 +1,201 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_coffeeMachineImpl_PreOrder(t *testing.T) {
+	ctx := context.Background()
+
+	blackTea := entities.Item{
+		ID:          "black_tea",
+		Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 300}, {ID: "sugar_syrup", Quantity: 50}},
+	}
+
+	tests := []struct {
+		name   string
+		action func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error)
+		assert func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error)
+	}{
+		{
+			name: "success | collected within the window",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea, Window: 5 * time.Minute})
+				if err != nil {
+					return nil, err
+				}
+				fakeClock.Advance(4 * time.Minute)
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token, OutletID: 1}), nil
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomePrepared, resp.Outcome)
+				assert.Equal(t, blackTea, resp.Item)
+				assert.Equal(t, 1, resp.OutletID)
+				levels, _ := resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "hot_water"})
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "hot_water", OnHand: 200, Reserved: 0, Available: 200}, levels)
+			},
+		},
+		{
+			name: "success | pre-ordered ingredients are held from other drinks",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea, Window: 5 * time.Minute}); err != nil {
+					return nil, err
+				}
+				for resp := range c.PourDrinks(ctx, []entities.Item{blackTea}) {
+					return resp, nil
+				}
+				return nil, nil
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+			},
+		},
+		{
+			name: "success | released when not collected within the window",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea, Window: 5 * time.Minute})
+				if err != nil {
+					return nil, err
+				}
+				fakeClock.Advance(5 * time.Minute)
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token}), nil
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+				levels, _ := resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "hot_water"})
+				assert.Equal(t, &resourcemanager.Levels{IngredientID: "hot_water", OnHand: 500, Reserved: 0, Available: 500}, levels)
+			},
+		},
+		{
+			name: "success | collected only once",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea, Window: 5 * time.Minute})
+				if err != nil {
+					return nil, err
+				}
+				c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token}), nil
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+				levels, _ := resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "hot_water"})
+				assert.Equal(t, 200, levels.OnHand)
+			},
+		},
+		{
+			name: "error | not enough ingredients",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea, Window: 5 * time.Minute}); err != nil {
+					return nil, err
+				}
+				_, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-43", Item: blackTea, Window: 5 * time.Minute})
+				return nil, err
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				// the water is on hand, but held for the first pre-order
+				assert.IsType(t, entities.ErrResourceTemporarilyNotAvailable{}, err)
+			},
+		},
+		{
+			name: "error | no window",
+			action: func(c CoffeeMachine, fakeClock *clock.Fake) (*entities.GetItemResponse, error) {
+				_, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: blackTea})
+				return nil, err
+			},
+			assert: func(resourceManager resourcemanager.Repository, resp *entities.GetItemResponse, err error) {
+				assert.Equal(t, entities.ErrInvalidPreOrderWindow{OrderID: "desk-42"}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC))
+			resourceManager := resourcemanager.New()
+			c := New(Params{
+				ResourceManager: resourceManager,
+				NumOfOutlets:    2,
+				Clock:           fakeClock,
+			})
+			for _, ingredient := range []entities.Ingredient{{ID: "hot_water", Quantity: 500}, {ID: "sugar_syrup", Quantity: 100}} {
+				if err := c.Refill(ctx, ingredient); err != nil {
+					panic(err)
+				}
+			}
+
+			resp, err := tt.action(c, fakeClock)
+			tt.assert(resourceManager, resp, err)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Inventory(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		action      func(c CoffeeMachine)
+		wantLevels  []resourcemanager.Levels
+		wantPending int
+	}{
+		{
+			name:   "success | nothing reserved",
+			action: func(c CoffeeMachine) {},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 1000, Available: 1000},
+			},
+		},
+		{
+			name: "success | pre-order holds its ingredients",
+			action: func(c CoffeeMachine) {
+				if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour}); err != nil {
+					panic(err)
+				}
+				pourOne(ctx, c, hotTea)
+			},
+			wantLevels: []resourcemanager.Levels{
+				{IngredientID: "hot_water", OnHand: 800, Reserved: 200, Available: 600},
+			},
+			wantPending: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			tt.action(c)
+
+			inventory, err := c.Inventory(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLevels, inventory.Ingredients)
+			assert.Equal(t, tt.wantPending, inventory.PendingReservations)
+			assert.False(t, inventory.TakenAt.IsZero())
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Levels(t *testing.T) {
+	ctx := context.Background()
+
+	c := newStateTestMachine(ctx, Params{})
+	if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour}); err != nil {
+		panic(err)
+	}
+
+	// in the given order, an ingredient the machine doesn't hold has nothing on hand
+	levels, err := c.Levels(ctx, "hot_milk", "hot_water")
+	assert.NoError(t, err)
+	assert.Equal(t, []resourcemanager.Levels{
+		{IngredientID: "hot_milk"},
+		{IngredientID: "hot_water", OnHand: 1000, Reserved: 200, Available: 800},
+	}, levels)
+}
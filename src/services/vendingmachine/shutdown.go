@@ -0,0 +1,111 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/services/reporting"
+	"context"
+)
+
+/*
+	Shutdown stops the machine for good - new orders are rejected from then on, and the orders in flight
+	are served till ctx is done. Items of a batch which haven't reached an outlet by then are abandoned, while
+	the ones already being poured are finished, since a reservation is never left half committed.
+
+	Afterwards every outstanding reservation is cancelled [ uncollected pre-orders are abandoned too ],
+	the recorder is flushed if it's a reporting.Flusher, and the event bus is closed - so asynchronous
+	subscribers handle the events already published.
+*/
+func (c *coffeeMachineImpl) Shutdown(ctx context.Context) (*ShutdownSummary, error) {
+	c.stateMutex.Lock()
+	if c.stopping {
+		defer c.stateMutex.Unlock()
+		return nil, entities.ErrInvalidStateTransition{From: string(c.state), To: string(StateStopped)}
+	}
+	c.stopping = true
+	c.state = StateDraining
+	drained := c.drainedChannel()
+	c.stateMutex.Unlock()
+	c.publishState(SetStateRequest{State: StateDraining, Reason: "shutting down"})
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		close(c.abandon)
+		// only the items already being poured are left, so this doesn't take long
+		<-drained
+	}
+
+	summary := &ShutdownSummary{Abandoned: c.abandonedOrders()}
+	err := c.releaseReservations(summary)
+
+	c.stateMutex.Lock()
+	c.state = StateStopped
+	c.stateMutex.Unlock()
+	c.publishState(SetStateRequest{State: StateStopped, Reason: "shut down"})
+
+	if flusher, ok := c.recorder.(reporting.Flusher); ok && err == nil {
+		err = flusher.Flush(context.Background())
+	}
+	if c.eventBus != nil {
+		c.eventBus.Close()
+	}
+	return summary, err
+}
+
+// releaseReservations cancels every pending reservation, the pre-orders holding them are abandoned
+func (c *coffeeMachineImpl) releaseReservations(summary *ShutdownSummary) error {
+	ctx := context.Background()
+	pending, err := c.reservationManager.List(ctx, reservationmanager.ListReservationsRequest{Status: reservationmanager.StatusPending})
+	if err != nil {
+		return err
+	}
+
+	c.preOrdersMutex.Lock()
+	defer c.preOrdersMutex.Unlock()
+
+	for _, reservation := range pending {
+		if err := c.reservationManager.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: reservation.Token}); err != nil {
+			return err
+		}
+		summary.ReleasedReservations += 1
+		if _, ok := c.preOrders[reservation.Token]; ok {
+			summary.Abandoned = append(summary.Abandoned, AbandonedOrder{
+				OrderID: reservation.OrderID,
+				Token:   reservation.Token,
+				Reason:  AbandonReasonNotCollected,
+			})
+		}
+	}
+	c.preOrders = make(map[string]entities.PreOrder, 0)
+	return nil
+}
+
+// abandoned tells if the items which haven't reached an outlet yet should be abandoned
+func (c *coffeeMachineImpl) abandoned() bool {
+	select {
+	case <-c.abandon:
+		return true
+	default:
+		return false
+	}
+}
+
+// abandonOrder rejects an item which never reached an outlet, since the deadline of a shutdown passed
+func (c *coffeeMachineImpl) abandonOrder(item entities.Item) *entities.GetItemResponse {
+	c.abandonedMutex.Lock()
+	c.abandonedItems = append(c.abandonedItems, AbandonedOrder{OrderID: item.ID, Reason: AbandonReasonNotPoured})
+	c.abandonedMutex.Unlock()
+
+	resp := c.toPourDrinkResponse(item, entities.ErrOrderAbandoned{OrderID: item.ID})
+	resp.OutletID = -1
+	resp.ServedAt = c.clock.Now()
+	return resp
+}
+
+func (c *coffeeMachineImpl) abandonedOrders() []AbandonedOrder {
+	c.abandonedMutex.Lock()
+	defer c.abandonedMutex.Unlock()
+
+	return append([]AbandonedOrder{}, c.abandonedItems...)
+}
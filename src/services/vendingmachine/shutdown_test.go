@@ -0,0 +1,180 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flushingRecorder counts flushes, and the records before the first flush
+type flushingRecorder struct {
+	mutex   sync.Mutex
+	records int
+	flushed int
+}
+
+func (r *flushingRecorder) Record(ctx context.Context, resp *entities.GetItemResponse) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records += 1
+	return nil
+}
+
+func (r *flushingRecorder) Flush(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.flushed += 1
+	return nil
+}
+
+func Test_coffeeMachineImpl_Shutdown(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		action func(c CoffeeMachine) (*ShutdownSummary, error)
+		assert func(c CoffeeMachine, summary *ShutdownSummary, err error)
+	}{
+		{
+			name: "success | nothing in flight",
+			action: func(c CoffeeMachine) (*ShutdownSummary, error) {
+				return c.Shutdown(ctx)
+			},
+			assert: func(c CoffeeMachine, summary *ShutdownSummary, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &ShutdownSummary{Abandoned: []AbandonedOrder{}}, summary)
+				assert.Equal(t, StateStopped, c.State(ctx))
+				resp := pourOne(ctx, c, hotTea)
+				assert.Equal(t, entities.RejectCodeMachineNotReady, resp.RejectReasons[0].Code)
+				assert.Equal(t, entities.ErrNotAllowedInState{Operation: "refilling", State: "STOPPED"},
+					c.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 100}))
+			},
+		},
+		{
+			name: "success | uncollected pre-order is abandoned",
+			action: func(c CoffeeMachine) (*ShutdownSummary, error) {
+				if _, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour}); err != nil {
+					return nil, err
+				}
+				return c.Shutdown(ctx)
+			},
+			assert: func(c CoffeeMachine, summary *ShutdownSummary, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, summary.ReleasedReservations)
+				assert.Len(t, summary.Abandoned, 1)
+				assert.Equal(t, "desk-42", summary.Abandoned[0].OrderID)
+				assert.Equal(t, AbandonReasonNotCollected, summary.Abandoned[0].Reason)
+				assert.NotEmpty(t, summary.Abandoned[0].Token)
+
+				levels, _ := c.(*coffeeMachineImpl).resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: "hot_water"})
+				assert.Equal(t, 0, levels.Reserved)
+			},
+		},
+		{
+			name: "error | shut down twice",
+			action: func(c CoffeeMachine) (*ShutdownSummary, error) {
+				if _, err := c.Shutdown(ctx); err != nil {
+					return nil, err
+				}
+				return c.Shutdown(ctx)
+			},
+			assert: func(c CoffeeMachine, summary *ShutdownSummary, err error) {
+				assert.Equal(t, entities.ErrInvalidStateTransition{From: "STOPPED", To: "STOPPED"}, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			summary, err := tt.action(c)
+			tt.assert(c, summary, err)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Shutdown_Deadline(t *testing.T) {
+	ctx := context.Background()
+
+	recorder := &blockingRecorder{entered: make(chan struct{}, 1), unblock: make(chan struct{})}
+	c := newStateTestMachine(ctx, Params{Recorder: recorder})
+	batch := []entities.Item{
+		{ID: "tea-1", Ingredients: hotTea.Ingredients},
+		{ID: "tea-2", Ingredients: hotTea.Ingredients},
+		{ID: "tea-3", Ingredients: hotTea.Ingredients},
+	}
+
+	responses := make([]*entities.GetItemResponse, 0)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for resp := range c.PourDrinks(ctx, batch) {
+			responses = append(responses, resp)
+		}
+	}()
+	// the single outlet is busy with the first item
+	<-recorder.entered
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	type result struct {
+		summary *ShutdownSummary
+		err     error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		summary, err := c.Shutdown(shutdownCtx)
+		resultCh <- result{summary: summary, err: err}
+	}()
+	for !c.(*coffeeMachineImpl).abandoned() {
+		time.Sleep(time.Millisecond)
+	}
+	recorder.unblock <- struct{}{}
+	res := <-resultCh
+	wg.Wait()
+
+	assert.NoError(t, res.err)
+	assert.Equal(t, []AbandonedOrder{
+		{OrderID: "tea-2", Reason: AbandonReasonNotPoured},
+		{OrderID: "tea-3", Reason: AbandonReasonNotPoured},
+	}, res.summary.Abandoned)
+	assert.Len(t, responses, 3)
+	assert.Equal(t, entities.GetItemOutcomePrepared, responses[0].Outcome)
+	for _, resp := range responses[1:] {
+		assert.Equal(t, entities.RejectCodeAbandoned, resp.RejectReasons[0].Code)
+	}
+}
+
+func Test_coffeeMachineImpl_Shutdown_Flush(t *testing.T) {
+	ctx := context.Background()
+
+	bus := eventbus.New()
+	states := make([]string, 0)
+	mutex := sync.Mutex{}
+	bus.Subscribe(func(event eventbus.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		states = append(states, event.State)
+	}, eventbus.Types(eventbus.TypeMachineStateChanged), eventbus.Async(1, eventbus.PolicyBlock))
+
+	recorder := &flushingRecorder{}
+	c := newStateTestMachine(ctx, Params{Recorder: recorder, EventBus: bus})
+	pourOne(ctx, c, hotTea)
+	_, err := c.Shutdown(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recorder.records)
+	assert.Equal(t, 1, recorder.flushed)
+	// the bus was closed, so the asynchronous subscriber got every state change
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"DRAINING", "STOPPED"}, states)
+}
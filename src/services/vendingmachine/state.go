@@ -0,0 +1,192 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"sort"
+)
+
+/*
+	transitions are the states the machine may be moved to from each state, by SetState.
+	DRAINING is never requested directly - moving from READY to MAINTENANCE or CLEANING passes through it,
+	till the orders in flight are served. A fault may happen in any state, and only Shutdown moves to STOPPED.
+*/
+var transitions = map[State][]State{
+	StateStarting:    {StateReady, StateMaintenance, StateFaulted},
+	StateReady:       {StateMaintenance, StateCleaning, StateFaulted},
+	StateDraining:    {StateFaulted},
+	StateMaintenance: {StateReady, StateCleaning, StateFaulted},
+	StateCleaning:    {StateReady, StateMaintenance, StateFaulted},
+	StateFaulted:     {StateMaintenance},
+	StateStopped:     {},
+}
+
+func canMove(from, to State) bool {
+	for _, state := range transitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// refillStates are the states in which ingredients may be refilled
+var refillStates = map[State]bool{
+	StateStarting:    true,
+	StateReady:       true,
+	StateMaintenance: true,
+}
+
+func (c *coffeeMachineImpl) State(ctx context.Context) State {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	return c.state
+}
+
+/*
+	SetState moves the machine to the requested state.
+
+	Moving to MAINTENANCE or CLEANING first moves the machine to DRAINING - new orders are rejected from then on,
+	and SetState waits for the orders in flight to be served. If ctx is done before that, the machine goes back
+	to the state it was in and ctx's error is returned.
+*/
+func (c *coffeeMachineImpl) SetState(ctx context.Context, req SetStateRequest) error {
+	c.stateMutex.Lock()
+	from := c.state
+	if c.stopping || !canMove(from, req.State) {
+		c.stateMutex.Unlock()
+		return entities.ErrInvalidStateTransition{From: string(from), To: string(req.State)}
+	}
+	if req.State != StateMaintenance && req.State != StateCleaning || c.inFlight == 0 {
+		c.state = req.State
+		c.stateMutex.Unlock()
+		c.publishState(req)
+		return nil
+	}
+
+	c.state = StateDraining
+	drained := c.drainedChannel()
+	c.stateMutex.Unlock()
+	c.publishState(SetStateRequest{State: StateDraining, Reason: req.Reason})
+
+	select {
+	case <-drained:
+		return c.finishDraining(req, req.State)
+	case <-ctx.Done():
+		if err := c.finishDraining(SetStateRequest{State: from, Reason: "draining cancelled"}, from); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// finishDraining moves a DRAINING machine to the given state, unless it faulted or is being shut down meanwhile
+func (c *coffeeMachineImpl) finishDraining(req SetStateRequest, to State) error {
+	c.stateMutex.Lock()
+	if c.state != StateDraining || c.stopping {
+		defer c.stateMutex.Unlock()
+		return entities.ErrInvalidStateTransition{From: string(c.state), To: string(to)}
+	}
+	c.state = to
+	c.stateMutex.Unlock()
+	c.publishState(req)
+	return nil
+}
+
+// drainedChannel is closed once no order is in flight, it must be called with stateMutex locked
+func (c *coffeeMachineImpl) drainedChannel() <-chan struct{} {
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+	}
+	drained := c.drained
+	if c.inFlight == 0 {
+		close(c.drained)
+		c.drained = nil
+	}
+	return drained
+}
+
+func (c *coffeeMachineImpl) publishState(req SetStateRequest) {
+	c.publish(eventbus.Event{Type: eventbus.TypeMachineStateChanged, State: string(req.State), Reason: req.Reason})
+}
+
+// admit lets an order in, if the machine is READY. Every admitted order must be let out by release
+func (c *coffeeMachineImpl) admit() error {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	if c.state != StateReady {
+		return entities.ErrNotAllowedInState{Operation: "pouring", State: string(c.state)}
+	}
+	c.inFlight += 1
+	return nil
+}
+
+func (c *coffeeMachineImpl) release() {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	c.inFlight -= 1
+	if c.inFlight == 0 && c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+}
+
+// SetRecipes adds or replaces recipes of the menu, only while the machine is STARTING or in MAINTENANCE
+func (c *coffeeMachineImpl) SetRecipes(ctx context.Context, recipes []entities.Item) error {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	if c.state != StateStarting && c.state != StateMaintenance {
+		return entities.ErrNotAllowedInState{Operation: "changing recipes", State: string(c.state)}
+	}
+	// the menu is copied on write, so pours can read it without holding the lock
+	menu := make(map[string]entities.Item, len(c.menu)+len(recipes))
+	for id, recipe := range c.menu {
+		menu[id] = recipe
+	}
+	for _, recipe := range recipes {
+		menu[recipe.ID] = recipe
+	}
+	c.menu = menu
+	return nil
+}
+
+// Menu returns the recipes of the menu, ordered by their id
+func (c *coffeeMachineImpl) Menu(ctx context.Context) []entities.Item {
+	menu := c.currentMenu()
+	recipes := make([]entities.Item, 0, len(menu))
+	for _, recipe := range menu {
+		recipes = append(recipes, recipe)
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		return recipes[i].ID < recipes[j].ID
+	})
+	return recipes
+}
+
+func (c *coffeeMachineImpl) currentMenu() map[string]entities.Item {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	return c.menu
+}
+
+// withRecipes fills in the ingredients of items ordered only by their id, from the menu
+func (c *coffeeMachineImpl) withRecipes(items []entities.Item) []entities.Item {
+	menu := c.currentMenu()
+	if len(menu) == 0 {
+		return items
+	}
+	filled := make([]entities.Item, len(items))
+	for idx, item := range items {
+		filled[idx] = item
+		if recipe, ok := menu[item.ID]; ok && len(item.Ingredients) == 0 {
+			filled[idx] = recipe
+		}
+	}
+	return filled
+}
@@ -0,0 +1,299 @@
+package vendingmachine
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingRecorder holds every prepared drink in flight till it's unblocked, and tells when a drink got to it
+type blockingRecorder struct {
+	entered chan struct{}
+	unblock chan struct{}
+}
+
+func (r *blockingRecorder) Record(ctx context.Context, resp *entities.GetItemResponse) error {
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		r.entered <- struct{}{}
+		<-r.unblock
+	}
+	return nil
+}
+
+var hotTea = entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 200}}}
+
+func newStateTestMachine(ctx context.Context, p Params) CoffeeMachine {
+	p.ResourceManager = resourcemanager.New()
+	p.NumOfOutlets = 1
+	c := New(p)
+	if err := c.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 1000}); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func pourOne(ctx context.Context, c CoffeeMachine, item entities.Item) *entities.GetItemResponse {
+	for resp := range c.PourDrinks(ctx, []entities.Item{item}) {
+		return resp
+	}
+	return nil
+}
+
+func Test_coffeeMachineImpl_SetState(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		manualStart bool
+		states      []State
+		want        State
+		wantErr     error
+	}{
+		{
+			name:   "success | ready by default",
+			states: []State{},
+			want:   StateReady,
+		},
+		{
+			name:        "success | started manually",
+			manualStart: true,
+			states:      []State{StateReady},
+			want:        StateReady,
+		},
+		{
+			name:   "success | maintenance & back",
+			states: []State{StateMaintenance, StateCleaning, StateReady},
+			want:   StateReady,
+		},
+		{
+			name:   "success | faulted machine goes through maintenance",
+			states: []State{StateFaulted, StateMaintenance},
+			want:   StateMaintenance,
+		},
+		{
+			name:    "error | faulted machine can't be ready",
+			states:  []State{StateFaulted, StateReady},
+			want:    StateFaulted,
+			wantErr: entities.ErrInvalidStateTransition{From: "FAULTED", To: "READY"},
+		},
+		{
+			name:    "error | draining is never requested",
+			states:  []State{StateDraining},
+			want:    StateReady,
+			wantErr: entities.ErrInvalidStateTransition{From: "READY", To: "DRAINING"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.New()
+			published := make([]string, 0)
+			bus.Subscribe(func(event eventbus.Event) {
+				published = append(published, event.State)
+			}, eventbus.Types(eventbus.TypeMachineStateChanged))
+
+			c := New(Params{ResourceManager: resourcemanager.New(), NumOfOutlets: 1, EventBus: bus, ManualStart: tt.manualStart})
+			var err error
+			want := make([]string, 0)
+			for _, state := range tt.states {
+				if err = c.SetState(ctx, SetStateRequest{State: state}); err != nil {
+					break
+				}
+				want = append(want, string(state))
+			}
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, c.State(ctx))
+			assert.Equal(t, want, published)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_SetState_Draining(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    State
+		wantErr error
+	}{
+		{
+			name: "success | maintenance after the order in flight is served",
+			want: StateMaintenance,
+		},
+		{
+			name:    "error | draining cancelled",
+			timeout: 10 * time.Millisecond,
+			want:    StateReady,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &blockingRecorder{entered: make(chan struct{}, 1), unblock: make(chan struct{})}
+			c := newStateTestMachine(ctx, Params{Recorder: recorder})
+
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			var inFlight *entities.GetItemResponse
+			go func() {
+				defer wg.Done()
+				inFlight = pourOne(ctx, c, hotTea)
+			}()
+			<-recorder.entered
+
+			setStateCtx := ctx
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				setStateCtx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.SetState(setStateCtx, SetStateRequest{State: StateMaintenance, Reason: "descaling"})
+			}()
+
+			if tt.timeout == 0 {
+				for c.State(ctx) != StateDraining {
+					time.Sleep(time.Millisecond)
+				}
+				// new orders are rejected while draining
+				rejected := pourOne(ctx, c, hotTea)
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, rejected.Outcome)
+				assert.Equal(t, entities.RejectCodeMachineNotReady, rejected.RejectReasons[0].Code)
+				recorder.unblock <- struct{}{}
+			}
+			err := <-errCh
+			if tt.timeout > 0 {
+				recorder.unblock <- struct{}{}
+			}
+			wg.Wait()
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, c.State(ctx))
+			assert.Equal(t, entities.GetItemOutcomePrepared, inFlight.Outcome)
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_Maintenance(t *testing.T) {
+	ctx := context.Background()
+
+	strongTea := entities.Item{ID: "hot_tea", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 400}}}
+
+	tests := []struct {
+		name   string
+		action func(c CoffeeMachine) (*entities.GetItemResponse, error)
+		assert func(c CoffeeMachine, resp *entities.GetItemResponse, err error)
+	}{
+		{
+			name: "success | recipe changed in maintenance",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				if err := c.SetState(ctx, SetStateRequest{State: StateMaintenance}); err != nil {
+					return nil, err
+				}
+				if err := c.SetRecipes(ctx, []entities.Item{strongTea}); err != nil {
+					return nil, err
+				}
+				if err := c.SetState(ctx, SetStateRequest{State: StateReady}); err != nil {
+					return nil, err
+				}
+				return pourOne(ctx, c, entities.Item{ID: "hot_tea"}), nil
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomePrepared, resp.Outcome)
+				assert.Equal(t, strongTea, resp.Item)
+				assert.Equal(t, []entities.Item{strongTea}, c.Menu(ctx))
+			},
+		},
+		{
+			name: "success | refilled in maintenance",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				if err := c.SetState(ctx, SetStateRequest{State: StateMaintenance}); err != nil {
+					return nil, err
+				}
+				return nil, c.Refill(ctx, entities.Ingredient{ID: "hot_milk", Quantity: 500})
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "error | drinks rejected in maintenance",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				if err := c.SetState(ctx, SetStateRequest{State: StateMaintenance}); err != nil {
+					return nil, err
+				}
+				return pourOne(ctx, c, hotTea), nil
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomeNotPrepared, resp.Outcome)
+				assert.Equal(t, []entities.RejectReason{{
+					Code:            entities.RejectCodeMachineNotReady,
+					RejectReasonMsg: "pouring not allowed while the machine is MAINTENANCE",
+				}}, resp.RejectReasons)
+			},
+		},
+		{
+			name: "error | recipes can't change while ready",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				return nil, c.SetRecipes(ctx, []entities.Item{strongTea})
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.Equal(t, entities.ErrNotAllowedInState{Operation: "changing recipes", State: "READY"}, err)
+				assert.Equal(t, []entities.Item{}, c.Menu(ctx))
+			},
+		},
+		{
+			name: "error | no refills while cleaning",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				if err := c.SetState(ctx, SetStateRequest{State: StateCleaning}); err != nil {
+					return nil, err
+				}
+				return nil, c.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 500})
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.Equal(t, entities.ErrNotAllowedInState{Operation: "refilling", State: "CLEANING"}, err)
+			},
+		},
+		{
+			name: "error | pre-order kept while in maintenance",
+			action: func(c CoffeeMachine) (*entities.GetItemResponse, error) {
+				preOrder, err := c.PreOrder(ctx, PreOrderRequest{OrderID: "desk-42", Item: hotTea, Window: time.Hour})
+				if err != nil {
+					return nil, err
+				}
+				if err := c.SetState(ctx, SetStateRequest{State: StateMaintenance}); err != nil {
+					return nil, err
+				}
+				rejected := c.Collect(ctx, CollectRequest{Token: preOrder.Token})
+				if rejected.Outcome != entities.GetItemOutcomeNotPrepared {
+					return rejected, nil
+				}
+				if err := c.SetState(ctx, SetStateRequest{State: StateReady}); err != nil {
+					return nil, err
+				}
+				return c.Collect(ctx, CollectRequest{Token: preOrder.Token}), nil
+			},
+			assert: func(c CoffeeMachine, resp *entities.GetItemResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, entities.GetItemOutcomePrepared, resp.Outcome)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStateTestMachine(ctx, Params{})
+			resp, err := tt.action(c)
+			tt.assert(c, resp, err)
+		})
+	}
+}
@@ -4,96 +4,436 @@ import (
 	"coffeeMachine/src/entities"
 	"coffeeMachine/src/repository/reservationmanager"
 	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/heater"
+	"coffeeMachine/src/services/planner"
+	"coffeeMachine/src/services/reporting"
+	"coffeeMachine/src/services/scheduler"
 	"context"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/avast/retry-go"
 )
 
 // CoffeeMachine is the interface which exposes functionalities of our coffee-machine
 type CoffeeMachine interface {
+	// PourDrinks sends the response of every item as soon as it's served, and closes the channel after the last one.
+	// If the machine plans its batches, the responses are sent in the order of the batch, after all of it is served
 	PourDrinks(ctx context.Context, items []entities.Item) <-chan *entities.GetItemResponse
 	Refill(ctx context.Context, ingredient entities.Ingredient) error
+	// RefillLot refills a lot, which may expire - see resourcemanager.Repository
+	RefillLot(ctx context.Context, req RefillLotRequest) error
+	// RefillMany refills several ingredients at once, either all of them or none
+	RefillMany(ctx context.Context, reqs []RefillLotRequest) error
+	// Adjust sets the quantity on hand of an ingredient, e.g. after a stock-take - see resourcemanager.UpdateTypeAdjust
+	Adjust(ctx context.Context, req AdjustRequest) error
+	// PreOrder holds the ingredients of an item for a pickup window, see Collect
+	PreOrder(ctx context.Context, req PreOrderRequest) (*entities.PreOrder, error)
+	Collect(ctx context.Context, req CollectRequest) *entities.GetItemResponse
+	// State & SetState drive the state of the machine, see State
+	State(ctx context.Context) State
+	SetState(ctx context.Context, req SetStateRequest) error
+	// SetRecipes changes the menu, items ordered only by the id of a recipe are poured with its ingredients
+	SetRecipes(ctx context.Context, recipes []entities.Item) error
+	Menu(ctx context.Context) []entities.Item
+	// Shutdown stops the machine for good, see coffeeMachineImpl.Shutdown
+	Shutdown(ctx context.Context) (*ShutdownSummary, error)
+	// Hygiene reports the cleaning rules of every outlet, see Params.CleaningRules
+	Hygiene(ctx context.Context) []OutletHygiene
+	// Inventory reports every ingredient the machine holds, for status screens
+	Inventory(ctx context.Context) (*Inventory, error)
+	// Levels reports the given ingredients only, see coffeeMachineImpl.Levels
+	Levels(ctx context.Context, ingredientIDs ...string) ([]resourcemanager.Levels, error)
+	// AddIngredient, DeactivateIngredient & RemoveIngredient drive the lifecycle of an ingredient, see resourcemanager.Repository
+	AddIngredient(ctx context.Context, req IngredientRequest) error
+	DeactivateIngredient(ctx context.Context, req IngredientRequest) error
+	RemoveIngredient(ctx context.Context, req IngredientRequest) error
+	// Availability reports the recipes of the menu, see coffeeMachineImpl.Availability
+	Availability(ctx context.Context) ([]RecipeAvailability, error)
 }
 
 /*
-	To allow multiple requests for pouring items to work concurrently, we use a map of mutexes,
-	where each ingredient-id will have its corresponding mutex.
-	This allows concurrent operations on different ingredients from different items.
+	Multiple requests for pouring items work concurrently on the inventory ledger [ resourcemanager.Repository ],
+	every reservation, commit or release of an ingredient is a single atomic operation on the ledger -
+	so pours don't need to lock each other out.
+	Items reserve their ingredients through the reservation manager, which hands out a token for each reservation.
 
-	Since map is not thread safe, we use another mutex to guard writes to mutexesMap
+	Refills do lock pours out though [ pouring ] - a refill waits for the batches in flight, and holds off new ones.
+	Orders are only let in while the machine is READY, stateMutex guards the state, the orders in flight & the menu.
 */
 type coffeeMachineImpl struct {
-	resourceManager             resourcemanager.Repository
-	reservationManager          reservationmanager.Repository
-	numOfOutlets                int
-	mutexForAccessingMutexesMap sync.Mutex
-	mutexesMap                  map[string]*sync.Mutex
+	resourceManager    resourcemanager.Repository
+	reservationManager reservationmanager.Repository
+	recorder           reporting.Recorder
+	planningObjective  planner.Objective
+	scheduler          scheduler.Scheduler
+	clock              clock.Clock
+	eventBus           eventbus.Bus
+	numOfOutlets       int
+	preOrdersMutex     sync.Mutex
+	preOrders          map[string]entities.PreOrder
+	pouring            sync.RWMutex
+	stateMutex         sync.Mutex
+	state              State
+	inFlight           int
+	drained            chan struct{}
+	menu               map[string]entities.Item
+	stopping           bool
+	// abandon is closed once the deadline of a shutdown passed, see Shutdown
+	abandon        chan struct{}
+	abandonedMutex sync.Mutex
+	abandonedItems []AbandonedOrder
+	hygiene        *hygiene
+	heater         heater.Heater
+	maxHeatWait    time.Duration
 }
 
 type Params struct {
+	ResourceManager resourcemanager.Repository
+	// ReservationManager is optional, if not set - reservations are taken on ResourceManager by a new reservation manager
 	ReservationManager reservationmanager.Repository
-	ResourceManager    resourcemanager.Repository
 	NumOfOutlets       int
+	// Recorder is optional, if set - the outcome of every drink is recorded for reporting
+	Recorder reporting.Recorder
+	// PlanningObjective is optional, if set - every batch is planned before dispatching, see planner.Build
+	PlanningObjective planner.Objective
+	// Scheduler is optional, if set - outlets take turns as decided by the scheduler, instead of running concurrently.
+	// Used to reproduce the outcome of a batch deterministically, see scheduler.NewSeeded & scheduler.NewReplay
+	Scheduler scheduler.Scheduler
+	// Clock is optional, if not set - the wall clock is used to stamp drinks & events, and to expire pre-orders
+	Clock clock.Clock
+	// EventBus is optional, if set - orders and their outcomes are published to it.
+	// Pass the same bus to the resource manager, to also publish consumption & refills
+	EventBus eventbus.Bus
+	// Menu is optional, the initial recipes - see CoffeeMachine.SetRecipes
+	Menu []entities.Item
+	// ManualStart is optional, if set - the machine stays STARTING till it's moved to READY, instead of starting in READY
+	ManualStart bool
+	// CleaningRules are optional, outlets run the cleaning cycles of due rules between drinks
+	CleaningRules []CleaningRule
+	// Heater is optional, if set - drinks wait for the boilers of their hot ingredients to be hot enough.
+	// A drink is rejected instead, if that would take longer than MaxHeatWait
+	Heater      heater.Heater
+	MaxHeatWait time.Duration
 }
 
 func New(p Params) CoffeeMachine {
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	reservationManager := p.ReservationManager
+	if reservationManager == nil {
+		opts := []reservationmanager.Option{reservationmanager.WithClock(clk)}
+		if p.EventBus != nil {
+			opts = append(opts, reservationmanager.WithEventBus(p.EventBus))
+		}
+		reservationManager = reservationmanager.New(p.ResourceManager, opts...)
+	}
+	state := StateReady
+	if p.ManualStart {
+		state = StateStarting
+	}
+	menu := make(map[string]entities.Item, len(p.Menu))
+	for _, recipe := range p.Menu {
+		menu[recipe.ID] = recipe
+	}
 	return &coffeeMachineImpl{
-		resourceManager:             p.ResourceManager,
-		numOfOutlets:                p.NumOfOutlets,
-		mutexesMap:                  make(map[string]*sync.Mutex, 0),
-		reservationManager:          p.ReservationManager,
-		mutexForAccessingMutexesMap: sync.Mutex{},
+		resourceManager:    p.ResourceManager,
+		reservationManager: reservationManager,
+		numOfOutlets:       p.NumOfOutlets,
+		recorder:           p.Recorder,
+		planningObjective:  p.PlanningObjective,
+		scheduler:          p.Scheduler,
+		clock:              clk,
+		eventBus:           p.EventBus,
+		preOrdersMutex:     sync.Mutex{},
+		preOrders:          make(map[string]entities.PreOrder, 0),
+		pouring:            sync.RWMutex{},
+		stateMutex:         sync.Mutex{},
+		state:              state,
+		menu:               menu,
+		abandon:            make(chan struct{}),
+		abandonedMutex:     sync.Mutex{},
+		abandonedItems:     make([]AbandonedOrder, 0),
+		hygiene:            newHygiene(p.CleaningRules, p.NumOfOutlets, clk.Now()),
+		heater:             p.Heater,
+		maxHeatWait:        p.MaxHeatWait,
 	}
 }
 
-// PourDrinks uses a pool of workers to call pour-drink utility
+// PourDrinks uses a pool of workers to call pour-drink utility, the whole batch is rejected unless the machine is READY
 func (c *coffeeMachineImpl) PourDrinks(ctx context.Context, items []entities.Item) <-chan *entities.GetItemResponse {
-	inputCh := make(chan entities.Item, 5)
+	items = c.withRecipes(items)
+	for _, item := range items {
+		c.publish(eventbus.Event{Type: eventbus.TypeOrderReceived, OrderID: item.ID, Ingredients: item.Ingredients})
+	}
+	if err := c.admit(); err != nil {
+		return c.rejectAll(ctx, items, err)
+	}
+	c.pouring.RLock()
+
+	if c.planningObjective != planner.ObjectiveNone {
+		defer c.release()
+		defer c.pouring.RUnlock()
+		return c.pourPlannedDrinks(ctx, items)
+	}
+
+	// the batch is poured in the background, and every response is sent as soon as it's served.
+	// The channel holds the whole batch, so pouring never waits for a slow reader
 	result := make(chan *entities.GetItemResponse, len(items))
+	jobs := make([]pourJob, 0, len(items))
+	for idx, item := range items {
+		jobs = append(jobs, pourJob{index: idx, item: item})
+	}
+	go func() {
+		defer c.release()
+		defer c.pouring.RUnlock()
+
+		c.dispatch(ctx, jobs, func(index int, resp *entities.GetItemResponse) {
+			result <- resp
+		})
+		close(result)
+	}()
+	return result
+}
+
+/*
+	pourPlannedDrinks first plans the whole batch against the currently available inventory,
+	and only dispatches the selected items - which fit together in that inventory.
+	This way the outcome of a batch no longer depends on which outlet got to an ingredient first.
+	Nothing is reserved for the plan though - hot_water drawn by cleaning cycles, and orders or pre-orders
+	arriving meanwhile take from the same inventory, so a selected item may still be rejected.
+
+	Responses are returned in the order of the batch, so that the result is fully deterministic.
+*/
+func (c *coffeeMachineImpl) pourPlannedDrinks(ctx context.Context, items []entities.Item) <-chan *entities.GetItemResponse {
+	responses := make([]*entities.GetItemResponse, len(items))
+
+	inventory, err := c.availableInventory(ctx, items)
+	if err != nil {
+		for idx, item := range items {
+			responses[idx] = c.toPourDrinkResponse(item, err)
+		}
+		return toResultChannel(responses)
+	}
+
+	plan := planner.Build(inventory, items, c.planningObjective)
+	for _, idx := range plan.Excluded {
+		resp := c.toPourDrinkResponse(items[idx], entities.ErrExcludedByPlan{ItemID: items[idx].ID})
+		// the item never reached an outlet
+		resp.OutletID = -1
+		resp.ServedAt = c.clock.Now()
+		c.record(ctx, items[idx].ID, resp)
+		responses[idx] = resp
+	}
+
+	jobs := make([]pourJob, 0, len(plan.Selected))
+	for _, idx := range plan.Selected {
+		jobs = append(jobs, pourJob{index: idx, item: items[idx]})
+	}
+	// every job has a distinct index, so workers never write the same element
+	c.dispatch(ctx, jobs, func(index int, resp *entities.GetItemResponse) {
+		responses[index] = resp
+	})
+	return toResultChannel(responses)
+}
+
+// rejectAll rejects every item of the batch, before any of them reached an outlet
+func (c *coffeeMachineImpl) rejectAll(ctx context.Context, items []entities.Item, err error) <-chan *entities.GetItemResponse {
+	responses := make([]*entities.GetItemResponse, len(items))
+	for idx, item := range items {
+		resp := c.toPourDrinkResponse(item, err)
+		resp.OutletID = -1
+		resp.ServedAt = c.clock.Now()
+		c.record(ctx, item.ID, resp)
+		responses[idx] = resp
+	}
+	return toResultChannel(responses)
+}
+
+func toResultChannel(responses []*entities.GetItemResponse) <-chan *entities.GetItemResponse {
+	result := make(chan *entities.GetItemResponse, len(responses))
+	for _, resp := range responses {
+		result <- resp
+	}
+	close(result)
+	return result
+}
+
+// availableInventory returns the quantity of every ingredient used by the batch, which isn't reserved
+func (c *coffeeMachineImpl) availableInventory(ctx context.Context, items []entities.Item) (map[string]int, error) {
+	inventory := make(map[string]int, 0)
+	for _, item := range items {
+		for _, ingredient := range item.Ingredients {
+			if _, ok := inventory[ingredient.ID]; ok {
+				continue
+			}
+
+			levels, err := c.resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredient.ID})
+			if _, ok := err.(entities.ErrResourceNotAvailable); ok {
+				inventory[ingredient.ID] = 0
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			inventory[ingredient.ID] = levels.Available
+		}
+	}
+	return inventory, nil
+}
+
+type pourJob struct {
+	index int
+	item  entities.Item
+}
+
+// dispatch pours all jobs over the outlets, and waits for all of them to be served
+func (c *coffeeMachineImpl) dispatch(ctx context.Context, jobs []pourJob, onServed func(index int, resp *entities.GetItemResponse)) {
+	inputCh := make(chan pourJob, 5)
+	if c.scheduler != nil {
+		c.scheduler.Start(c.numOfOutlets)
+	}
 
 	wg := sync.WaitGroup{}
 	for i := 0; i < c.numOfOutlets; i += 1 {
 		wg.Add(1)
-		go c.worker(ctx, i, inputCh, result, &wg)
+		go c.worker(ctx, i, inputCh, onServed, &wg)
 	}
 
-	for _, item := range items {
-		inputCh <- item
+	for _, job := range jobs {
+		inputCh <- job
 	}
 	close(inputCh)
 	wg.Wait()
-
-	close(result)
-	return result
 }
 
-func (c *coffeeMachineImpl) worker(ctx context.Context, workerID int, inputCh <-chan entities.Item, result chan<- *entities.GetItemResponse, wg *sync.WaitGroup) {
+func (c *coffeeMachineImpl) worker(ctx context.Context, workerID int, inputCh <-chan pourJob, onServed func(index int, resp *entities.GetItemResponse), wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer c.done(workerID)
+
+	for {
+		c.step(scheduler.Step{OutletID: workerID, Action: scheduler.ActionTake})
+		job, ok := <-inputCh
+		if !ok {
+			return
+		}
+		// cleaning only holds up a drink in hand, an outlet with nothing left to pour doesn't clean till the next batch
+		c.cleanIfDue(ctx, workerID)
+
+		var resp *entities.GetItemResponse
+		if c.abandoned() {
+			resp = c.abandonOrder(job.item)
+		} else {
+			resp = c.pourDrink(ctx, workerID, job.item)
+			resp.OutletID = workerID
+			resp.ServedAt = c.clock.Now()
+			if resp.Outcome == entities.GetItemOutcomePrepared {
+				c.countDrink(workerID, job.item)
+			}
+		}
+		c.record(ctx, job.item.ID, resp)
+		onServed(job.index, resp)
+	}
+}
 
-	for item := range inputCh {
-		result <- c.pourDrink(ctx, item)
+// step waits for the scheduler to allow the outlet to take the step, if there is a scheduler
+func (c *coffeeMachineImpl) step(step scheduler.Step) {
+	if c.scheduler != nil {
+		c.scheduler.Step(step)
 	}
 }
 
+func (c *coffeeMachineImpl) done(outletID int) {
+	if c.scheduler != nil {
+		c.scheduler.Done(outletID)
+	}
+}
+
+// record reports the outcome of an order to the recorder & the event bus, if any.
+// A failure to record should never fail the drink itself, so we only log it
+func (c *coffeeMachineImpl) record(ctx context.Context, orderID string, resp *entities.GetItemResponse) {
+	event := eventbus.Event{
+		Type:     eventbus.TypeDrinkPrepared,
+		At:       resp.ServedAt,
+		OrderID:  orderID,
+		OutletID: resp.OutletID,
+	}
+	if resp.Outcome == entities.GetItemOutcomePrepared {
+		event.Ingredients = resp.Item.Ingredients
+	} else {
+		event.Type = eventbus.TypeDrinkRejected
+		for _, reason := range resp.RejectReasons {
+			event.RejectReasons = append(event.RejectReasons, reason.String())
+		}
+	}
+	c.publish(event)
+
+	if c.recorder == nil {
+		return
+	}
+	if err := c.recorder.Record(ctx, resp); err != nil {
+		log.Printf("failed to record outcome of item %s: %v", resp.Item.ID, err)
+	}
+}
+
+// publish stamps the event with the machine's clock, unless it's stamped already
+func (c *coffeeMachineImpl) publish(event eventbus.Event) {
+	if c.eventBus == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = c.clock.Now()
+	}
+	c.eventBus.Publish(event)
+}
+
 // pourDrink will try pouring a particular drink, retry if needed.
 // Note - retry is done only in case of ErrResourceTemporarilyNotAvailable
 // since it could possibly be a transient error
-func (c *coffeeMachineImpl) pourDrink(ctx context.Context, item entities.Item) *entities.GetItemResponse {
+func (c *coffeeMachineImpl) pourDrink(ctx context.Context, outletID int, item entities.Item) *entities.GetItemResponse {
+	if err := c.heat(ctx, outletID, item); err != nil {
+		return c.toPourDrinkResponse(item, err)
+	}
+	retryOptions := []retry.Option{
+		retry.RetryIf(isTemporarilyNotAvailable),
+		retry.Attempts(3),
+		retry.OnRetry(func(n uint, err error) {
+			c.step(scheduler.Step{OutletID: outletID, Action: scheduler.ActionRetry, ItemID: item.ID})
+		}),
+	}
+	if c.scheduler != nil {
+		// only one outlet runs at a time, so backing off can't let the reservation holder finish any sooner
+		retryOptions = append(retryOptions, retry.DelayType(retry.FixedDelay), retry.Delay(0))
+	}
+
+	var lots []entities.LotUsage
 	err := retry.Do(
 		func() error {
-			return c.attemptPouringDrink(ctx, item)
+			var err error
+			lots, err = c.attemptPouringDrink(ctx, outletID, item)
+			return err
 		},
-		retry.RetryIf(func(err error) bool {
-			if _, ok := err.(entities.ErrResourceTemporarilyNotAvailable); ok {
-				return true
-			}
-			return false
-		}),
-		retry.Attempts(3),
+		retryOptions...,
 	)
 
-	return c.toPourDrinkResponse(item, err)
+	if err == nil {
+		c.draw(item.Ingredients)
+	}
+	resp := c.toPourDrinkResponse(item, err)
+	resp.Lots = lots
+	return resp
+}
+
+func isTemporarilyNotAvailable(err error) bool {
+	if _, ok := err.(entities.ErrResourceTemporarilyNotAvailable); ok {
+		return true
+	}
+	return false
 }
 
 func (c *coffeeMachineImpl) toPourDrinkResponse(item entities.Item, err error) *entities.GetItemResponse {
@@ -108,145 +448,117 @@ func (c *coffeeMachineImpl) toPourDrinkResponse(item entities.Item, err error) *
 		Outcome: entities.GetItemOutcomeNotPrepared,
 		RejectReasons: []entities.RejectReason{
 			{
-				err.Error(),
+				Code:            rejectCode(err),
+				RejectReasonMsg: err.Error(),
 			},
 		},
 	}
 }
 
+func rejectCode(err error) entities.RejectCode {
+	// pours wrap the error of every attempt, the last one tells why the drink was rejected
+	if attempts, ok := err.(retry.Error); ok {
+		for _, attemptErr := range attempts {
+			if attemptErr != nil {
+				err = attemptErr
+			}
+		}
+	}
+	switch err.(type) {
+	case entities.ErrInsufficientResource:
+		return entities.RejectCodeInsufficient
+	case entities.ErrResourceTemporarilyNotAvailable:
+		return entities.RejectCodeTemporarilyNotAvailable
+	case entities.ErrResourceNotAvailable:
+		return entities.RejectCodeNotAvailable
+	case entities.ErrExcludedByPlan:
+		return entities.RejectCodeExcludedByPlan
+	case entities.ErrNotAllowedInState:
+		return entities.RejectCodeMachineNotReady
+	case entities.ErrOrderAbandoned:
+		return entities.RejectCodeAbandoned
+	case entities.ErrLotExpired:
+		return entities.RejectCodeExpired
+	case entities.ErrBelowTemperature:
+		return entities.RejectCodeBelowTemperature
+	case entities.ErrIngredientDeactivated:
+		return entities.RejectCodeIngredientDeactivated
+	default:
+		return entities.RejectCodeOther
+	}
+}
+
 /*
 	The logic for pouring drink is as follows:
-	For each ingredient of the item, we check if the ingredient & corresponding quantity is available or not,
-	If yes, then we go ahead and take a reservation on the given quantity [ the actual resource quantity is still
- 	the same, its just a reservation saying that this much quantity is unusable currently by other requests ].
-
-	Now, if reservations were successful for all ingredients, we actually update the ingredient quantities,
-	Then we delete the reservations.
+	We take a reservation for all ingredients of the item at once [ the actual resource quantity is still
+	the same, its just a reservation saying that this much quantity is unusable currently by other requests ].
+	The reservation manager either reserves all ingredients, or none of them.
 
-	In case where during acquiring reservations, for some ingredient reservation wasn't possible
-	[ probably because enough quantity is absent ], we release all already taken reservations.
+	Now, if the reservation was successful, we commit it - which consumes the reserved quantities.
+	If committing fails, we cancel the reservation, which releases whatever wasn't consumed yet.
 
-	Now it can happen that for an item, reservations were taken for some of the ingredients [ but not all ].
- 	If another request for such a reserved ingredient came up, we return an error - resourceTemporarilyUnavailable
+	Now it can happen that an ingredient is on hand, but reserved by some other item's reservation.
+	In such a case the reservation fails with an error - resourceTemporarilyUnavailable
 	The caller will retry a fixed number of times if it recieves this error [ so that the probability of user
 	getting a drink improves ]
 
+	Since every reservation has its own token, an item can only ever release the quantities it reserved itself.
+	Once committed, the reservation tells which lots the ingredients were taken from.
 */
-func (c *coffeeMachineImpl) attemptPouringDrink(ctx context.Context, item entities.Item) (err error) {
-	reservedItemsIdx := len(item.Ingredients)
-
-	defer func() {
-		// Note: we are deleting all reservations as part of defer.
-		// A more efficient approach would be to delete right after the resource-consume call,
-		// but then we would have to trach which reservations have already been deleted.
-		deleteErr := c.deleteReservations(ctx, item.Ingredients[:reservedItemsIdx])
-		if deleteErr != nil {
-			err = deleteErr
-		}
-	}()
-
-	for idx, ingredient := range item.Ingredients {
-		err := c.reserveIngredientIfPossible(ctx, ingredient)
-		if err != nil {
-			reservedItemsIdx = idx
-			return err
-		}
-	}
-
-	// if all reservations were successful, reflect the consumption from the actual resource them
-	// ideally since all reservations were successful, consumeIngredient would fail in cases of unreliable storage,
-	// which we are not considering for now. If we were to consider, we will have re-fill all the already consumed ingredients
-	for _, ingredient := range item.Ingredients {
-		err = c.consumeIngredient(ctx, ingredient)
-		if err != nil {
-			return err
-		}
+func (c *coffeeMachineImpl) attemptPouringDrink(ctx context.Context, outletID int, item entities.Item) ([]entities.LotUsage, error) {
+	c.step(scheduler.Step{OutletID: outletID, Action: scheduler.ActionReserve, ItemID: item.ID})
+	createReq := reservationmanager.CreateReservationRequest{
+		OrderID:     item.ID,
+		Ingredients: item.Ingredients,
 	}
-	return nil
-}
-
-func (c *coffeeMachineImpl) reserveIngredientIfPossible(ctx context.Context, toReserveIngredient entities.Ingredient) error {
-	mutex := c.getOrCreateMutex(ctx, toReserveIngredient)
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	resourceGetReq := resourcemanager.GetRequest{
-		IngredientID: toReserveIngredient.ID,
-	}
-	availableIngredient, err := c.resourceManager.GetIngredient(ctx, resourceGetReq)
+	reservation, err := c.reservationManager.Create(ctx, createReq)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	reservationGetReq := reservationmanager.GetReservationRequest{
-		IngredientID: toReserveIngredient.ID,
-	}
-	reservedIngredient, err := c.reservationManager.Get(ctx, reservationGetReq)
+	c.step(scheduler.Step{OutletID: outletID, Action: scheduler.ActionConsume, ItemID: item.ID})
+	err = c.reservationManager.Commit(ctx, reservationmanager.CommitReservationRequest{Token: reservation.Token})
 	if err != nil {
-		return err
-	}
-
-	// if the desired quantity is already readily available, create a new reservation
-	if availableIngredient.Quantity-reservedIngredient.Quantity >= toReserveIngredient.Quantity {
-		reservationCreateReq := reservationmanager.CreateReservationRequest{
-			IngredientID:    toReserveIngredient.ID,
-			ReserveQuantity: toReserveIngredient.Quantity,
+		c.step(scheduler.Step{OutletID: outletID, Action: scheduler.ActionRelease, ItemID: item.ID})
+		if cancelErr := c.reservationManager.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: reservation.Token}); cancelErr != nil {
+			return nil, cancelErr
 		}
-		err = c.reservationManager.Create(ctx, reservationCreateReq)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// if enough resource is not available readily right now, still there could be a case where
-	// there is some existing reservation for the ingredient, which could possibly fail later on - if all ingredients aren't available
-	// so if there is a chance of the request quantity being available from (availableQuantity + reservedQuantity), throw a custom error, and retry
-	if availableIngredient.Quantity >= toReserveIngredient.Quantity {
-		return entities.ErrResourceTemporarilyNotAvailable{ResourceID: toReserveIngredient.ID}
+		return nil, err
 	}
-
-	return entities.ErrInsufficientResource{ResourceID: toReserveIngredient.ID}
+	return c.committedLots(ctx, reservation.Token), nil
 }
 
-func (c *coffeeMachineImpl) deleteReservations(ctx context.Context, ingredients []entities.Ingredient) error {
-	for _, ingredient := range ingredients {
-		mutex := c.getOrCreateMutex(ctx, ingredient)
-		mutex.Lock()
-		deleteReq := reservationmanager.DeleteReservationRequest{
-			IngredientID:   ingredient.ID,
-			DeleteQuantity: ingredient.Quantity,
-		}
-		err := c.reservationManager.Delete(ctx, deleteReq)
-		if err != nil {
-			// since can't use defer in a loop
-			mutex.Unlock()
-			return err
-		}
-		mutex.Unlock()
+// committedLots returns the lots a committed reservation took its ingredients from.
+// The drink is already poured, so failing to look them up only loses the trace - it's logged
+func (c *coffeeMachineImpl) committedLots(ctx context.Context, token string) []entities.LotUsage {
+	reservation, err := c.reservationManager.Get(ctx, reservationmanager.GetReservationRequest{Token: token})
+	if err != nil {
+		log.Printf("failed to look up the lots of reservation %s: %v", token, err)
+		return nil
 	}
-	return nil
+	return reservation.Lots
 }
 
-func (c *coffeeMachineImpl) getOrCreateMutex(ctx context.Context, ingredient entities.Ingredient) *sync.Mutex {
-	c.mutexForAccessingMutexesMap.Lock()
-	defer c.mutexForAccessingMutexesMap.Unlock()
-
-	if _, ok := c.mutexesMap[ingredient.ID]; !ok {
-		c.mutexesMap[ingredient.ID] = &sync.Mutex{}
-	}
-	return c.mutexesMap[ingredient.ID]
+// Refill allows refilling some ingredient while the machine is STARTING, READY or in MAINTENANCE.
+// When READY, the refill waits for the batches in flight to be served
+func (c *coffeeMachineImpl) Refill(ctx context.Context, ingredient entities.Ingredient) error {
+	return c.RefillLot(ctx, RefillLotRequest{Ingredient: ingredient})
 }
 
-func (c *coffeeMachineImpl) consumeIngredient(ctx context.Context, ingredient entities.Ingredient) error {
-	mutex := c.getOrCreateMutex(ctx, ingredient)
-	mutex.Lock()
-	defer mutex.Unlock()
+// RefillLot refills an ingredient as a lot, drinks report the lots they were poured from, and expired lots are never poured
+func (c *coffeeMachineImpl) RefillLot(ctx context.Context, req RefillLotRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "refilling", State: string(state)}
+	}
+	c.pouring.Lock()
+	defer c.pouring.Unlock()
 
 	updateReq := resourcemanager.UpdateRequest{
-		IngredientID:     ingredient.ID,
-		UpdateType:       resourcemanager.UpdateTypeConsume,
-		ResourceQuantity: ingredient.Quantity,
+		IngredientID:     req.Ingredient.ID,
+		UpdateType:       resourcemanager.UpdateTypeRefill,
+		ResourceQuantity: req.Ingredient.Quantity,
+		LotID:            req.LotID,
+		ExpiresAt:        req.ExpiresAt,
 	}
 	_, err := c.resourceManager.UpdateIngredient(ctx, updateReq)
 	if err != nil {
@@ -255,20 +567,75 @@ func (c *coffeeMachineImpl) consumeIngredient(ctx context.Context, ingredient en
 	return nil
 }
 
-// Refill allows refilling some ingredient
-func (c *coffeeMachineImpl) Refill(ctx context.Context, ingredient entities.Ingredient) error {
-	mutex := c.getOrCreateMutex(ctx, ingredient)
-	mutex.Lock()
-	mutex.Unlock()
+// RefillMany locks pours out once for all the refills, and the ledger applies them atomically
+func (c *coffeeMachineImpl) RefillMany(ctx context.Context, reqs []RefillLotRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "refilling", State: string(state)}
+	}
+	c.pouring.Lock()
+	defer c.pouring.Unlock()
+
+	refillReqs := make([]resourcemanager.RefillRequest, 0, len(reqs))
+	for _, req := range reqs {
+		refillReqs = append(refillReqs, resourcemanager.RefillRequest{
+			IngredientID: req.Ingredient.ID,
+			Quantity:     req.Ingredient.Quantity,
+			LotID:        req.LotID,
+			ExpiresAt:    req.ExpiresAt,
+		})
+	}
+	_, err := c.resourceManager.RefillMany(ctx, refillReqs)
+	return err
+}
 
-	updateReq := resourcemanager.UpdateRequest{
-		IngredientID:     ingredient.ID,
-		UpdateType:       resourcemanager.UpdateTypeRefill,
-		ResourceQuantity: ingredient.Quantity,
+// Adjust locks pours out like refills do, so that the quantity counted isn't changing while it's set
+func (c *coffeeMachineImpl) Adjust(ctx context.Context, req AdjustRequest) error {
+	if state := c.State(ctx); !refillStates[state] {
+		return entities.ErrNotAllowedInState{Operation: "adjusting", State: string(state)}
 	}
-	_, err := c.resourceManager.UpdateIngredient(ctx, updateReq)
+	c.pouring.Lock()
+	defer c.pouring.Unlock()
+
+	_, err := c.resourceManager.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID:     req.Ingredient.ID,
+		UpdateType:       resourcemanager.UpdateTypeAdjust,
+		ResourceQuantity: req.Ingredient.Quantity,
+		Reason:           req.Reason,
+	})
+	return err
+}
+
+// Inventory is consistent with the pending reservations, every order was either reserved & poured in full or not at all
+// - it locks every ingredient of the ledger out while it's taken, Levels doesn't
+func (c *coffeeMachineImpl) Inventory(ctx context.Context) (*Inventory, error) {
+	snapshot, err := c.reservationManager.Snapshot(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return &Inventory{
+		TakenAt:             snapshot.TakenAt,
+		Ingredients:         snapshot.Levels,
+		PendingReservations: len(snapshot.Pending),
+	}, nil
+}
+
+/*
+	Levels reports the quantities of the given ingredients, in the given order - an ingredient the machine doesn't hold
+	reports nothing on hand. Each ingredient is read at its own instant, unlike Inventory, so the pours in flight
+	aren't held up.
+*/
+func (c *coffeeMachineImpl) Levels(ctx context.Context, ingredientIDs ...string) ([]resourcemanager.Levels, error) {
+	levels := make([]resourcemanager.Levels, 0, len(ingredientIDs))
+	for _, ingredientID := range ingredientIDs {
+		l, err := c.resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredientID})
+		if _, ok := err.(entities.ErrResourceNotAvailable); ok {
+			levels = append(levels, resourcemanager.Levels{IngredientID: ingredientID})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, *l)
+	}
+	return levels, nil
 }
@@ -4,6 +4,12 @@ import (
 	"coffeeMachine/src/entities"
 	"coffeeMachine/src/repository/reservationmanager"
 	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"coffeeMachine/src/services/machinefile"
+	"coffeeMachine/src/services/planner"
+	"coffeeMachine/src/services/reporting"
+	"coffeeMachine/src/services/scheduler"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,7 +17,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -71,9 +79,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 	ctx := context.Background()
 
 	type fields struct {
-		resourceManager    resourcemanager.Repository
-		reservationManager reservationmanager.Repository
-		numWorkers         int
+		resourceManager resourcemanager.Repository
+		numWorkers      int
 	}
 	type args struct {
 		ctx              context.Context
@@ -99,9 +106,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 		{
 			name: "success | given test input - not all items can be prepared",
 			fields: fields{
-				resourceManager:    resourcemanager.New(),
-				reservationManager: reservationmanager.New(),
-				numWorkers:         3,
+				resourceManager: resourcemanager.New(),
+				numWorkers:      3,
 			},
 			args: args{
 				ctx:              ctx,
@@ -120,9 +126,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 		{
 			name: "success | only few items can be prepared",
 			fields: fields{
-				resourceManager:    resourcemanager.New(),
-				reservationManager: reservationmanager.New(),
-				numWorkers:         5,
+				resourceManager: resourcemanager.New(),
+				numWorkers:      5,
 			},
 			args: args{
 				ctx:              ctx,
@@ -139,9 +144,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 		{
 			name: "success | all items can be prepared",
 			fields: fields{
-				resourceManager:    resourcemanager.New(),
-				reservationManager: reservationmanager.New(),
-				numWorkers:         5,
+				resourceManager: resourcemanager.New(),
+				numWorkers:      5,
 			},
 			args: args{
 				ctx:              ctx,
@@ -158,9 +162,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 		{
 			name: "success | no items can be prepared",
 			fields: fields{
-				resourceManager:    resourcemanager.New(),
-				reservationManager: reservationmanager.New(),
-				numWorkers:         5,
+				resourceManager: resourcemanager.New(),
+				numWorkers:      5,
 			},
 			args: args{
 				ctx:              ctx,
@@ -177,9 +180,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 		{
 			name: "success | no items to prepare",
 			fields: fields{
-				resourceManager:    resourcemanager.New(),
-				reservationManager: reservationmanager.New(),
-				numWorkers:         5,
+				resourceManager: resourcemanager.New(),
+				numWorkers:      5,
 			},
 			args: args{
 				ctx:              ctx,
@@ -201,9 +203,8 @@ func Test_coffeeMachineImpl_GetItems(t *testing.T) {
 			}
 
 			params := Params{
-				NumOfOutlets:       inputParams.Outlets,
-				ResourceManager:    resourcemanager.New(),
-				ReservationManager: reservationmanager.New(),
+				NumOfOutlets:    inputParams.Outlets,
+				ResourceManager: resourcemanager.New(),
 			}
 			c := New(params)
 
@@ -267,7 +268,7 @@ func getTestFileContents(fileName string) (*testFileStructure, error) {
 }
 
 func fromMapToIngredients(ingredientsMap map[string]int) []entities.Ingredient {
-	ingredientList := make([]entities.Ingredient, len(ingredientsMap))
+	ingredientList := make([]entities.Ingredient, 0, len(ingredientsMap))
 
 	for k, v := range ingredientsMap {
 		ingredient := entities.Ingredient{
@@ -286,9 +287,8 @@ func Benchmark_coffeeMachineImpl_GetItems1(t *testing.B) {
 	for n := 0; n < t.N; n++ {
 
 		type fields struct {
-			resourceManager    resourcemanager.Repository
-			reservationManager reservationmanager.Repository
-			numWorkers         int
+			resourceManager resourcemanager.Repository
+			numWorkers      int
 		}
 		type args struct {
 			ctx              context.Context
@@ -304,13 +304,12 @@ func Benchmark_coffeeMachineImpl_GetItems1(t *testing.B) {
 			{
 				name: "success | given test input - all items can be prepared",
 				fields: fields{
-					resourceManager:    resourcemanager.New(),
-					reservationManager: reservationmanager.New(),
-					numWorkers:         1,
+					resourceManager: resourcemanager.New(),
+					numWorkers:      1,
 				},
 				args: args{
 					ctx:              ctx,
-					testDataFileName: "../testdata/benchmarkdata/testdata1_pretty.json",
+					testDataFileName: "../testdata/benchmarkdata/testdata1.json",
 				},
 				assert: func(resp []*entities.GetItemResponse) {},
 			},
@@ -321,9 +320,8 @@ func Benchmark_coffeeMachineImpl_GetItems1(t *testing.B) {
 				defer ctrl.Finish()
 
 				params := Params{
-					NumOfOutlets:       tt.fields.numWorkers,
-					ResourceManager:    resourcemanager.New(),
-					ReservationManager: reservationmanager.New(),
+					NumOfOutlets:    tt.fields.numWorkers,
+					ResourceManager: resourcemanager.New(),
 				}
 				c := New(params)
 
@@ -349,3 +347,378 @@ func Benchmark_coffeeMachineImpl_GetItems1(t *testing.B) {
 		}
 	}
 }
+
+func Test_coffeeMachineImpl_PourDrinks_Recorder(t *testing.T) {
+	ctx := context.Background()
+
+	inputParams, err := getTestItems("../testdata/testdata1.json")
+	if err != nil {
+		panic(err)
+	}
+
+	// drinks are served at the time of the machine's clock, so are their records
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+	store := reporting.NewMemoryStore()
+	c := New(Params{
+		NumOfOutlets:    inputParams.Outlets,
+		ResourceManager: resourcemanager.New(),
+		Recorder:        store,
+		Clock:           clock.NewFake(start),
+	})
+	for _, ingredient := range inputParams.InitialInventory {
+		if err := c.Refill(ctx, ingredient); err != nil {
+			panic(err)
+		}
+	}
+
+	respList := make([]*entities.GetItemResponse, 0)
+	for elem := range c.PourDrinks(ctx, inputParams.ItemRequests) {
+		respList = append(respList, elem)
+	}
+
+	records, err := store.Records(ctx, start, start.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Len(t, records, len(respList))
+
+	report := reporting.Build(records, start, start.Add(time.Second))
+	assert.Equal(t, numOfPrepared(respList), report.Total.Prepared)
+	for _, resp := range respList {
+		assert.Equal(t, start, resp.ServedAt)
+		assert.True(t, resp.OutletID >= 0 && resp.OutletID < inputParams.Outlets)
+	}
+}
+
+func numOfPrepared(respList []*entities.GetItemResponse) int {
+	cnt := 0
+	for _, resp := range respList {
+		if resp.Outcome == entities.GetItemOutcomePrepared {
+			cnt += 1
+		}
+	}
+	return cnt
+}
+
+func Test_coffeeMachineImpl_PourDrinks_Planned(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		objective planner.Objective
+		prices    map[string]int
+		want      map[string]entities.GetItemOutcome
+	}{
+		{
+			name:      "success | max drinks",
+			objective: planner.ObjectiveMaxDrinks,
+			want: map[string]entities.GetItemOutcome{
+				"black_tea":  entities.GetItemOutcomePrepared,
+				"green_tea":  entities.GetItemOutcomeNotPrepared,
+				"hot_coffee": entities.GetItemOutcomePrepared,
+				"hot_tea":    entities.GetItemOutcomeNotPrepared,
+			},
+		},
+		{
+			name:      "success | max revenue",
+			objective: planner.ObjectiveMaxRevenue,
+			prices:    map[string]int{"black_tea": 10, "hot_coffee": 30, "hot_tea": 25},
+			want: map[string]entities.GetItemOutcome{
+				"black_tea":  entities.GetItemOutcomeNotPrepared,
+				"green_tea":  entities.GetItemOutcomeNotPrepared,
+				"hot_coffee": entities.GetItemOutcomePrepared,
+				"hot_tea":    entities.GetItemOutcomePrepared,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine, err := machinefile.Load("../testdata/testdata1.json")
+			if err != nil {
+				panic(err)
+			}
+			for idx := range machine.Beverages {
+				machine.Beverages[idx].Price = tt.prices[machine.Beverages[idx].ID]
+			}
+
+			// the outcome must not depend on scheduling, so run the same batch a few times
+			for run := 0; run < 10; run++ {
+				c := New(Params{
+					NumOfOutlets:      machine.Outlets,
+					ResourceManager:   resourcemanager.New(),
+					PlanningObjective: tt.objective,
+				})
+				for _, ingredient := range machine.Inventory {
+					if err := c.Refill(ctx, ingredient); err != nil {
+						panic(err)
+					}
+				}
+
+				idx := 0
+				for resp := range c.PourDrinks(ctx, machine.Beverages) {
+					// responses are in the order of the batch
+					assert.Equal(t, machine.Beverages[idx].ID, resp.Item.ID)
+					assert.Equal(t, tt.want[resp.Item.ID], resp.Outcome)
+					idx += 1
+				}
+				assert.Equal(t, len(machine.Beverages), idx)
+			}
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_PourDrinks_Scheduler(t *testing.T) {
+	ctx := context.Background()
+
+	machine, err := machinefile.Load("../testdata/testdata1.json")
+	if err != nil {
+		panic(err)
+	}
+
+	pour := func(s scheduler.Scheduler) map[string]entities.GetItemOutcome {
+		c := New(Params{
+			NumOfOutlets:    machine.Outlets,
+			ResourceManager: resourcemanager.New(),
+			Scheduler:       s,
+			// cleaning cycles draw hot_water too, so they're steps of the trace
+			CleaningRules: []CleaningRule{{Name: "rinse", AfterDrinks: 1, Water: 50}},
+		})
+		for _, ingredient := range machine.Inventory {
+			if err := c.Refill(ctx, ingredient); err != nil {
+				panic(err)
+			}
+		}
+
+		// the batch is poured twice over, so some outlet takes a drink after its first and is rinsed
+		batch := append(append([]entities.Item{}, machine.Beverages...), machine.Beverages...)
+		outcomes := make(map[string]entities.GetItemOutcome, 0)
+		for resp := range c.PourDrinks(ctx, batch) {
+			outcomes[resp.Item.ID] = resp.Outcome
+		}
+		return outcomes
+	}
+
+	tests := []struct {
+		name string
+		seed int64
+	}{
+		{name: "success | seed 1", seed: 1},
+		{name: "success | seed 2", seed: 2},
+		{name: "success | seed 3", seed: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recording := scheduler.NewSeeded(tt.seed)
+			outcomes := pour(recording)
+			assert.Len(t, outcomes, 4)
+
+			// the same seed always leads to the same interleaving, and so the same outcomes
+			again := scheduler.NewSeeded(tt.seed)
+			assert.Equal(t, outcomes, pour(again))
+			assert.Equal(t, recording.Trace(), again.Trace())
+			cleanings := 0
+			for _, step := range recording.Trace() {
+				if step.Action == scheduler.ActionClean {
+					cleanings += 1
+				}
+			}
+			assert.NotZero(t, cleanings)
+
+			replay := scheduler.NewReplay(recording.Trace())
+			assert.Equal(t, outcomes, pour(replay))
+			assert.NoError(t, replay.Err())
+			assert.Equal(t, recording.Trace(), replay.Trace())
+		})
+	}
+}
+
+func Test_coffeeMachineImpl_PourDrinks_Reservations(t *testing.T) {
+	ctx := context.Background()
+
+	machine, err := machinefile.Load("../testdata/testdata1.json")
+	if err != nil {
+		panic(err)
+	}
+
+	resourceManager := resourcemanager.New()
+	reservationManager := reservationmanager.New(resourceManager)
+	c := New(Params{
+		NumOfOutlets:       machine.Outlets,
+		ResourceManager:    resourceManager,
+		ReservationManager: reservationManager,
+	})
+	for _, ingredient := range machine.Inventory {
+		if err := c.Refill(ctx, ingredient); err != nil {
+			panic(err)
+		}
+	}
+
+	respList := make([]*entities.GetItemResponse, 0)
+	for resp := range c.PourDrinks(ctx, machine.Beverages) {
+		respList = append(respList, resp)
+	}
+
+	// every prepared item committed exactly one reservation, and nothing is left outstanding
+	committed, err := reservationManager.List(ctx, reservationmanager.ListReservationsRequest{Status: reservationmanager.StatusCommitted})
+	assert.NoError(t, err)
+	assert.Len(t, committed, numOfPrepared(respList))
+	pending, err := reservationManager.List(ctx, reservationmanager.ListReservationsRequest{Status: reservationmanager.StatusPending})
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+	for _, ingredient := range machine.Inventory {
+		levels, err := resourceManager.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredient.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, levels.Reserved)
+	}
+}
+
+func Test_coffeeMachineImpl_PourDrinks_Events(t *testing.T) {
+	ctx := context.Background()
+
+	machine, err := machinefile.Load("../testdata/testdata3.json")
+	if err != nil {
+		panic(err)
+	}
+
+	bus := eventbus.New()
+	mutex := sync.Mutex{}
+	counts := make(map[eventbus.Type]int, 0)
+	bus.Subscribe(func(event eventbus.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		counts[event.Type] += 1
+	})
+
+	c := New(Params{
+		NumOfOutlets:    machine.Outlets,
+		ResourceManager: resourcemanager.New(resourcemanager.WithEventBus(bus)),
+		EventBus:        bus,
+	})
+	for _, ingredient := range machine.Inventory {
+		if err := c.Refill(ctx, ingredient); err != nil {
+			panic(err)
+		}
+	}
+	respList := make([]*entities.GetItemResponse, 0)
+	for resp := range c.PourDrinks(ctx, machine.Beverages) {
+		respList = append(respList, resp)
+	}
+	bus.Close()
+
+	numOfIngredients := 0
+	for _, item := range machine.Beverages {
+		numOfIngredients += len(item.Ingredients)
+	}
+	// every drink of testdata3 can be prepared
+	assert.Equal(t, len(machine.Beverages), numOfPrepared(respList))
+	assert.Equal(t, map[eventbus.Type]int{
+		eventbus.TypeRefilled:           len(machine.Inventory),
+		eventbus.TypeOrderReceived:      len(machine.Beverages),
+		eventbus.TypeReservationTaken:   len(machine.Beverages),
+		eventbus.TypeIngredientConsumed: numOfIngredients,
+		eventbus.TypeDrinkPrepared:      len(machine.Beverages),
+	}, counts)
+}
+
+func Test_coffeeMachineImpl_PourDrinks_Streaming(t *testing.T) {
+	ctx := context.Background()
+
+	// the second drink isn't served, till the first one was received
+	bus := eventbus.New()
+	received := make(chan struct{})
+	served, waited := 0, false
+	bus.Subscribe(func(event eventbus.Event) {
+		if served += 1; served == 2 {
+			select {
+			case <-received:
+			case <-time.After(time.Second):
+				waited = true
+			}
+		}
+	}, eventbus.Types(eventbus.TypeDrinkPrepared))
+
+	c := New(Params{
+		NumOfOutlets:    1,
+		ResourceManager: resourcemanager.New(),
+		EventBus:        bus,
+	})
+	if err := c.Refill(ctx, entities.Ingredient{ID: "hot_water", Quantity: 1000}); err != nil {
+		panic(err)
+	}
+	item := entities.Item{ID: "hot_water", Ingredients: []entities.Ingredient{{ID: "hot_water", Quantity: 100}}}
+	result := c.PourDrinks(ctx, []entities.Item{item, item})
+
+	respList := []*entities.GetItemResponse{<-result}
+	close(received)
+	for resp := range result {
+		respList = append(respList, resp)
+	}
+	assert.False(t, waited, "the first drink wasn't sent before the batch was served")
+	assert.Equal(t, 2, numOfPrepared(respList))
+}
+
+func Benchmark_coffeeMachineImpl_PourDrinks_Reservations(b *testing.B) {
+	ctx := context.Background()
+
+	items := make([]entities.Item, 1000)
+	for idx := range items {
+		items[idx] = entities.Item{
+			ID: "black_tea",
+			Ingredients: []entities.Ingredient{
+				{ID: "hot_water", Quantity: 300},
+				{ID: "ginger_syrup", Quantity: 30},
+				{ID: "sugar_syrup", Quantity: 50},
+				{ID: "tea_leaves_syrup", Quantity: 30},
+			},
+		}
+	}
+
+	for _, numOfOutlets := range []int{1, 8} {
+		b.Run(fmt.Sprintf("%d_outlets", numOfOutlets), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				c := New(Params{
+					NumOfOutlets:    numOfOutlets,
+					ResourceManager: resourcemanager.New(),
+				})
+				for _, ingredient := range items[0].Ingredients {
+					if err := c.Refill(ctx, entities.Ingredient{ID: ingredient.ID, Quantity: ingredient.Quantity * len(items)}); err != nil {
+						panic(err)
+					}
+				}
+				b.StartTimer()
+
+				for range c.PourDrinks(ctx, items) {
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_coffeeMachineImpl_PourDrinks(b *testing.B) {
+	ctx := context.Background()
+
+	machine, err := machinefile.Load("../testdata/benchmarkdata/testdata1.json")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, numOfOutlets := range []int{1, 8} {
+		b.Run(fmt.Sprintf("%d_outlets", numOfOutlets), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				c := New(Params{
+					NumOfOutlets:    numOfOutlets,
+					ResourceManager: resourcemanager.New(),
+				})
+				for _, ingredient := range machine.Inventory {
+					if err := c.Refill(ctx, ingredient); err != nil {
+						panic(err)
+					}
+				}
+				b.StartTimer()
+
+				for range c.PourDrinks(ctx, machine.Beverages) {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"net/http"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationDrinkRejected       NotificationType = "DRINK_REJECTED"
+	NotificationIngredientLow       NotificationType = "INGREDIENT_LOW"
+	NotificationMachineStateChanged NotificationType = "MACHINE_STATE_CHANGED"
+)
+
+const (
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the body, keyed by the shared secret - "sha256=<hex>"
+	SignatureHeader = "X-Coffee-Machine-Signature"
+	TypeHeader      = "X-Coffee-Machine-Notification"
+)
+
+// Payload is the JSON body posted to every URL
+type Payload struct {
+	Type  NotificationType `json:"type"`
+	Event eventbus.Event   `json:"event"`
+	// Ingredient is the quantity available [ on hand, less reserved ], for low ingredient notifications
+	Ingredient *entities.Ingredient `json:"ingredient,omitempty"`
+}
+
+// DeadLetter is a line of the dead-letter file, for a payload which couldn't be delivered to a URL
+type DeadLetter struct {
+	URL      string    `json:"url"`
+	Payload  Payload   `json:"payload"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type Config struct {
+	URLs []string
+	// Secret signs every payload, see SignatureHeader. Payloads are not signed if it's empty
+	Secret string
+	// LowThresholds maps ingredient-ids to the available quantity below which the ingredient is low.
+	// A low ingredient is notified once, and again only after it was refilled above its threshold
+	LowThresholds map[string]int
+	// Ledger reports the available quantities, low thresholds are only checked if it's set
+	Ledger resourcemanager.Repository
+	// DeadLetterPath is optional, undeliverable payloads are appended to it as JSON lines
+	DeadLetterPath string
+	// Attempts & Delay between attempts of delivering a payload to a URL, default to 3 & 100ms
+	Attempts uint
+	Delay    time.Duration
+	// Client defaults to a client with a 5 second timeout
+	Client *http.Client
+	// Clock is optional, if not set - dead letters are stamped with the wall clock
+	Clock clock.Clock
+}
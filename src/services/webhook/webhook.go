@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"bytes"
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+)
+
+/*
+	Notifier posts a JSON payload to every configured URL, when a drink is rejected,
+	an ingredient falls below its low threshold, or the machine changes state.
+
+	Delivery to a URL is retried on network errors, 5xx and 429 responses. Other responses are final.
+	If a payload still can't be delivered, it is written to the dead-letter file, so it can be replayed later.
+*/
+type Notifier struct {
+	cfg Config
+	// mutex guards the low ingredients, and appending to the dead-letter file
+	mutex sync.Mutex
+	low   map[string]bool
+}
+
+func New(cfg Config) *Notifier {
+	if cfg.Attempts == 0 {
+		cfg.Attempts = 3
+	}
+	if cfg.Delay == 0 {
+		cfg.Delay = 100 * time.Millisecond
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.New()
+	}
+	return &Notifier{
+		cfg:   cfg,
+		mutex: sync.Mutex{},
+		low:   make(map[string]bool, 0),
+	}
+}
+
+// Subscribe delivers notifications from its own goroutine, so slow receivers only slow down the machine once
+// the buffer is full. No event is ever dropped - every notification is either delivered or dead-lettered
+func (n *Notifier) Subscribe(bus eventbus.Bus, bufferSize int) eventbus.Subscription {
+	return bus.Subscribe(
+		func(event eventbus.Event) {
+			n.Notify(context.Background(), event)
+		},
+		eventbus.Types(
+			eventbus.TypeDrinkRejected,
+			eventbus.TypeIngredientConsumed,
+			eventbus.TypeRefilled,
+			eventbus.TypeInventoryAdjusted,
+			eventbus.TypeLotExpired,
+			eventbus.TypeReservationTaken,
+			eventbus.TypeReservationReleased,
+			eventbus.TypeMachineStateChanged,
+		),
+		eventbus.Async(bufferSize, eventbus.PolicyBlock),
+	)
+}
+
+// Notify delivers the payloads for the event, if it is of interest
+func (n *Notifier) Notify(ctx context.Context, event eventbus.Event) {
+	for _, payload := range n.payloads(ctx, event) {
+		n.deliver(ctx, payload)
+	}
+}
+
+func (n *Notifier) payloads(ctx context.Context, event eventbus.Event) []Payload {
+	switch event.Type {
+	case eventbus.TypeDrinkRejected:
+		return []Payload{{Type: NotificationDrinkRejected, Event: event}}
+	case eventbus.TypeMachineStateChanged:
+		return []Payload{{Type: NotificationMachineStateChanged, Event: event}}
+	case eventbus.TypeIngredientConsumed, eventbus.TypeRefilled, eventbus.TypeInventoryAdjusted, eventbus.TypeLotExpired,
+		eventbus.TypeReservationTaken, eventbus.TypeReservationReleased:
+		payloads := make([]Payload, 0)
+		for _, ingredient := range event.Ingredients {
+			if available, ok := n.crossedLowThreshold(ctx, ingredient.ID); ok {
+				payloads = append(payloads, Payload{Type: NotificationIngredientLow, Event: event, Ingredient: available})
+			}
+		}
+		return payloads
+	}
+	return nil
+}
+
+/*
+	crossedLowThreshold returns the available quantity of the ingredient, if it just fell below its threshold.
+	It is read from the ledger rather than taken from the event - quantities held by reservations can't be served,
+	and reservations change what is available without changing what is on hand.
+*/
+func (n *Notifier) crossedLowThreshold(ctx context.Context, ingredientID string) (*entities.Ingredient, bool) {
+	threshold, ok := n.cfg.LowThresholds[ingredientID]
+	if !ok || n.cfg.Ledger == nil {
+		return nil, false
+	}
+	levels, err := n.cfg.Ledger.GetLevels(ctx, resourcemanager.GetRequest{IngredientID: ingredientID})
+	if err != nil {
+		log.Printf("failed to get the levels of %s: %v", ingredientID, err)
+		return nil, false
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	isLow := levels.Available < threshold
+	wasLow := n.low[ingredientID]
+	n.low[ingredientID] = isLow
+	if !isLow || wasLow {
+		return nil, false
+	}
+	return &entities.Ingredient{ID: ingredientID, Quantity: levels.Available}, true
+}
+
+func (n *Notifier) deliver(ctx context.Context, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to marshal %s notification: %v", payload.Type, err)
+		return
+	}
+
+	for _, url := range n.cfg.URLs {
+		err := retry.Do(
+			func() error {
+				return n.post(ctx, url, payload.Type, body)
+			},
+			retry.Attempts(n.cfg.Attempts),
+			retry.Delay(n.cfg.Delay),
+			retry.DelayType(retry.BackOffDelay),
+			retry.LastErrorOnly(true),
+		)
+		if err != nil {
+			n.deadLetter(DeadLetter{URL: url, Payload: payload, Error: err.Error(), FailedAt: n.cfg.Clock.Now()})
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, url string, notificationType NotificationType, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return retry.Unrecoverable(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TypeHeader, string(notificationType))
+	if n.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.cfg.Secret, body))
+	}
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body, so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook %s responded with status %d", url, resp.StatusCode)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return retry.Unrecoverable(err)
+}
+
+func (n *Notifier) deadLetter(letter DeadLetter) {
+	log.Printf("failed to deliver %s notification to %s: %s", letter.Payload.Type, letter.URL, letter.Error)
+	if n.cfg.DeadLetterPath == "" {
+		return
+	}
+
+	line, err := json.Marshal(letter)
+	if err != nil {
+		log.Printf("failed to marshal dead letter: %v", err)
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	file, err := os.OpenFile(n.cfg.DeadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("failed to open dead-letter file: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("failed to write dead letter: %v", err)
+	}
+}
+
+// Sign returns the value of the signature header for the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header of a received body, in constant time
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// ParseThresholds parses low thresholds like "milk=100,hot_water=500"
+func ParseThresholds(spec string) (map[string]int, error) {
+	thresholds := make(map[string]int, 0)
+	if strings.TrimSpace(spec) == "" {
+		return thresholds, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid threshold %q, expected ingredient=quantity", part)
+		}
+		quantity, err := strconv.Atoi(kv[1])
+		if err != nil || quantity < 0 {
+			return nil, fmt.Errorf("invalid quantity %q for ingredient %q", kv[1], kv[0])
+		}
+		thresholds[kv[0]] = quantity
+	}
+	return thresholds, nil
+}
@@ -0,0 +1,339 @@
+package webhook
+
+import (
+	"bufio"
+	"coffeeMachine/src/entities"
+	"coffeeMachine/src/repository/reservationmanager"
+	"coffeeMachine/src/repository/resourcemanager"
+	"coffeeMachine/src/services/clock"
+	"coffeeMachine/src/services/eventbus"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const _Secret = "s3cr3t"
+
+// receiver is a local webhook endpoint, which responds with the given statuses in turn, and then with 200
+type receiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	received []Payload
+	verified []bool
+	attempts int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.attempts += 1
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.received = append(r.received, payload)
+	r.verified = append(r.verified, Verify(_Secret, body, req.Header.Get(SignatureHeader)) &&
+		req.Header.Get(TypeHeader) == string(payload.Type))
+}
+
+func readDeadLetters(path string) []DeadLetter {
+	letters := make([]DeadLetter, 0)
+	file, err := os.Open(path)
+	if err != nil {
+		return letters
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			panic(err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	ctx := context.Background()
+
+	rejected := eventbus.Event{Type: eventbus.TypeDrinkRejected, OrderID: "hot_tea", RejectReasons: []string{"no milk"}}
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		statuses []int
+		events   []eventbus.Event
+		assert   func(r *receiver, deadLetters []DeadLetter)
+	}{
+		{
+			name:   "success | rejected drink is posted & signed",
+			events: []eventbus.Event{rejected},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Len(t, r.received, 1)
+				assert.Equal(t, NotificationDrinkRejected, r.received[0].Type)
+				assert.Equal(t, "hot_tea", r.received[0].Event.OrderID)
+				assert.Equal(t, []bool{true}, r.verified)
+				assert.Len(t, deadLetters, 0)
+			},
+		},
+		{
+			name: "success | machine state change is posted",
+			events: []eventbus.Event{
+				{Type: eventbus.TypeMachineStateChanged, State: "MAINTENANCE"},
+			},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Len(t, r.received, 1)
+				assert.Equal(t, NotificationMachineStateChanged, r.received[0].Type)
+				assert.Equal(t, "MAINTENANCE", r.received[0].Event.State)
+			},
+		},
+		{
+			name: "success | other events are ignored",
+			events: []eventbus.Event{
+				{Type: eventbus.TypeDrinkPrepared, OrderID: "hot_tea"},
+				{Type: eventbus.TypeOrderReceived, OrderID: "hot_tea"},
+			},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Equal(t, 0, r.attempts)
+			},
+		},
+		{
+			name:     "success | retried after server errors",
+			statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			events:   []eventbus.Event{rejected},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Equal(t, 3, r.attempts)
+				assert.Len(t, r.received, 1)
+				assert.Len(t, deadLetters, 0)
+			},
+		},
+		{
+			name:     "error | undeliverable after all attempts",
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			events:   []eventbus.Event{rejected},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Equal(t, 3, r.attempts)
+				assert.Len(t, deadLetters, 1)
+				assert.Equal(t, NotificationDrinkRejected, deadLetters[0].Payload.Type)
+				assert.Contains(t, deadLetters[0].Error, "502")
+				assert.True(t, start.Equal(deadLetters[0].FailedAt))
+			},
+		},
+		{
+			name:     "error | client errors are not retried",
+			statuses: []int{http.StatusBadRequest},
+			events:   []eventbus.Event{rejected},
+			assert: func(r *receiver, deadLetters []DeadLetter) {
+				assert.Equal(t, 1, r.attempts)
+				assert.Len(t, deadLetters, 1)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			dir, err := ioutil.TempDir("", "webhook")
+			if err != nil {
+				panic(err)
+			}
+			defer os.RemoveAll(dir)
+			deadLetterPath := filepath.Join(dir, "dead_letters.jsonl")
+
+			n := New(Config{
+				URLs:           []string{server.URL},
+				Secret:         _Secret,
+				DeadLetterPath: deadLetterPath,
+				Delay:          time.Millisecond,
+				Clock:          clock.NewFake(start),
+			})
+			for _, event := range tt.events {
+				n.Notify(ctx, event)
+			}
+
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			tt.assert(r, readDeadLetters(deadLetterPath))
+		})
+	}
+}
+
+func TestNotifier_Subscribe(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// the buffer only holds a single event, publishing waits for the notifier instead of dropping any
+	bus := eventbus.New()
+	n := New(Config{URLs: []string{server.URL}, Delay: time.Millisecond})
+	sub := n.Subscribe(bus, 1)
+	for i := 0; i < 10; i++ {
+		bus.Publish(eventbus.Event{Type: eventbus.TypeDrinkRejected, OrderID: "hot_tea"})
+	}
+	bus.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	assert.Len(t, r.received, 10)
+	assert.Equal(t, 0, sub.Dropped())
+}
+
+func TestNotifier_LowThreshold(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	bus := eventbus.New()
+	clk := clock.NewFake(start)
+	inventory := resourcemanager.New(resourcemanager.WithEventBus(bus), resourcemanager.WithClock(clk))
+	reservations := reservationmanager.New(inventory, reservationmanager.WithEventBus(bus), reservationmanager.WithClock(clk))
+	n := New(Config{
+		URLs:          []string{server.URL},
+		Secret:        _Secret,
+		LowThresholds: map[string]int{"milk": 100, "oat_milk": 50},
+		Ledger:        inventory,
+		Delay:         time.Millisecond,
+	})
+	// delivered synchronously, so every event is checked against the levels right after it
+	bus.Subscribe(func(event eventbus.Event) { n.Notify(ctx, event) })
+
+	update := func(updateType resourcemanager.UpdateType, quantity int) {
+		_, err := inventory.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+			IngredientID:     "milk",
+			UpdateType:       updateType,
+			ResourceQuantity: quantity,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	update(resourcemanager.UpdateTypeRefill, 200)
+	// 150 on hand, then 90 - crossing the threshold, then 30 - already low
+	update(resourcemanager.UpdateTypeConsume, 50)
+	update(resourcemanager.UpdateTypeConsume, 60)
+	update(resourcemanager.UpdateTypeConsume, 60)
+	// refilled above the threshold, and falling below it again
+	update(resourcemanager.UpdateTypeRefill, 170)
+	update(resourcemanager.UpdateTypeConsume, 150)
+	// refilled, and found below the threshold by a stock-take
+	update(resourcemanager.UpdateTypeRefill, 100)
+	if _, err := inventory.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID:     "milk",
+		UpdateType:       resourcemanager.UpdateTypeAdjust,
+		ResourceQuantity: 40,
+		Reason:           entities.AdjustReasonStockTake,
+	}); err != nil {
+		panic(err)
+	}
+	// refilled to 200 on hand, of which a reservation holds 150 - so only 50 are available
+	update(resourcemanager.UpdateTypeRefill, 160)
+	reservation, err := reservations.Create(ctx, reservationmanager.CreateReservationRequest{
+		OrderID:     "order1",
+		Ingredients: []entities.Ingredient{{ID: "milk", Quantity: 150}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := reservations.Cancel(ctx, reservationmanager.CancelReservationRequest{Token: reservation.Token}); err != nil {
+		panic(err)
+	}
+	// a lot of oat milk expires
+	if _, err := inventory.UpdateIngredient(ctx, resourcemanager.UpdateRequest{
+		IngredientID:     "oat_milk",
+		UpdateType:       resourcemanager.UpdateTypeRefill,
+		ResourceQuantity: 100,
+		LotID:            "L1",
+		ExpiresAt:        start.Add(time.Hour),
+	}); err != nil {
+		panic(err)
+	}
+	clk.Advance(2 * time.Hour)
+	if _, err := inventory.ListLots(ctx, resourcemanager.GetRequest{IngredientID: "oat_milk"}); err != nil {
+		panic(err)
+	}
+	bus.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	assert.Len(t, r.received, 5)
+	for _, payload := range r.received {
+		assert.Equal(t, NotificationIngredientLow, payload.Type)
+	}
+	assert.Equal(t, eventbus.TypeIngredientConsumed, r.received[0].Event.Type)
+	assert.Equal(t, &entities.Ingredient{ID: "milk", Quantity: 90}, r.received[0].Ingredient)
+	assert.Equal(t, eventbus.TypeIngredientConsumed, r.received[1].Event.Type)
+	assert.Equal(t, &entities.Ingredient{ID: "milk", Quantity: 50}, r.received[1].Ingredient)
+	assert.Equal(t, eventbus.TypeInventoryAdjusted, r.received[2].Event.Type)
+	assert.Equal(t, &entities.Ingredient{ID: "milk", Quantity: 40}, r.received[2].Ingredient)
+	assert.Equal(t, eventbus.TypeReservationTaken, r.received[3].Event.Type)
+	assert.Equal(t, &entities.Ingredient{ID: "milk", Quantity: 50}, r.received[3].Ingredient)
+	assert.Equal(t, eventbus.TypeLotExpired, r.received[4].Event.Type)
+	assert.Equal(t, &entities.Ingredient{ID: "oat_milk", Quantity: 0}, r.received[4].Ingredient)
+}
+
+func TestNotifier_LowThreshold_WithoutLedger(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	n := New(Config{URLs: []string{server.URL}, LowThresholds: map[string]int{"milk": 100}})
+	n.Notify(context.Background(), eventbus.Event{
+		Type:        eventbus.TypeIngredientConsumed,
+		Ingredients: []entities.Ingredient{{ID: "milk", Quantity: 50}},
+		Remaining:   []entities.Ingredient{{ID: "milk", Quantity: 10}},
+	})
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	assert.Empty(t, r.received)
+}
+
+func TestParseThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]int
+		wantErr bool
+	}{
+		{name: "success", spec: "milk=100, hot_water=500", want: map[string]int{"milk": 100, "hot_water": 500}},
+		{name: "success | empty", spec: "", want: map[string]int{}},
+		{name: "error | missing quantity", spec: "milk", wantErr: true},
+		{name: "error | negative quantity", spec: "milk=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseThresholds(tt.spec)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}